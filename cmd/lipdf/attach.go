@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf attach -file data.json... [-page n] [-native] [-o out.pdf] in.pdf
+func runAttach(args []string) error {
+	fs := newFlagSet("attach", "in.pdf")
+	var files listFlag
+	fs.Var(&files, "file", "file to attach, repeatable")
+	page := fs.Int("page", 0, "pin the files to this page instead of the document")
+	native := fs.Bool("native", false, "attach without pdftk")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(files) == 0 {
+		return fmt.Errorf("missing -file")
+	}
+
+	if !*native {
+		return writeOutput(*out, func(dest string) error {
+			return core.AttachFiles(context.Background(), pdfPath, dest, files, *page)
+		})
+	}
+	attachments := make([]core.Attachment, len(files))
+	for i, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(f)))
+		attachments[i] = core.Attachment{
+			Name:     filepath.Base(f),
+			MIMEType: mimeType,
+			Data:     data,
+			Page:     *page,
+		}
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.AttachFilesNative(pdfPath, dest, attachments)
+	})
+}
+
+// lipdf unpack [-out dir] [-native] in.pdf
+func runUnpack(args []string) error {
+	fs := newFlagSet("unpack", "in.pdf")
+	outDir := fs.String("out", ".", "directory for the attached files")
+	native := fs.Bool("native", false, "unpack without pdftk")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var paths []string
+	if *native {
+		paths, err = core.UnpackFilesNative(pdfPath, *outDir)
+	} else {
+		paths, err = core.UnpackFiles(context.Background(), pdfPath, *outDir)
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+	return nil
+}
+
+// listFlag collects repeated flags
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
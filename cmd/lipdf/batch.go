@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf batch -data rows.csv [-mapping map.json] [-map fields.yaml] [-tsv] [-out dir] in.pdf
+func runBatch(args []string) error {
+	fs := newFlagSet("batch", "in.pdf")
+	dataPath := fs.String("data", stdio, "csv or tsv file with a header line, \"-\" for stdin")
+	mappingPath := fs.String("mapping", "", "yaml or json file mapping columns to fields (default header names are field names)")
+	fieldMapPath := fs.String("map", "", "yaml or json file mapping data keys to pdf field names")
+	tsv := fs.Bool("tsv", false, "data is tab separated (default for .tsv files)")
+	outDir := fs.String("out", ".", "directory for the filled pdfs, named after the record id")
+	workers := fs.Int("workers", 0, "concurrent fills (default number of CPUs)")
+	flatten := fs.Bool("flatten", false, "flatten the forms so fields can no longer be edited")
+	check := fs.Bool("validate", false, "validate every record against the form before filling")
+	tag := fs.Bool("tag", false, "set RecordID and the template in the document info of every output")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if fs.Arg(0) == stdio && *dataPath == stdio {
+		return fmt.Errorf("pdf and data cannot both be read from stdin")
+	}
+
+	opts := core.CSVOptions{}
+	if *tsv || strings.HasSuffix(strings.ToLower(*dataPath), ".tsv") {
+		opts.Comma = '\t'
+	}
+	if len(*mappingPath) > 0 {
+		opts.Mapping, err = core.LoadCSVMapping(*mappingPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var data io.Reader = os.Stdin
+	if *dataPath != stdio {
+		f, err := os.Open(*dataPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data = f
+	}
+	records, err := core.NewCSVRecords(data, opts)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := core.LoadTemplate(pdfPath)
+	if err != nil {
+		return err
+	}
+	defer tmpl.Close()
+
+	var fieldMap *core.FieldMapping
+	if len(*fieldMapPath) > 0 {
+		fieldMap, err = core.LoadFieldMapping(*fieldMapPath)
+		if err != nil {
+			return err
+		}
+		printMappingWarnings(tmpl.CheckMapping(fieldMap))
+	}
+
+	err = os.MkdirAll(*outDir, 0755)
+	if err != nil {
+		return err
+	}
+	output := core.DirOutput(*outDir)
+	batchOpts := core.BatchOptions{
+		Workers:  *workers,
+		Fill:     core.FillOptions{Flatten: *flatten, Mapping: fieldMap},
+		Validate: *check,
+	}
+	if *tag {
+		batchOpts.Fill.Info = map[string]string{}
+	}
+	summary, err := core.FillBatch(context.Background(), tmpl, records, batchOpts, func(res core.BatchResult, pdf io.Reader) error {
+		if res.Err != nil {
+			fmt.Fprintf(os.Stderr, "record %s: %v\n", res.ID, res.Err)
+		}
+		return output(res, pdf)
+	})
+	fmt.Fprintf(os.Stderr, "filled %d of %d records\n", summary.Total-summary.Failed, summary.Total)
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d records failed", summary.Failed)
+	}
+	return nil
+}
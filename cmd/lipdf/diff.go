@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf diff [-map fields.yaml] [-o file] old.pdf new.pdf
+func runDiff(args []string) error {
+	fs := newFlagSet("diff", "old.pdf new.pdf")
+	mapPath := fs.String("map", "", "mapping file to check against new.pdf, renamed targets get a suggestion")
+	out := fs.String("o", "", "output file (default stdout)")
+	oldPath, newPath, cleanup, err := parsePdfPairArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	diff, err := core.DiffTemplateFiles(context.Background(), oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	if len(*mapPath) > 0 {
+		m, err := core.LoadFieldMapping(*mapPath)
+		if err != nil {
+			return err
+		}
+		warnings, err := core.CheckFieldMapping(m, newPath)
+		if err != nil {
+			return err
+		}
+		printMappingWarnings(diff.SuggestRenames(warnings))
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, diff)
+	})
+}
+
+// lipdf diffvalues [-format text|json] [-native] [-o file] old.pdf new.pdf
+func runDiffValues(args []string) error {
+	fs := newFlagSet("diffvalues", "old.pdf new.pdf")
+	format := fs.String("format", "text", "output format: text or json")
+	native := fs.Bool("native", false, "read the values without pdftk")
+	out := fs.String("o", "", "output file (default stdout)")
+	oldPath, newPath, cleanup, err := parsePdfPairArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var changes []core.ValueChange
+	if *native {
+		oldValues, err := core.FormValuesNative(oldPath)
+		if err != nil {
+			return err
+		}
+		newValues, err := core.FormValuesNative(newPath)
+		if err != nil {
+			return err
+		}
+		changes = core.DiffValues(oldValues, newValues)
+	} else {
+		changes, err = core.DiffValueFiles(context.Background(), oldPath, newPath)
+		if err != nil {
+			return err
+		}
+	}
+	return create(*out, func(w io.Writer) error {
+		if *format == "json" {
+			return writeJSON(w, changes)
+		}
+		for _, c := range changes {
+			if _, err := fmt.Fprintln(w, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// parse flags and the two pdf arguments, one of which may be "-" for stdin
+func parsePdfPairArgs(fs *flag.FlagSet, args []string) (string, string, func(), error) {
+	err := fs.Parse(args)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return "", "", nil, flag.ErrHelp
+	}
+	if fs.Arg(0) == stdio && fs.Arg(1) == stdio {
+		return "", "", nil, fmt.Errorf("both pdfs cannot be read from stdin")
+	}
+	oldPath, oldCleanup, err := inputPath(fs.Arg(0))
+	if err != nil {
+		return "", "", nil, err
+	}
+	newPath, newCleanup, err := inputPath(fs.Arg(1))
+	if err != nil {
+		oldCleanup()
+		return "", "", nil, err
+	}
+	return oldPath, newPath, func() {
+		oldCleanup()
+		newCleanup()
+	}, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf encrypt -owner-pw secret [-user-pw pw] [-algorithm aes128] [-allow Printing,FillIn] [-o out.pdf] in.pdf
+func runEncrypt(args []string) error {
+	fs := newFlagSet("encrypt", "in.pdf")
+	var ef encryptFlags
+	ef.register(fs)
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	enc, err := ef.encryption()
+	if err != nil {
+		return err
+	}
+	if enc == nil {
+		return fmt.Errorf("missing -owner-pw or -user-pw")
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.EncryptPDF(context.Background(), pdfPath, dest, *enc)
+	})
+}
+
+// encryptFlags are the encryption flags shared by the commands writing pdfs
+type encryptFlags struct {
+	ownerPassword *string
+	userPassword  *string
+	algorithm     *string
+	allow         *string
+}
+
+func (f *encryptFlags) register(fs *flag.FlagSet) {
+	f.ownerPassword = fs.String("owner-pw", "", "encrypt the output, the owner password grants all permissions")
+	f.userPassword = fs.String("user-pw", "", "encrypt the output, the user password is needed to open it")
+	f.algorithm = fs.String("algorithm", string(core.AES128), "encryption algorithm: aes128, rc4-128 or rc4-40")
+	f.allow = fs.String("allow", "", "permissions of the user, such as Printing,CopyContents,ModifyContents,FillIn or AllFeatures")
+}
+
+// encryption returns nil when no password is set
+func (f *encryptFlags) encryption() (*core.Encryption, error) {
+	if len(*f.ownerPassword) == 0 && len(*f.userPassword) == 0 {
+		if len(*f.allow) > 0 {
+			return nil, fmt.Errorf("-allow needs -owner-pw")
+		}
+		return nil, nil
+	}
+	allow, err := core.ParsePermissions(*f.allow)
+	if err != nil {
+		return nil, err
+	}
+	enc := &core.Encryption{
+		OwnerPassword: *f.ownerPassword,
+		UserPassword:  *f.userPassword,
+		Algorithm:     core.EncryptionAlgorithm(*f.algorithm),
+		Allow:         allow,
+	}
+	return enc, enc.Validate()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"io"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf fields [-o file] in.pdf
+func runFields(args []string) error {
+	fs := newFlagSet("fields", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := core.PdfFieldsToJSON(pdfPath)
+	if err != nil {
+		return err
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, info)
+	})
+}
+
+// lipdf geometry [-o file] in.pdf
+func runGeometry(args []string) error {
+	fs := newFlagSet("geometry", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	g, err := core.ReadGeometry(pdfPath)
+	if err != nil {
+		return err
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, g)
+	})
+}
+
+// lipdf values [-format json|fdf|xfdf] [-o file] in.pdf
+func runValues(args []string) error {
+	fs := newFlagSet("values", "in.pdf")
+	format := fs.String("format", "json", "output format: json, fdf or xfdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return exportValues(pdfPath, *format, *out)
+}
+
+// lipdf fdf [-o file] in.pdf
+func runFdf(args []string) error {
+	fs := newFlagSet("fdf", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return writeOutput(*out, func(dest string) error {
+		return core.GenerateFdf(pdfPath, dest)
+	})
+}
+
+// lipdf xfdf [-o file] in.pdf
+func runXfdf(args []string) error {
+	fs := newFlagSet("xfdf", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return exportValues(pdfPath, "xfdf", *out)
+}
+
+func exportValues(pdfPath, format, out string) error {
+	form, err := core.FormValues(pdfPath)
+	if err != nil {
+		return err
+	}
+	return create(out, func(w io.Writer) error {
+		return writeFormData(w, form, format)
+	})
+}
+
+// parse flags and the single pdf argument, "-" reads the pdf from stdin.
+// An encrypted pdf is decrypted with the -pw flag first.
+func parsePdfArg(fs *flag.FlagSet, args []string) (string, func(), error) {
+	password := fs.String("pw", "", "owner password of an encrypted input pdf")
+	err := fs.Parse(args)
+	if err != nil {
+		return "", nil, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", nil, flag.ErrHelp
+	}
+	path, cleanup, err := inputPath(fs.Arg(0))
+	if err != nil {
+		return "", nil, err
+	}
+	return decryptInput(path, *password, cleanup)
+}
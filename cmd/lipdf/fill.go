@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf fill -data file [-format json|fdf|xfdf] [-map fields.yaml] [-info Key=Value] [-attach-data json] [-image Field=photo.jpg] [-drop-xfa|-fill-xfa] [-owner-pw pw] [-flatten] [-native] [-break-signatures] [-o out.pdf] in.pdf
+func runFill(args []string) error {
+	fs := newFlagSet("fill", "in.pdf")
+	dataPath := fs.String("data", stdio, "form data file in json, fdf or xfdf, \"-\" for stdin")
+	format := fs.String("format", "", "format of the data: json, fdf or xfdf (default from extension or content)")
+	flatten := fs.Bool("flatten", false, "flatten the form so fields can no longer be edited")
+	needAppearances := fs.Bool("need-appearances", false, "let the viewer regenerate field appearances")
+	check := fs.Bool("validate", false, "validate the data against the form before filling")
+	mapPath := fs.String("map", "", "yaml or json file mapping data keys to pdf field names")
+	info := infoFlag{}
+	fs.Var(info, "info", "document info entry Key=Value of the output, repeatable")
+	attachData := fs.String("attach-data", "", "embed the filled data in the output as json, fdf or xfdf")
+	var images imageFlag
+	fs.Var(&images, "image", imageUsage)
+	dropXFA := fs.Bool("drop-xfa", false, "remove the XFA form of hybrid forms")
+	fillXFA := fs.Bool("fill-xfa", false, "also fill the XFA datasets of hybrid forms")
+	native := fs.Bool("native", false, "fill without pdftk as an incremental update, keeping signatures valid")
+	breakSignatures := fs.Bool("break-signatures", false, "fill signed pdfs with pdftk, invalidating the signatures")
+	var ef encryptFlags
+	ef.register(fs)
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if fs.Arg(0) == stdio && *dataPath == stdio {
+		return fmt.Errorf("pdf and data cannot both be read from stdin")
+	}
+
+	enc, err := ef.encryption()
+	if err != nil {
+		return err
+	}
+	form, err := readFormData(*dataPath, *format)
+	if err != nil {
+		return err
+	}
+	if len(*mapPath) > 0 {
+		form, err = applyMapping(form, *mapPath, pdfPath)
+		if err != nil {
+			return err
+		}
+	}
+	if *check {
+		err = validate(form, pdfPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := core.FillOptions{
+		Flatten:         *flatten,
+		NeedAppearances: *needAppearances,
+		Encryption:      enc,
+		AttachData:      *attachData,
+		Images:          images,
+		DropXFA:         *dropXFA,
+		FillXFA:         *fillXFA,
+		BreakSignatures: *breakSignatures,
+	}
+	if len(info) > 0 {
+		opts.Info = info
+	}
+	return writeOutput(*out, func(dest string) error {
+		if *native {
+			return core.FillFormNative(context.Background(), form, pdfPath, dest, opts)
+		}
+		return core.FillFormFile(form, pdfPath, dest, opts)
+	})
+}
+
+// translate data keys to field names, mapping entries missing from the
+// form are reported on stderr
+func applyMapping(form map[string]interface{}, mapPath, pdfPath string) (map[string]interface{}, error) {
+	m, err := core.LoadFieldMapping(mapPath)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := core.CheckFieldMapping(m, pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	printMappingWarnings(warnings)
+	return m.Apply(form)
+}
+
+func printMappingWarnings(warnings []core.MappingWarning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+}
+
+// lipdf validate -data file [-format json|fdf|xfdf] in.pdf
+func runValidate(args []string) error {
+	fs := newFlagSet("validate", "in.pdf")
+	dataPath := fs.String("data", stdio, "form data file in json, fdf or xfdf, \"-\" for stdin")
+	format := fs.String("format", "", "format of the data: json, fdf or xfdf (default from extension or content)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if fs.Arg(0) == stdio && *dataPath == stdio {
+		return fmt.Errorf("pdf and data cannot both be read from stdin")
+	}
+
+	form, err := readFormData(*dataPath, *format)
+	if err != nil {
+		return err
+	}
+	return validate(form, pdfPath)
+}
+
+// print validation errors to stderr, fail if there are any
+func validate(form map[string]interface{}, pdfPath string) error {
+	errs, err := core.ValidateForm(form, pdfPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, e.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d invalid fields", len(errs))
+	}
+	return nil
+}
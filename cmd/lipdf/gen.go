@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf gen [-pkg name] [-type name] [-o file] in.pdf
+func runGen(args []string) error {
+	fs := newFlagSet("gen", "in.pdf")
+	pkg := fs.String("pkg", "forms", "package name of the generated file")
+	typeName := fs.String("type", "", "name of the generated struct (default derived from the pdf name)")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := core.PdfFieldsToJSON(pdfPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := core.GenerateGo(info, core.GenOptions{Package: *pkg, TypeName: *typeName})
+	if err != nil {
+		return err
+	}
+
+	if len(*out) == 0 {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*out, src, 0644)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf image -image Field=photo.jpg|page:x1,y1,x2,y2=photo.jpg... [-o out.pdf] in.pdf
+func runImage(args []string) error {
+	fs := newFlagSet("image", "in.pdf")
+	var images imageFlag
+	fs.Var(&images, "image", imageUsage)
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(images) == 0 {
+		return fmt.Errorf("missing -image")
+	}
+
+	return writeOutput(*out, func(dest string) error {
+		return core.AddImagesNative(pdfPath, dest, images)
+	})
+}
+
+const imageUsage = "JPEG or PNG for a push button Field=photo.jpg or a page rectangle page:x1,y1,x2,y2=photo.jpg, repeatable"
+
+// imageFlag reads the images given as Field=file or page:x1,y1,x2,y2=file
+type imageFlag []core.Image
+
+func (f *imageFlag) String() string {
+	return fmt.Sprintf("%d images", len(*f))
+}
+
+func (f *imageFlag) Set(s string) error {
+	i := strings.LastIndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("expected Field=file or page:x1,y1,x2,y2=file")
+	}
+	target, path := s[:i], s[i+1:]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	img := core.Image{Data: data}
+	page, rect, ok := strings.Cut(target, ":")
+	n, err := strconv.Atoi(page)
+	if !ok || err != nil {
+		img.Field = target
+		*f = append(*f, img)
+		return nil
+	}
+	img.Page = n
+	img.Rect, err = parseRect(rect)
+	if err != nil {
+		return fmt.Errorf("invalid rectangle %q: %v", rect, err)
+	}
+	*f = append(*f, img)
+	return nil
+}
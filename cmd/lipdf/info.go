@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf info [-native] [-o file] in.pdf
+func runInfo(args []string) error {
+	fs := newFlagSet("info", "in.pdf")
+	native := fs.Bool("native", false, "read without pdftk")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var meta *core.Metadata
+	if *native {
+		meta, err = core.ReadMetadataNative(pdfPath)
+	} else {
+		meta, err = core.ReadMetadata(context.Background(), pdfPath, "")
+	}
+	if err != nil {
+		return err
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, meta)
+	})
+}
+
+// lipdf setinfo -set Key=Value... [-native] [-o out.pdf] in.pdf
+func runSetInfo(args []string) error {
+	fs := newFlagSet("setinfo", "in.pdf")
+	info := infoFlag{}
+	fs.Var(info, "set", "document info entry Key=Value, repeatable, an empty value removes the entry")
+	native := fs.Bool("native", false, "update without pdftk")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(info) == 0 {
+		return fmt.Errorf("missing -set")
+	}
+
+	return writeOutput(*out, func(dest string) error {
+		if *native {
+			return core.UpdateInfoNative(pdfPath, dest, info)
+		}
+		return core.UpdateInfo(context.Background(), pdfPath, dest, info)
+	})
+}
+
+// infoFlag collects repeated Key=Value flags
+type infoFlag map[string]string
+
+func (f infoFlag) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k+"="+f[k])
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (f infoFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("expected Key=Value")
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// stdin/stdout placeholder for file arguments
+const stdio = "-"
+
+// inputPath returns a path pdftk can read, stdin is copied to a temporary
+// file which is removed by cleanup
+func inputPath(path string) (string, func(), error) {
+	if path != stdio {
+		return path, func() {}, nil
+	}
+	f, err := ioutil.TempFile("", "lipdf-in-*.pdf")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	_, err = io.Copy(f, os.Stdin)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("fail to read stdin: %v", err)
+	}
+	return f.Name(), cleanup, nil
+}
+
+// decryptInput returns a decrypted copy of the pdf at path when password
+// is set, cleanup removes the copy and runs the cleanup of path
+func decryptInput(path, password string, cleanup func()) (string, func(), error) {
+	if len(password) == 0 {
+		return path, cleanup, nil
+	}
+	dir, err := ioutil.TempDir("", "lipdf-plain-")
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	plainCleanup := func() {
+		os.RemoveAll(dir)
+		cleanup()
+	}
+	plain := filepath.Join(dir, "plain.pdf")
+	err = core.DecryptPDF(context.Background(), path, plain, password)
+	if err != nil {
+		plainCleanup()
+		return "", nil, err
+	}
+	return plain, plainCleanup, nil
+}
+
+// writeOutput runs write with a path to produce the output file in, then
+// copies it to stdout when path is empty or "-"
+func writeOutput(path string, write func(dest string) error) error {
+	if len(path) > 0 && path != stdio {
+		return write(path)
+	}
+	dir, err := ioutil.TempDir("", "lipdf-out-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "output")
+	err = write(dest)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+// create writes to the named file, or stdout when path is empty or "-"
+func create(path string, write func(w io.Writer) error) error {
+	if len(path) == 0 || path == stdio {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readFormData loads form data in json, fdf or xfdf format, the format is
+// taken from the flag, the file extension or the content
+func readFormData(path, format string) (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	if path == stdio {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(format) == 0 {
+		format = dataFormat(path, data)
+	}
+	switch format {
+	case "json":
+		// numbers keep their digits, 61412345678 is not 6.1412345678e+10
+		var form map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&form)
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode json data: %v", err)
+		}
+		return form, nil
+	case "fdf":
+		return core.ReadFDF(bytes.NewReader(data))
+	case "xfdf":
+		return core.ReadXFDF(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("unknown data format %q", format)
+}
+
+func dataFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".fdf":
+		return "fdf"
+	case ".xfdf", ".xml":
+		return "xfdf"
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("%FDF")):
+		return "fdf"
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return "xfdf"
+	}
+	return "json"
+}
+
+// writeFormData writes form data in json, fdf or xfdf format
+func writeFormData(w io.Writer, form map[string]interface{}, format string) error {
+	switch format {
+	case "json":
+		return writeJSON(w, form)
+	case "fdf":
+		return core.WriteFDF(w, form)
+	case "xfdf":
+		return core.WriteXFDF(w, form)
+	}
+	return fmt.Errorf("unknown data format %q", format)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,114 @@
+// Command lipdf fills and inspects PDF forms from the command line.
+//
+// Usage:
+//
+//	lipdf <command> [flags] [args]
+//
+// Run "lipdf <command> -h" for the flags of a command. File arguments
+// and outputs accept "-" for stdin/stdout, outputs default to stdout:
+//
+//	lipdf fields form.pdf
+//	lipdf fill -data data.json -flatten -o filled.pdf form.pdf
+//	cat form.pdf | lipdf values -format xfdf -
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// subcommand of lipdf
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"fields", "print the form fields of a PDF as JSON", runFields},
+	{"geometry", "print the pages and field positions of a PDF as JSON", runGeometry},
+	{"fill", "fill a PDF with JSON, FDF or XFDF data", runFill},
+	{"values", "print the current field values of a PDF", runValues},
+	{"fdf", "export the form data of a PDF as FDF", runFdf},
+	{"xfdf", "export the form data of a PDF as XFDF", runXfdf},
+	{"validate", "check form data against the fields of a PDF", runValidate},
+	{"diff", "compare the fields of two revisions of a form and suggest renames", runDiff},
+	{"diffvalues", "list the fields whose values differ between two filled PDFs", runDiffValues},
+	{"batch", "fill a PDF once per row of a CSV or TSV file", runBatch},
+	{"info", "print the document info, bookmarks and page count of a PDF", runInfo},
+	{"setinfo", "set document info entries of a PDF", runSetInfo},
+	{"merge", "concatenate PDFs, renaming conflicting form fields", runMerge},
+	{"cat", "keep selected pages of a PDF", runCat},
+	{"rotate", "rotate pages of a PDF", runRotate},
+	{"burst", "split a PDF into one file per page", runBurst},
+	{"preview", "render pages of a PDF to PNG with pdftoppm or ghostscript", runPreview},
+	{"stamp", "put a PDF over or under the pages of a PDF", runStamp},
+	{"watermark", "stamp a text watermark on every page of a PDF", runWatermark},
+	{"attach", "embed files in a PDF", runAttach},
+	{"unpack", "extract the files embedded in a PDF", runUnpack},
+	{"image", "place JPEG or PNG images in push buttons or page rectangles", runImage},
+	{"xfa", "print the XFA fields and data of a hybrid form as JSON", runXFA},
+	{"dropxfa", "remove the XFA form so viewers show the AcroForm fields", runDropXFA},
+	{"signatures", "list the signature fields of a PDF and whether they are signed", runSignatures},
+	{"sign", "sign a PDF with a PKCS#12 or PEM certificate", runSign},
+	{"verify", "verify the signatures of a PDF", runVerify},
+	{"encrypt", "protect a PDF with passwords and permissions", runEncrypt},
+	{"gen", "generate a Go struct for the form of a PDF", runGen},
+	{"serve", "run the HTTP fill service", runServe},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(flag.Args()[1:])
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lipdf %s: %v\n", name, err)
+			if errors.Is(err, core.ErrPasswordRequired) {
+				fmt.Fprintf(os.Stderr, "the pdf is encrypted, pass its owner password with -pw\n")
+			}
+			if errors.Is(err, core.ErrSigned) {
+				fmt.Fprintf(os.Stderr, "fill with -native to keep the signatures, or -break-signatures\n")
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "lipdf: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: lipdf <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+// new flag set of a subcommand, usage is the argument synopsis
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: lipdf %s [flags] %s\n", name, synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf merge [-native] [-keep-names] [-pw password] [-o out.pdf] in.pdf...
+func runMerge(args []string) error {
+	fs := newFlagSet("merge", "in.pdf...")
+	native := fs.Bool("native", false, "merge without pdftk")
+	keepNames := fs.Bool("keep-names", false, "keep conflicting field names, fields of the same name share their value")
+	password := fs.String("pw", "", "owner password of encrypted input pdfs")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input pdf")
+	}
+
+	inputs := make([]string, fs.NArg())
+	for i, arg := range fs.Args() {
+		path, cleanup, err := inputPath(arg)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		inputs[i] = path
+	}
+
+	opts := core.MergeOptions{Native: *native, KeepFieldNames: *keepNames, Password: *password}
+	return writeOutput(*out, func(dest string) error {
+		return core.MergeFiles(context.Background(), inputs, dest, opts)
+	})
+}
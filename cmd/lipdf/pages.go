@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf cat -pages "1-3 5 7-end" [-o out.pdf] in.pdf
+func runCat(args []string) error {
+	fs := newFlagSet("cat", "in.pdf")
+	pages := fs.String("pages", "", "pages to keep in order, such as \"1-3 5 7-end\"")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ranges, err := core.ParsePageRanges(*pages)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.SelectPages(context.Background(), pdfPath, dest, ranges, "")
+	})
+}
+
+// lipdf rotate -rotation east [-pages 1-3] [-o out.pdf] in.pdf
+func runRotate(args []string) error {
+	fs := newFlagSet("rotate", "in.pdf")
+	rotation := fs.String("rotation", "", "north, east, south or west, or left, right or down relative to the current orientation")
+	pages := fs.String("pages", "", "pages to rotate, such as \"1-3 5\" (default all)")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(*rotation) == 0 {
+		return fmt.Errorf("missing -rotation")
+	}
+
+	var ranges []core.PageRange
+	if len(*pages) > 0 {
+		ranges, err = core.ParsePageRanges(*pages)
+		if err != nil {
+			return err
+		}
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.RotatePages(context.Background(), pdfPath, dest, ranges, core.Rotation(*rotation), "")
+	})
+}
+
+// lipdf burst [-out dir] in.pdf
+func runBurst(args []string) error {
+	fs := newFlagSet("burst", "in.pdf")
+	outDir := fs.String("out", ".", "directory for the page files")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	paths, err := core.BurstPages(context.Background(), pdfPath, *outDir, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+	return nil
+}
+
+// lipdf preview [-pages 1-3] [-dpi 96] [-renderer auto|pdftoppm|gs] [-out dir] in.pdf
+func runPreview(args []string) error {
+	fs := newFlagSet("preview", "in.pdf")
+	pages := fs.String("pages", "1", "pages to render, such as \"1-3 5\" or \"1-end\"")
+	dpi := fs.Int("dpi", core.DefaultDPI, "resolution of the images")
+	renderer := fs.String("renderer", "auto", "tool rendering the pages: auto, pdftoppm or gs")
+	outDir := fs.String("out", ".", "directory for the page images")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var r core.Renderer
+	switch *renderer {
+	case "auto":
+		r = core.DefaultRenderer
+	case "pdftoppm":
+		r = core.Pdftoppm
+	case "gs":
+		r = core.Ghostscript
+	default:
+		return fmt.Errorf("unknown renderer %q", *renderer)
+	}
+	ranges, err := core.ParsePageRanges(*pages)
+	if err != nil {
+		return err
+	}
+	rendered, err := core.RenderPages(context.Background(), r, pdfPath, ranges, *dpi)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(*outDir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, p := range rendered {
+		path := filepath.Join(*outDir, fmt.Sprintf("page_%04d.png", p.Page))
+		err = ioutil.WriteFile(path, p.PNG, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/sunlidea/lipdf/server"
+)
+
+// lipdf serve [-addr :8080] [-dir templates]
+func runServe(args []string) error {
+	fs := newFlagSet("serve", "")
+	addr := fs.String("addr", ":8080", "listen address")
+	cfg := server.Config{}
+	fs.StringVar(&cfg.Dir, "dir", "templates", "template directory")
+	fs.Int64Var(&cfg.MaxTemplateSize, "max-template-size", 32<<20, "maximum size of an uploaded template in bytes")
+	fs.Int64Var(&cfg.MaxDataSize, "max-data-size", 1<<20, "maximum size of fill data in bytes")
+	fs.DurationVar(&cfg.Timeout, "timeout", 0, "per request timeout (default 60s)")
+	fs.IntVar(&cfg.MaxConcurrent, "concurrency", 0, "maximum concurrent pdftk processes (default number of CPUs)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		return err
+	}
+	log.Printf("lipdf: serving templates of %s on %s", cfg.Dir, *addr)
+	return http.ListenAndServe(*addr, srv)
+}
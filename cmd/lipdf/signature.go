@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf signatures [-o file] in.pdf
+func runSignatures(args []string) error {
+	fs := newFlagSet("signatures", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	sigs, err := core.ReadSignatures(pdfPath)
+	if err != nil {
+		return err
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, sigs)
+	})
+}
+
+// lipdf sign -cert org.p12 [-cert-pw pw] [-field name] [-page n] [-rect x1,y1,x2,y2] [-reason text] [-location text] [-o out.pdf] in.pdf
+func runSign(args []string) error {
+	fs := newFlagSet("sign", "in.pdf")
+	certPath := fs.String("cert", "", "PKCS#12 file (.p12, .pfx), or PEM file with the key and certificates")
+	certPassword := fs.String("cert-pw", "", "password of the PKCS#12 file")
+	field := fs.String("field", "", "signature field to sign, created if missing (default the first empty one)")
+	page := fs.Int("page", 1, "page of a created field")
+	rect := fs.String("rect", "", "rectangle x1,y1,x2,y2 of a created field in points (default invisible)")
+	reason := fs.String("reason", "", "reason for signing")
+	location := fs.String("location", "", "location of signing")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(*certPath) == 0 {
+		return fmt.Errorf("missing -cert")
+	}
+
+	data, err := ioutil.ReadFile(*certPath)
+	if err != nil {
+		return err
+	}
+	var signer *core.Signer
+	switch strings.ToLower(filepath.Ext(*certPath)) {
+	case ".p12", ".pfx":
+		signer, err = core.LoadPKCS12(data, *certPassword)
+	default:
+		signer, err = core.LoadPEM(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", *certPath, err)
+	}
+	opts := core.SignOptions{Field: *field, Page: *page, Reason: *reason, Location: *location}
+	if len(*rect) > 0 {
+		opts.Rect, err = parseRect(*rect)
+		if err != nil {
+			return fmt.Errorf("invalid -rect %q", *rect)
+		}
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.SignPDF(pdfPath, dest, signer, opts)
+	})
+}
+
+// lipdf verify [-roots ca.pem] [-o file] in.pdf
+func runVerify(args []string) error {
+	fs := newFlagSet("verify", "in.pdf")
+	rootsPath := fs.String("roots", "", "PEM file of trusted root certificates (default the system roots)")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var roots *x509.CertPool
+	if len(*rootsPath) > 0 {
+		data, err := ioutil.ReadFile(*rootsPath)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate in %s", *rootsPath)
+		}
+	}
+	statuses, err := core.VerifySignatures(pdfPath, roots)
+	if err != nil {
+		return err
+	}
+	err = create(*out, func(w io.Writer) error {
+		return writeJSON(w, statuses)
+	})
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if !st.Intact {
+			return fmt.Errorf("signature %s is not intact", st.Field)
+		}
+	}
+	return nil
+}
+
+// parseRect parses a rectangle x1,y1,x2,y2
+func parseRect(s string) ([4]float64, error) {
+	var r [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return r, fmt.Errorf("expected x1,y1,x2,y2")
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return r, err
+		}
+		r[i] = v
+	}
+	return r, nil
+}
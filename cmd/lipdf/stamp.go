@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf stamp -overlay letterhead.pdf [-background] [-multi] [-o out.pdf] in.pdf
+func runStamp(args []string) error {
+	fs := newFlagSet("stamp", "in.pdf")
+	overlayPath := fs.String("overlay", "", "pdf to put over the pages")
+	background := fs.Bool("background", false, "put the overlay under the pages instead")
+	multi := fs.Bool("multi", false, "apply overlay page n to page n instead of the first overlay page to all pages")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if len(*overlayPath) == 0 {
+		return fmt.Errorf("missing -overlay")
+	}
+
+	overlay := core.Stamp
+	switch {
+	case *background && *multi:
+		overlay = core.MultiBackground
+	case *background:
+		overlay = core.Background
+	case *multi:
+		overlay = core.MultiStamp
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.OverlayPDF(context.Background(), pdfPath, *overlayPath, dest, overlay)
+	})
+}
+
+// lipdf watermark -text "DRAFT" [-size 48] [-opacity 0.3] [-angle 45] [-o out.pdf] in.pdf
+func runWatermark(args []string) error {
+	fs := newFlagSet("watermark", "in.pdf")
+	text := fs.String("text", "", "watermark text, \"\\n\" starts a new line")
+	size := fs.Float64("size", 48, "font size in points")
+	opacity := fs.Float64("opacity", 0.3, "opacity from 0 to 1")
+	angle := fs.Float64("angle", 45, "counterclockwise rotation in degrees")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	w := core.Watermark{
+		Text:     strings.Replace(*text, `\n`, "\n", -1),
+		FontSize: *size,
+		Opacity:  *opacity,
+		Angle:    *angle,
+	}
+	return writeOutput(*out, func(dest string) error {
+		return core.AddWatermark(context.Background(), pdfPath, dest, w)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// lipdf xfa [-o file] in.pdf
+func runXFA(args []string) error {
+	fs := newFlagSet("xfa", "in.pdf")
+	out := fs.String("o", "", "output file (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	xfa, err := core.ReadXFA(pdfPath)
+	if err != nil {
+		return err
+	}
+	return create(*out, func(w io.Writer) error {
+		return writeJSON(w, xfa)
+	})
+}
+
+// lipdf dropxfa [-o out.pdf] in.pdf
+func runDropXFA(args []string) error {
+	fs := newFlagSet("dropxfa", "in.pdf")
+	out := fs.String("o", "", "output pdf (default stdout)")
+	pdfPath, cleanup, err := parsePdfArg(fs, args)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return writeOutput(*out, func(dest string) error {
+		return core.DropXFA(context.Background(), pdfPath, dest)
+	})
+}
@@ -0,0 +1,432 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attachment is a file embedded in a pdf
+type Attachment struct {
+	// Name is the file name shown by the viewer
+	Name        string
+	Description string
+	// MIMEType such as "application/json", optional
+	MIMEType string
+	Data     []byte
+	// Page the attachment is pinned to as an annotation, counted from 1,
+	// 0 for an attachment of the whole document
+	Page int
+}
+
+// AttachFiles embeds the files at paths into the pdf at pdfPath and writes
+// the result to destPath. The files are attached to the document, or shown
+// as annotations on page when it is not 0.
+func AttachFiles(ctx context.Context, pdfPath, destPath string, paths []string, page int) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no file to attach")
+	}
+	// pdftk form.pdf attach_files data.json to_page 1 output form.data.pdf
+	args := []string{"attach_files"}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("filepath abs fail|%v|%s", err, p)
+		}
+		args = append(args, abs)
+	}
+	if page > 0 {
+		args = append(args, "to_page", fmt.Sprint(page))
+	}
+	return generateCore(ctx, pdfPath, destPath, args, nil)
+}
+
+// UnpackFiles writes the document and page attachments of the pdf at
+// pdfPath to destDir and returns their paths
+func UnpackFiles(ctx context.Context, pdfPath, destDir string) ([]string, error) {
+	pdfPath, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	e, err := Exists(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("check pdf file Exists fail: %v", err)
+	} else if !e {
+		return nil, fmt.Errorf("pdf file does not Exists: '%s'", pdfPath)
+	}
+
+	// unpack into an empty directory to tell the attachments apart
+	tmpDir, err := ioutil.TempDir("", "unpack-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary directory fail: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	// pdftk form.pdf unpack_files output dir/
+	err = runPdftk(ctx, tmpDir, "", 1, pdfPath, "unpack_files", "output", tmpDir+string(filepath.Separator))
+	if err != nil {
+		return nil, fmt.Errorf("pdftk exec fail: %w", err)
+	}
+	files, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		dest := filepath.Join(destDir, f.Name())
+		err = copyFile(filepath.Join(tmpDir, f.Name()), dest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy attachment to destination: %v", err)
+		}
+		paths = append(paths, dest)
+	}
+	return paths, nil
+}
+
+// AttachFilesNative is AttachFiles without pdftk. The attachments are
+// appended to the file as an incremental update.
+func AttachFilesNative(pdfPath, destPath string, attachments []Attachment) error {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	err = doc.attach(u, attachments)
+	if err != nil {
+		return err
+	}
+	return u.writeFile(destPath, nil)
+}
+
+// attach adds the attachments to the update, document attachments of the
+// same name are replaced
+func (doc *pdfDocument) attach(u *pdfUpdate, attachments []Attachment) error {
+	if len(attachments) == 0 {
+		return fmt.Errorf("no file to attach")
+	}
+	var pages []pdfPage
+	docFiles := make(map[string]interface{})
+	// annotations added per page
+	pinned := make(map[int]int)
+	for _, a := range attachments {
+		if len(a.Name) == 0 {
+			return fmt.Errorf("attachment without name")
+		}
+		spec := u.add(doc.fileSpec(u, a))
+		if a.Page == 0 {
+			docFiles[a.Name] = spec
+			continue
+		}
+
+		if pages == nil {
+			var err error
+			pages, err = doc.pages()
+			if err != nil {
+				return err
+			}
+		}
+		if a.Page < 0 || a.Page > len(pages) {
+			return fmt.Errorf("attachment %s: no page %d", a.Name, a.Page)
+		}
+		p := pages[a.Page-1]
+		// paperclips stacked down from the upper left corner
+		var box [4]float64
+		for i, v := range doc.array(p.dict["MediaBox"]) {
+			if i < 4 {
+				box[i] = pdfFloat(doc.resolve(v))
+			}
+		}
+		x, y := box[0]+12, box[3]-12-float64(pinned[a.Page])*24
+		pinned[a.Page]++
+		desc := a.Description
+		if len(desc) == 0 {
+			desc = a.Name
+		}
+		annot := u.add(pdfDict{
+			"Type":     pdfName("Annot"),
+			"Subtype":  pdfName("FileAttachment"),
+			"Rect":     pdfArray{x, y - 20, x + 14, y},
+			"FS":       spec,
+			"Contents": encodeTextString(desc),
+			"Name":     pdfName("Paperclip"),
+			"P":        p.ref,
+		})
+
+		page := pdfDict{}
+		for k, v := range doc.dict(p.ref) {
+			page[k] = v
+		}
+		annots := append(pdfArray{}, doc.array(page["Annots"])...)
+		page["Annots"] = append(annots, annot)
+		u.set(p.ref.num, page)
+	}
+	if len(docFiles) == 0 {
+		return nil
+	}
+
+	// a new flat name tree with the existing and added files
+	catalog := pdfDict{}
+	for k, v := range doc.catalog() {
+		catalog[k] = v
+	}
+	names := pdfDict{}
+	for k, v := range doc.dict(catalog["Names"]) {
+		names[k] = v
+	}
+	for _, e := range doc.nameTreeEntries(names["EmbeddedFiles"]) {
+		if _, ok := docFiles[decodeTextString(e.key)]; !ok {
+			docFiles[decodeTextString(e.key)] = e.value
+		}
+	}
+	keys := make([]string, 0, len(docFiles))
+	for k := range docFiles {
+		keys = append(keys, k)
+	}
+	// name trees are sorted by the encoded key
+	sort.Slice(keys, func(i, j int) bool { return encodeTextString(keys[i]) < encodeTextString(keys[j]) })
+	var entries pdfArray
+	for _, k := range keys {
+		entries = append(entries, encodeTextString(k), docFiles[k])
+	}
+	names["EmbeddedFiles"] = u.add(pdfDict{"Names": entries})
+	catalog["Names"] = names
+
+	root, ok := doc.trailer["Root"].(pdfRef)
+	if !ok {
+		return fmt.Errorf("document catalog is not a reference")
+	}
+	u.set(root.num, catalog)
+	return nil
+}
+
+// fileSpec returns the file specification of a, the embedded file stream
+// is added to the update
+func (doc *pdfDocument) fileSpec(u *pdfUpdate, a Attachment) pdfDict {
+	sum := md5.Sum(a.Data)
+	params := pdfDict{
+		"Size":     int64(len(a.Data)),
+		"ModDate":  pdfString(pdfDate(time.Now())),
+		"CheckSum": pdfString(sum[:]),
+	}
+	file := pdfDict{
+		"Type":   pdfName("EmbeddedFile"),
+		"Params": params,
+	}
+	if len(a.MIMEType) > 0 {
+		file["Subtype"] = pdfName(a.MIMEType)
+	}
+	ef := u.add(flateStream(file, a.Data))
+
+	spec := pdfDict{
+		"Type": pdfName("Filespec"),
+		"F":    pdfString(winAnsiString(a.Name)),
+		"UF":   encodeTextString(a.Name),
+		"EF":   pdfDict{"F": ef, "UF": ef},
+	}
+	if len(a.Description) > 0 {
+		spec["Desc"] = encodeTextString(a.Description)
+	}
+	return spec
+}
+
+// pdfDate formats t as a pdf date, such as D:20190102150405+08'00'
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("D:%s%c%02d'%02d'", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+// ReadAttachments returns the document and page attachments of the pdf at
+// pdfPath
+func ReadAttachments(pdfPath string) ([]Attachment, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	names := doc.dict(doc.catalog()["Names"])
+	for _, e := range doc.nameTreeEntries(names["EmbeddedFiles"]) {
+		a, err := doc.readFileSpec(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %v", decodeTextString(e.key), err)
+		}
+		if len(a.Name) == 0 {
+			a.Name = decodeTextString(e.key)
+		}
+		attachments = append(attachments, a)
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range pages {
+		for _, v := range doc.array(p.dict["Annots"]) {
+			annot := doc.dict(v)
+			if annot["Subtype"] != pdfName("FileAttachment") {
+				continue
+			}
+			a, err := doc.readFileSpec(annot["FS"])
+			if err != nil {
+				return nil, fmt.Errorf("attachment on page %d: %v", i+1, err)
+			}
+			a.Page = i + 1
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+// readFileSpec reads the embedded file of a file specification
+func (doc *pdfDocument) readFileSpec(v interface{}) (Attachment, error) {
+	var a Attachment
+	spec := doc.dict(v)
+	if spec == nil {
+		return a, fmt.Errorf("file specification not found")
+	}
+	for _, k := range []pdfName{"UF", "F"} {
+		if s, ok := doc.resolve(spec[k]).(pdfString); ok && len(s) > 0 {
+			a.Name = decodeTextString(s)
+			break
+		}
+	}
+	if s, ok := doc.resolve(spec["Desc"]).(pdfString); ok {
+		a.Description = decodeTextString(s)
+	}
+
+	ef := doc.dict(spec["EF"])
+	stream, ok := doc.resolve(ef["UF"]).(pdfStream)
+	if !ok {
+		stream, ok = doc.resolve(ef["F"]).(pdfStream)
+	}
+	if !ok {
+		return a, fmt.Errorf("embedded file not found")
+	}
+	if t, ok := doc.resolve(stream.dict["Subtype"]).(pdfName); ok {
+		a.MIMEType = string(t)
+	}
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return a, err
+	}
+	a.Data = data
+	return a, nil
+}
+
+// UnpackFilesNative is UnpackFiles without pdftk
+func UnpackFilesNative(pdfPath, destDir string) ([]string, error) {
+	attachments, err := ReadAttachments(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, a := range attachments {
+		// names may contain a path, only the base is used
+		name := filepath.Base(filepath.FromSlash(strings.Replace(a.Name, `\`, "/", -1)))
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			continue
+		}
+		dest := filepath.Join(destDir, name)
+		err = ioutil.WriteFile(dest, a.Data, 0644)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, dest)
+	}
+	return paths, nil
+}
+
+// nameTreeEntry is a key and value of a name tree
+type nameTreeEntry struct {
+	key   pdfString
+	value interface{}
+}
+
+// nameTreeEntries returns all entries of a name tree in tree order
+func (doc *pdfDocument) nameTreeEntries(node interface{}) []nameTreeEntry {
+	var entries []nameTreeEntry
+	seen := make(map[int]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if ref, ok := v.(pdfRef); ok {
+			if seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+		}
+		n := doc.dict(v)
+		names := doc.array(n["Names"])
+		for i := 0; i+1 < len(names); i += 2 {
+			if k, ok := doc.resolve(names[i]).(pdfString); ok {
+				entries = append(entries, nameTreeEntry{key: k, value: names[i+1]})
+			}
+		}
+		for _, kid := range doc.array(n["Kids"]) {
+			walk(kid)
+		}
+	}
+	walk(node)
+	return entries
+}
+
+// attachment formats of the fill data, see FillOptions.AttachData
+var dataAttachments = map[string]struct {
+	name     string
+	mimeType string
+}{
+	"json": {"data.json", "application/json"},
+	"fdf":  {"data.fdf", "application/vnd.fdf"},
+	"xfdf": {"data.xfdf", "application/vnd.adobe.xfdf"},
+}
+
+// dataAttachment encodes the data of a fill as an attachment
+func dataAttachment(form map[string]interface{}, format string) (Attachment, error) {
+	f, ok := dataAttachments[format]
+	if !ok {
+		return Attachment{}, fmt.Errorf("unknown data format %q", format)
+	}
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(form)
+	case "fdf":
+		err = WriteFDF(&buf, form)
+	case "xfdf":
+		err = WriteXFDF(&buf, form)
+	}
+	if err != nil {
+		return Attachment{}, fmt.Errorf("fail to encode %s data: %v", format, err)
+	}
+	return Attachment{
+		Name:        f.name,
+		Description: "form data of the fill",
+		MIMEType:    f.mimeType,
+		Data:        buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachFilesNative(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.pdf")
+	err := AttachFilesNative("../file/1022.pdf", first, []Attachment{
+		{Name: "data.json", MIMEType: "application/json", Data: []byte(`{"ap.name fam": "Lee"}`)},
+		{Name: "passport.txt", Description: "Passport – scan", Data: []byte("P<AUS"), Page: 1},
+	})
+	if err != nil {
+		t.Fatalf("AttachFilesNative:%v", err)
+	}
+	// a second update replaces data.json and keeps the other attachments
+	second := filepath.Join(dir, "second.pdf")
+	err = AttachFilesNative(first, second, []Attachment{
+		{Name: "data.json", Data: []byte(`{}`)},
+		{Name: "ünïcode.txt", Data: []byte("x")},
+	})
+	if err != nil {
+		t.Fatalf("AttachFilesNative:%v", err)
+	}
+
+	attachments, err := ReadAttachments(second)
+	if err != nil {
+		t.Fatalf("ReadAttachments:%v", err)
+	}
+	got := make(map[string]Attachment)
+	for _, a := range attachments {
+		got[a.Name] = a
+	}
+	if len(attachments) != 3 {
+		t.Fatalf("ReadAttachments = %d attachments, want 3", len(attachments))
+	}
+	if a := got["data.json"]; string(a.Data) != "{}" || a.Page != 0 {
+		t.Errorf("data.json = %+v", a)
+	}
+	if a := got["passport.txt"]; string(a.Data) != "P<AUS" || a.Page != 1 || a.Description != "Passport – scan" {
+		t.Errorf("passport.txt = %+v", a)
+	}
+	if a := got["ünïcode.txt"]; string(a.Data) != "x" {
+		t.Errorf("ünïcode.txt = %+v", a)
+	}
+
+	first2, err := ReadAttachments(first)
+	if err != nil {
+		t.Fatalf("ReadAttachments:%v", err)
+	}
+	for _, a := range first2 {
+		if a.Name == "data.json" && a.MIMEType != "application/json" {
+			t.Errorf("MIMEType = %q", a.MIMEType)
+		}
+	}
+
+	paths, err := UnpackFilesNative(second, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("UnpackFilesNative:%v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("UnpackFilesNative = %v", paths)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out", "passport.txt"))
+	if err != nil || string(data) != "P<AUS" {
+		t.Errorf("passport.txt = %q, %v", data, err)
+	}
+
+	if err = AttachFilesNative("../file/1022.pdf", second, []Attachment{{Name: "a", Page: 1000}}); err == nil {
+		t.Errorf("AttachFilesNative should fail on a missing page")
+	}
+}
+
+func TestFillOptionsUpdateOutput(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "filled.pdf")
+	err := copyFile("../file/1022.pdf", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := FillOptions{AttachData: "xfdf", Info: map[string]string{"CaseID": "A1"}}
+	err = opts.updateOutput(dest, map[string]interface{}{"ap.name fam": "Lee"})
+	if err != nil {
+		t.Fatalf("updateOutput:%v", err)
+	}
+	attachments, err := ReadAttachments(dest)
+	if err != nil {
+		t.Fatalf("ReadAttachments:%v", err)
+	}
+	if len(attachments) != 1 || attachments[0].Name != "data.xfdf" || !strings.Contains(string(attachments[0].Data), "Lee") {
+		t.Errorf("ReadAttachments = %+v", attachments)
+	}
+	meta, err := ReadMetadataNative(dest)
+	if err != nil {
+		t.Fatalf("ReadMetadataNative:%v", err)
+	}
+	if meta.Info["CaseID"] != "A1" {
+		t.Errorf("Info = %v", meta.Info)
+	}
+
+	opts = FillOptions{AttachData: "csv"}
+	if err = opts.validate(); err == nil {
+		t.Errorf("validate should fail on an unknown format")
+	}
+}
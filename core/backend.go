@@ -0,0 +1,21 @@
+package core
+
+import "context"
+
+// Backend performs the pdf operations behind a fill. The pdftk command line
+// tool is the default, other implementations can be plugged in wherever a
+// Backend is accepted.
+type Backend interface {
+	// FillForm fills form into the pdf at pdfPath and writes the result
+	// to destPath
+	FillForm(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts FillOptions) error
+}
+
+// Pdftk is the Backend running the pdftk utility
+var Pdftk Backend = pdftkBackend{}
+
+type pdftkBackend struct{}
+
+func (pdftkBackend) FillForm(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts FillOptions) error {
+	return FillFormFileContext(ctx, form, pdfPath, destPath, opts)
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Record is the form data of one document of a batch
+type Record struct {
+	// ID names the record in results, such as an applicant number
+	ID   string
+	Form map[string]interface{}
+	// Err is set by iterators for records that could not be read, they
+	// are reported as failed without a fill
+	Err error
+}
+
+// RecordIterator yields the records of a batch, Next returns io.EOF
+// after the last record
+type RecordIterator interface {
+	Next() (Record, error)
+}
+
+// SliceRecords iterates over records held in memory
+func SliceRecords(records []Record) RecordIterator {
+	return &sliceRecords{records: records}
+}
+
+type sliceRecords struct {
+	records []Record
+	next    int
+}
+
+func (s *sliceRecords) Next() (Record, error) {
+	if s.next >= len(s.records) {
+		return Record{}, io.EOF
+	}
+	r := s.records[s.next]
+	s.next++
+	return r, nil
+}
+
+// BatchOptions controls FillBatch
+type BatchOptions struct {
+	// Workers is the number of fills run at the same time, default the
+	// number of CPUs
+	Workers int
+	// Fill is applied to every record. When Fill.Info is set, the ID of
+	// the record is added to it as RecordID.
+	Fill FillOptions
+	// Validate checks every record against the template fields first,
+	// invalid records fail without being filled
+	Validate bool
+	// Backend performs the fills, default Pdftk
+	Backend Backend
+}
+
+// BatchResult is the outcome of one record
+type BatchResult struct {
+	// Index is the position of the record in the iterator
+	Index int
+	ID    string
+	// Err is the error of this record, the batch goes on regardless
+	Err error
+}
+
+// BatchFunc receives every record of a batch, pdf is the filled document
+// and is nil when res.Err is set. Calls are serialized in completion order.
+// Returning an error stops the batch.
+type BatchFunc func(res BatchResult, pdf io.Reader) error
+
+// BatchSummary counts the records of a finished batch
+type BatchSummary struct {
+	Total  int           `json:"Total"`
+	Failed int           `json:"Failed"`
+	Errors []BatchResult `json:"-"`
+}
+
+// FillBatch fills every record of records into the template on a bounded
+// pool of workers and passes each result to fn. Errors of a single record
+// are reported to fn and collected in the summary without aborting the
+// batch; the returned error is set only when the iterator or fn fail or
+// ctx is done.
+func FillBatch(ctx context.Context, t *Template, records RecordIterator, opts BatchOptions, fn BatchFunc) (BatchSummary, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.Backend == nil {
+		opts.Backend = Pdftk
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tmpDir, err := ioutil.TempDir("", "batch-")
+	if err != nil {
+		return BatchSummary{}, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	type job struct {
+		index  int
+		record Record
+	}
+	type done struct {
+		res  BatchResult
+		path string
+	}
+
+	jobs := make(chan job)
+	results := make(chan done)
+
+	// workers
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := BatchResult{Index: j.index, ID: j.record.ID}
+				path := filepath.Join(tmpDir, strconv.Itoa(j.index)+".pdf")
+				res.Err = fillRecord(ctx, t, j.record, path, opts)
+				select {
+				case results <- done{res: res, path: path}:
+				case <-ctx.Done():
+					os.Remove(path)
+				}
+			}
+		}()
+	}
+
+	// feed records until the iterator ends or the batch is stopped
+	iterErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			r, err := records.Next()
+			if err == io.EOF {
+				iterErr <- nil
+				return
+			}
+			if err != nil {
+				// records already queued are still filled and delivered
+				iterErr <- fmt.Errorf("fail to read record %d: %v", i, err)
+				return
+			}
+			select {
+			case jobs <- job{index: i, record: r}:
+			case <-ctx.Done():
+				iterErr <- nil
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var summary BatchSummary
+	var fnErr error
+loop:
+	for {
+		select {
+		case d, ok := <-results:
+			if !ok {
+				break loop
+			}
+			summary.Total++
+			if d.res.Err != nil {
+				summary.Failed++
+				summary.Errors = append(summary.Errors, d.res)
+			}
+			fnErr = deliverResult(fn, d.res, d.path)
+			if fnErr != nil {
+				cancel()
+				break loop
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	if ctx.Err() != nil {
+		// stopped, the feeder may still wait for the iterator, so the
+		// workers are drained without waiting for it
+		go func() {
+			for d := range results {
+				os.Remove(d.path)
+			}
+		}()
+		if fnErr != nil {
+			return summary, fnErr
+		}
+		return summary, ctx.Err()
+	}
+	return summary, <-iterErr
+}
+
+func fillRecord(ctx context.Context, t *Template, r Record, destPath string, opts BatchOptions) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	fill := opts.Fill
+	if fill.Info != nil && len(r.ID) > 0 {
+		fill.Info = make(map[string]string, len(opts.Fill.Info)+1)
+		for k, v := range opts.Fill.Info {
+			fill.Info[k] = v
+		}
+		fill.Info["RecordID"] = r.ID
+	}
+	form, err := t.prepareForm(r.Form, &fill)
+	if err != nil {
+		return err
+	}
+	if opts.Validate {
+		errs := t.Validate(form)
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid form data: %v", errs[0])
+		}
+	}
+	return t.fillWith(ctx, opts.Backend, form, destPath, fill)
+}
+
+// pass a result with the filled pdf to fn and remove the file
+func deliverResult(fn BatchFunc, res BatchResult, path string) error {
+	defer os.Remove(path)
+	if res.Err != nil {
+		return fn(res, nil)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		res.Err = err
+		return fn(res, nil)
+	}
+	defer f.Close()
+	return fn(res, f)
+}
+
+// WriterOutput returns a BatchFunc copying every filled pdf to the writer
+// returned by open for the record, failed records are skipped
+func WriterOutput(open func(res BatchResult) (io.WriteCloser, error)) BatchFunc {
+	return func(res BatchResult, pdf io.Reader) error {
+		if res.Err != nil {
+			return nil
+		}
+		w, err := open(res)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, pdf)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DirOutput returns a BatchFunc writing every filled pdf to dir, named after
+// the record ID or its index when the ID is empty. A name that is taken,
+// such as by a repeated ID or an earlier run, gets the index appended
+// instead of overwriting the existing file.
+func DirOutput(dir string) BatchFunc {
+	return WriterOutput(func(res BatchResult) (io.WriteCloser, error) {
+		name := unsafeFileChars.ReplaceAllString(res.ID, "_")
+		if len(name) == 0 || name == "." || name == ".." {
+			name = strconv.Itoa(res.Index)
+		}
+		base := name
+		for n := res.Index; ; n++ {
+			f, err := os.OpenFile(filepath.Join(dir, name+".pdf"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			if !os.IsExist(err) {
+				return f, err
+			}
+			name = base + "_" + strconv.Itoa(n)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// backend writing the form data as fdf instead of a pdf
+type fdfBackend struct {
+	running, max int32
+}
+
+func (b *fdfBackend) FillForm(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts FillOptions) error {
+	n := atomic.AddInt32(&b.running, 1)
+	defer atomic.AddInt32(&b.running, -1)
+	for {
+		m := atomic.LoadInt32(&b.max)
+		if n <= m || atomic.CompareAndSwapInt32(&b.max, m, n) {
+			break
+		}
+	}
+	if form["id"] == "bad" {
+		return fmt.Errorf("bad record")
+	}
+	return createFdfFile(form, destPath)
+}
+
+func TestFillBatch(t *testing.T) {
+	tmpl := &Template{Name: "test", path: "test.pdf"}
+	records := make([]Record, 20)
+	for i := range records {
+		id := strconv.Itoa(i)
+		if i == 7 {
+			id = "bad"
+		}
+		records[i] = Record{ID: id, Form: map[string]interface{}{"id": id}}
+	}
+
+	backend := &fdfBackend{}
+	seen := make(map[string]bool)
+	summary, err := FillBatch(context.Background(), tmpl, SliceRecords(records), BatchOptions{Workers: 3, Backend: backend},
+		func(res BatchResult, pdf io.Reader) error {
+			seen[res.ID] = true
+			if res.Err != nil {
+				return nil
+			}
+			form, err := ReadFDF(pdf)
+			if err != nil {
+				return err
+			}
+			if form["id"] != res.ID {
+				return fmt.Errorf("record %s got data of %v", res.ID, form["id"])
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("FillBatch:%v", err)
+	}
+	if summary.Total != 20 || summary.Failed != 1 || summary.Errors[0].ID != "bad" {
+		t.Fatalf("FillBatch: summary %+v", summary)
+	}
+	if len(seen) != 20 {
+		t.Fatalf("FillBatch: %d records delivered", len(seen))
+	}
+	if backend.max > 3 {
+		t.Fatalf("FillBatch: %d concurrent fills", backend.max)
+	}
+
+	// a failing callback stops the batch
+	_, err = FillBatch(context.Background(), tmpl, SliceRecords(records), BatchOptions{Workers: 2, Backend: backend},
+		func(res BatchResult, pdf io.Reader) error {
+			return fmt.Errorf("stop")
+		})
+	if err == nil || err.Error() != "stop" {
+		t.Fatalf("FillBatch: expected stop error, got %v", err)
+	}
+}
+
+// iterator returning records, then err after waiting for block if it is
+// set
+type failingRecords struct {
+	records []Record
+	block   chan struct{}
+	err     error
+}
+
+func (r *failingRecords) Next() (Record, error) {
+	if len(r.records) > 0 {
+		rec := r.records[0]
+		r.records = r.records[1:]
+		return rec, nil
+	}
+	if r.block != nil {
+		<-r.block
+	}
+	return Record{}, r.err
+}
+
+func TestFillBatchStop(t *testing.T) {
+	tmpl := &Template{Name: "test", path: "test.pdf"}
+	records := make([]Record, 5)
+	for i := range records {
+		records[i] = Record{ID: strconv.Itoa(i), Form: map[string]interface{}{"id": strconv.Itoa(i)}}
+	}
+
+	// records read before an iterator error are delivered
+	delivered := 0
+	summary, err := FillBatch(context.Background(), tmpl, &failingRecords{records: records, err: fmt.Errorf("broken")},
+		BatchOptions{Workers: 3, Backend: &fdfBackend{}},
+		func(res BatchResult, pdf io.Reader) error {
+			if res.Err == nil {
+				delivered++
+			}
+			return nil
+		})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("FillBatch error = %v, want the iterator error", err)
+	}
+	if summary.Total != 5 || delivered != 5 {
+		t.Errorf("FillBatch: summary %+v, %d delivered", summary, delivered)
+	}
+
+	// a failing callback returns while the iterator blocks
+	block := make(chan struct{})
+	defer close(block)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := FillBatch(context.Background(), tmpl, &failingRecords{records: records[:1], block: block, err: io.EOF},
+			BatchOptions{Workers: 1, Backend: &fdfBackend{}},
+			func(res BatchResult, pdf io.Reader) error {
+				return fmt.Errorf("stop")
+			})
+		errc <- err
+	}()
+	select {
+	case err = <-errc:
+		if err == nil || err.Error() != "stop" {
+			t.Errorf("FillBatch: expected stop error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("FillBatch did not return after the callback failed")
+	}
+}
+
+func TestDirOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch-test-")
+	if err != nil {
+		t.Fatalf("TempDir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpl := &Template{Name: "test", path: "test.pdf"}
+	records := []Record{{ID: "a/b", Form: map[string]interface{}{"id": "1"}}, {Form: map[string]interface{}{"id": "2"}}, {ID: "a b", Form: map[string]interface{}{"id": "3"}}}
+	_, err = FillBatch(context.Background(), tmpl, SliceRecords(records), BatchOptions{Backend: &fdfBackend{}, Workers: 1}, DirOutput(dir))
+	if err != nil {
+		t.Fatalf("FillBatch:%v", err)
+	}
+	// a_b is taken by the first record, the third one is not overwriting it
+	for _, name := range []string{"a_b.pdf", "1.pdf", "a_b_2.pdf"} {
+		if _, err := os.Stat(dir + "/" + name); err != nil {
+			t.Fatalf("DirOutput:%v", err)
+		}
+	}
+
+	// outputs of an earlier run are kept
+	_, err = FillBatch(context.Background(), tmpl, SliceRecords(records[:1]), BatchOptions{Backend: &fdfBackend{}, Workers: 1}, DirOutput(dir))
+	if err != nil {
+		t.Fatalf("FillBatch:%v", err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 4 {
+		t.Fatalf("DirOutput: %d files after the second run", len(files))
+	}
+	if _, err := os.Stat(dir + "/a_b_0.pdf"); err != nil {
+		t.Fatalf("DirOutput:%v", err)
+	}
+}
@@ -3,18 +3,21 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // Run the command in the specified Dir
 func execCmdInDir(ctx context.Context, dir, name string, args ...string) ([]byte, error) {
 	//output after cmd exec
-	var outputBuf bytes.Buffer
+	var outputBuf, errBuf bytes.Buffer
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = &outputBuf
+	cmd.Stderr = &errBuf
 	cmd.Dir = dir
 
 	//start
@@ -35,14 +38,71 @@ func execCmdInDir(ctx context.Context, dir, name string, args ...string) ([]byte
 		if err != nil {
 			return nil, err
 		}
-		return nil, fmt.Errorf("exec time out")
-	case <-done:
+		return nil, fmt.Errorf("exec time out: %v", ctx.Err())
+	case err = <-done:
 		//cmd exec finish
 	}
+	if err != nil {
+		return nil, &execError{err: err, stderr: strings.TrimSpace(errBuf.String())}
+	}
 
 	return outputBuf.Bytes(), nil
 }
 
+// execError is a command that exited with an error, stderr holds its
+// messages
+type execError struct {
+	err    error
+	stderr string
+}
+
+func (e *execError) Error() string {
+	if len(e.stderr) == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.err, e.stderr)
+}
+
+// ErrPasswordRequired is returned when an input pdf is encrypted and was
+// opened without its password or with a wrong one, see DecryptPDF and
+// FillOptions.Password
+var ErrPasswordRequired = errors.New("pdf password required or incorrect")
+
+// ErrNoPdftk is returned by the operations running pdftk when it is not
+// installed, the native operations work without it
+var ErrNoPdftk = errors.New("pdftk utility is not installed")
+
+// runPdftk runs pdftk in dir, inputs is the number of input pdfs at the
+// start of args that password opens, if set. pdftk needs the owner
+// password for most operations, the user password is enough to read fields
+// and values.
+func runPdftk(ctx context.Context, dir string, password string, inputs int, args ...string) error {
+	if _, err := exec.LookPath("pdftk"); err != nil {
+		return ErrNoPdftk
+	}
+	if len(password) > 0 {
+		// pdftk in.pdf input_pw secret ...
+		withPw := make([]string, 0, len(args)+inputs+1)
+		withPw = append(withPw, args[:inputs]...)
+		withPw = append(withPw, "input_pw")
+		for i := 0; i < inputs; i++ {
+			withPw = append(withPw, password)
+		}
+		args = append(withPw, args[inputs:]...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdftkTimeout)
+	defer cancel()
+	_, err := execCmdInDir(ctx, dir, "pdftk", args...)
+	if e, ok := err.(*execError); ok && strings.Contains(e.stderr, "PASSWORD REQUIRED") {
+		// Error: Failed to open PDF file:
+		//    form.pdf
+		//    OWNER PASSWORD REQUIRED, but not given (or incorrect)
+		return ErrPasswordRequired
+	}
+	return err
+}
+
 // Exists returns whether the given file or directory Exists or not
 func Exists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// detached CMS signatures of RFC 5652, as embedded in signed pdfs
+
+// signCMS returns a detached CMS signature of content with a SHA-256
+// digest, the signing time and the certificates, the signing certificate
+// first
+func signCMS(content []byte, key crypto.Signer, certs []*x509.Certificate) ([]byte, error) {
+	sd, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	err = sd.AddSigner(certs[0], key, pkcs7.SignerInfoConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("fail to sign: %v", err)
+	}
+	for _, c := range certs[1:] {
+		sd.AddCertificate(c)
+	}
+	sd.Detach()
+	return sd.Finish()
+}
+
+type cmsSignature struct {
+	signer *x509.Certificate
+	certs  []*x509.Certificate
+	// signing time of the signed attributes, zero if absent
+	time time.Time
+}
+
+// verifyCMS checks that sig is a valid detached signature of content.
+// Trailing zeros of pdf signature placeholders are ignored.
+func verifyCMS(sig, content []byte) (*cmsSignature, error) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(sig, &raw); err != nil {
+		return nil, fmt.Errorf("invalid cms signature: %v", err)
+	}
+	p7, err := pkcs7.Parse(raw.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cms signature: %v", err)
+	}
+	if len(p7.Signers) != 1 {
+		return nil, fmt.Errorf("cms signature has %d signers", len(p7.Signers))
+	}
+	result := &cmsSignature{signer: p7.GetOnlySigner(), certs: p7.Certificates}
+	if result.signer == nil {
+		return nil, fmt.Errorf("signing certificate is missing")
+	}
+	p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &result.time)
+
+	p7.Content = content
+	err = p7.Verify()
+	if _, ok := err.(*pkcs7.MessageDigestMismatchError); ok {
+		return result, fmt.Errorf("document digest does not match, the signed bytes were modified")
+	}
+	if err != nil {
+		return result, fmt.Errorf("invalid signature: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVMapping maps the columns of a csv export to form fields, loaded from a
+// json file such as
+//
+//	{
+//	  "id": "Applicant No",
+//	  "fields": {
+//	    "ap.name fam": {"column": "Surname", "transform": ["trim", "upper"]},
+//	    "ap.name giv": "Given Names",
+//	    "ap.dob": {"column": "Birth Date", "parseDate": "2006-01-02", "formatDate": "02/01/2006"},
+//	    "ap.resi str": {"columns": ["Street", "Suburb"], "separator": ", "}
+//	  }
+//	}
+//
+// A plain string maps a single column without transforms.
+type CSVMapping struct {
+	// ID is the column naming the records, default the line number of the
+	// row. Rows repeating an ID are reported as failed.
+	ID     string                   `json:"id,omitempty"`
+	Fields map[string]ColumnMapping `json:"fields"`
+}
+
+// ColumnMapping computes the value of one field from the columns of a row
+type ColumnMapping struct {
+	// Column is copied to the field
+	Column string `json:"column,omitempty"`
+	// Columns are concatenated with Separator, default " ", empty
+	// columns are skipped
+	Columns   []string `json:"columns,omitempty"`
+	Separator string   `json:"separator,omitempty"`
+	// Value is a constant written when no column is set
+	Value string `json:"value,omitempty"`
+	// Transform is applied in order: trim, upper, lower or title
+	Transform []string `json:"transform,omitempty"`
+	// ParseDate is the layout of a date column, which is written with the
+	// FormatDate layout
+	ParseDate  string `json:"parseDate,omitempty"`
+	FormatDate string `json:"formatDate,omitempty"`
+}
+
+// UnmarshalJSON accepts a column name as shorthand
+func (c *ColumnMapping) UnmarshalJSON(data []byte) error {
+	var column string
+	if err := json.Unmarshal(data, &column); err == nil {
+		*c = ColumnMapping{Column: column}
+		return nil
+	}
+	type plain ColumnMapping
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// LoadCSVMapping reads a mapping file, yaml when the extension is .yaml or
+// .yml, json otherwise
+func LoadCSVMapping(path string) (*CSVMapping, error) {
+	var m CSVMapping
+	err := loadConfig(path, &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, m.check()
+}
+
+func (m *CSVMapping) check() error {
+	for field, c := range m.Fields {
+		if err := checkConversion(c.Transform, c.ParseDate, c.FormatDate); err != nil {
+			return fmt.Errorf("field %s: %v", field, err)
+		}
+	}
+	return nil
+}
+
+var columnTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": titleCase,
+}
+
+// checkConversion checks the transforms and date layouts of a mapping
+func checkConversion(transform []string, parseDate, formatDate string) error {
+	for _, t := range transform {
+		if _, ok := columnTransforms[t]; !ok {
+			return fmt.Errorf("unknown transform %q", t)
+		}
+	}
+	if len(formatDate) > 0 && len(parseDate) == 0 {
+		return errors.New("formatDate needs parseDate")
+	}
+	return nil
+}
+
+// convertValue applies the transforms in order, then parses a non-blank
+// value with the parseDate layout and writes it with formatDate
+func convertValue(value string, transform []string, parseDate, formatDate string) (string, error) {
+	for _, t := range transform {
+		value = columnTransforms[t](value)
+	}
+	if len(parseDate) == 0 || len(strings.TrimSpace(value)) == 0 {
+		return value, nil
+	}
+	d, err := time.Parse(parseDate, strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+	if len(formatDate) == 0 {
+		formatDate = defaultTimeFormat
+	}
+	return d.Format(formatDate), nil
+}
+
+// upper case the first letter of every word
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = []rune(strings.ToUpper(string(r[0])))[0]
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+// CSVOptions controls NewCSVRecords
+type CSVOptions struct {
+	// Comma is the field delimiter, default ','. Use '\t' for tsv.
+	Comma rune
+	// Mapping translates columns to fields, without a mapping the header
+	// names are used as field names
+	Mapping *CSVMapping
+}
+
+// NewCSVRecords iterates over the rows of a csv or tsv export with a header
+// line. Rows that cannot be mapped, such as a malformed date, are returned as
+// records with Err set so that a batch reports them without stopping.
+func NewCSVRecords(r io.Reader, opts CSVOptions) (RecordIterator, error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read csv header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		header[i] = h
+		columns[h] = i
+	}
+
+	mapping := opts.Mapping
+	if mapping == nil {
+		mapping = &CSVMapping{Fields: make(map[string]ColumnMapping, len(header))}
+		for _, h := range header {
+			mapping.Fields[h] = ColumnMapping{Column: h}
+		}
+	}
+	err = mapping.check()
+	if err != nil {
+		return nil, err
+	}
+
+	// all referenced columns must exist
+	if len(mapping.ID) > 0 {
+		if _, ok := columns[mapping.ID]; !ok {
+			return nil, fmt.Errorf("id column %q not found in header", mapping.ID)
+		}
+	}
+	for field, c := range mapping.Fields {
+		for _, col := range c.columns() {
+			if _, ok := columns[col]; !ok {
+				return nil, fmt.Errorf("field %s: column %q not found in header", field, col)
+			}
+		}
+	}
+
+	return &csvRecords{reader: cr, columns: columns, mapping: mapping, ids: make(map[string]int)}, nil
+}
+
+type csvRecords struct {
+	reader  *csv.Reader
+	columns map[string]int
+	mapping *CSVMapping
+	// line of the first row of every ID
+	ids map[string]int
+}
+
+func (c *csvRecords) Next() (Record, error) {
+	row, err := c.reader.Read()
+	if err == io.EOF {
+		return Record{}, io.EOF
+	}
+	if err != nil {
+		if e, ok := err.(*csv.ParseError); ok {
+			return Record{ID: strconv.Itoa(e.StartLine), Err: err}, nil
+		}
+		return Record{}, err
+	}
+	// rows are numbered by the line they start on, the header is line 1
+	line, _ := c.reader.FieldPos(0)
+
+	cell := func(col string) string {
+		i := c.columns[col]
+		if i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	r := Record{ID: strconv.Itoa(line), Form: make(map[string]interface{}, len(c.mapping.Fields))}
+	if len(c.mapping.ID) > 0 {
+		r.ID = cell(c.mapping.ID)
+		if first, ok := c.ids[r.ID]; ok && len(r.ID) > 0 {
+			// the outputs of both rows would be named after the ID
+			r.Err = fmt.Errorf("line %d: id %q repeats line %d", line, r.ID, first)
+			return r, nil
+		}
+		c.ids[r.ID] = line
+	}
+	for _, field := range sortedMappingFields(c.mapping.Fields) {
+		value, err := c.mapping.Fields[field].value(cell)
+		if err != nil {
+			r.Err = fmt.Errorf("line %d field %s: %v", line, field, err)
+			return r, nil
+		}
+		r.Form[field] = value
+	}
+	return r, nil
+}
+
+// columns read by the mapping
+func (c ColumnMapping) columns() []string {
+	if len(c.Column) > 0 {
+		return append([]string{c.Column}, c.Columns...)
+	}
+	return c.Columns
+}
+
+func (c ColumnMapping) value(cell func(string) string) (string, error) {
+	var value string
+	switch {
+	case len(c.Column) > 0:
+		value = cell(c.Column)
+	case len(c.Columns) > 0:
+		sep := c.Separator
+		if len(sep) == 0 {
+			sep = " "
+		}
+		parts := make([]string, 0, len(c.Columns))
+		for _, col := range c.Columns {
+			v := strings.TrimSpace(cell(col))
+			if len(v) > 0 {
+				parts = append(parts, v)
+			}
+		}
+		value = strings.Join(parts, sep)
+	default:
+		value = c.Value
+	}
+
+	return convertValue(value, c.Transform, c.ParseDate, c.FormatDate)
+}
+
+// mapping fields in a stable order, so the first error of a row is stable
+func sortedMappingFields(fields map[string]ColumnMapping) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCSVRecords(t *testing.T) {
+	data := "No\tSurname\tGiven\tBirth Date\tStreet\tSuburb\n" +
+		"A1\t smith \tjohn\t1980-03-07\t1 Main St\tSydney\n" +
+		"A2\tjones\tmary\t07/03/1980\t\tPerth\n"
+
+	var mapping CSVMapping
+	err := json.Unmarshal([]byte(`{
+		"id": "No",
+		"fields": {
+			"ap.name fam": {"column": "Surname", "transform": ["trim", "upper"]},
+			"ap.name giv": "Given",
+			"ap.dob": {"column": "Birth Date", "parseDate": "2006-01-02", "formatDate": "02/01/2006"},
+			"ap.resi str": {"columns": ["Street", "Suburb"], "separator": ", "},
+			"ap.cit": {"value": "Australia"}
+		}
+	}`), &mapping)
+	if err != nil {
+		t.Fatalf("Unmarshal:%v", err)
+	}
+
+	records, err := NewCSVRecords(strings.NewReader(data), CSVOptions{Comma: '\t', Mapping: &mapping})
+	if err != nil {
+		t.Fatalf("NewCSVRecords:%v", err)
+	}
+
+	r, err := records.Next()
+	if err != nil || r.Err != nil {
+		t.Fatalf("Next:%v %v", err, r.Err)
+	}
+	want := map[string]interface{}{
+		"ap.name fam": "SMITH",
+		"ap.name giv": "john",
+		"ap.dob":      "07/03/1980",
+		"ap.resi str": "1 Main St, Sydney",
+		"ap.cit":      "Australia",
+	}
+	if r.ID != "A1" {
+		t.Fatalf("Next: id %q", r.ID)
+	}
+	for k, v := range want {
+		if r.Form[k] != v {
+			t.Fatalf("Next: %s = %v, want %v", k, r.Form[k], v)
+		}
+	}
+
+	// malformed date fails the record only
+	r, err = records.Next()
+	if err != nil || r.Err == nil || r.ID != "A2" {
+		t.Fatalf("Next: expected record error, got %v %+v", err, r)
+	}
+	_, err = records.Next()
+	if err != io.EOF {
+		t.Fatalf("Next: expected EOF, got %v", err)
+	}
+
+	// unknown columns are reported up front
+	mapping.Fields["ap.email"] = ColumnMapping{Column: "Email"}
+	_, err = NewCSVRecords(strings.NewReader(data), CSVOptions{Comma: '\t', Mapping: &mapping})
+	if err == nil {
+		t.Fatalf("NewCSVRecords: expected missing column error")
+	}
+}
+
+func TestCSVRecordLines(t *testing.T) {
+	data := "No,Name\n" +
+		"A1,\"Li\nLei\"\n" +
+		"A2,Han\n" +
+		"A1,Lily\n"
+
+	mapping := CSVMapping{Fields: map[string]ColumnMapping{"ap.dob": {Column: "Name", ParseDate: "2006-01-02"}}}
+	records, err := NewCSVRecords(strings.NewReader(data), CSVOptions{Mapping: &mapping})
+	if err != nil {
+		t.Fatalf("NewCSVRecords:%v", err)
+	}
+	// rows are named and reported by the line they start on
+	for _, line := range []string{"2", "4", "5"} {
+		r, err := records.Next()
+		if err != nil || r.ID != line || r.Err == nil || !strings.HasPrefix(r.Err.Error(), "line "+line+" field ap.dob") {
+			t.Fatalf("Next = %+v, %v, want line %s", r, err, line)
+		}
+	}
+
+	mapping = CSVMapping{ID: "No", Fields: map[string]ColumnMapping{"ap.name": {Column: "Name"}}}
+	records, err = NewCSVRecords(strings.NewReader(data), CSVOptions{Mapping: &mapping})
+	if err != nil {
+		t.Fatalf("NewCSVRecords:%v", err)
+	}
+	for _, id := range []string{"A1", "A2"} {
+		if r, err := records.Next(); err != nil || r.ID != id || r.Err != nil {
+			t.Fatalf("Next = %+v, %v, want %s", r, err, id)
+		}
+	}
+	r, err := records.Next()
+	if err != nil || r.ID != "A1" || r.Err == nil || r.Err.Error() != `line 5: id "A1" repeats line 2` {
+		t.Fatalf("Next = %+v, %v, want a repeated id", r, err)
+	}
+}
@@ -0,0 +1,319 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TemplateDiff compares the fields of two revisions of a form, such as an
+// agency's new release of form 1022
+type TemplateDiff struct {
+	// Added are fields of the new revision only, Removed of the old one
+	Added   []Field `json:"Added"`
+	Removed []Field `json:"Removed"`
+	// Changed are fields of both revisions with different attributes
+	Changed []FieldChange `json:"Changed"`
+	// Renames pairs removed and added fields which are likely the same
+	// field renamed, best matches first
+	Renames []Rename `json:"Renames"`
+}
+
+// FieldChange is a field present in both revisions
+type FieldChange struct {
+	Field string `json:"Field"`
+	// Changes names the differing attributes: FieldType, FieldOptions,
+	// FieldFlags, FieldMaxLength and Widgets for moved or resized fields
+	Changes []string `json:"Changes"`
+	Old     Field    `json:"Old"`
+	New     Field    `json:"New"`
+}
+
+// Rename suggests that the field Old was renamed to New
+type Rename struct {
+	Old string `json:"Old"`
+	New string `json:"New"`
+	// Score from 0 to 1 combines the similarity of the names, the
+	// positions and the types
+	Score float64 `json:"Score"`
+}
+
+// minRenameScore is the score a removed and an added field need to be
+// suggested as a rename
+const minRenameScore = 0.6
+
+// widgets moving less than this many points are unchanged
+const widgetTolerance = 1.0
+
+// DiffTemplateFiles compares the fields of the pdfs at oldPath and newPath
+func DiffTemplateFiles(ctx context.Context, oldPath, newPath string) (*TemplateDiff, error) {
+	oldFields, err := pdfFormFields(ctx, oldPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("fail to read fields of %s: %w", oldPath, err)
+	}
+	newFields, err := pdfFormFields(ctx, newPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("fail to read fields of %s: %w", newPath, err)
+	}
+	return DiffFields(oldFields, newFields), nil
+}
+
+// DiffFields compares two field sets such as the results of Template.Fields
+func DiffFields(oldFields, newFields map[string]Field) *TemplateDiff {
+	d := &TemplateDiff{Added: []Field{}, Removed: []Field{}, Changed: []FieldChange{}, Renames: []Rename{}}
+	for _, name := range sortedFieldNames(oldFields) {
+		of := oldFields[name]
+		nf, ok := newFields[name]
+		if !ok {
+			d.Removed = append(d.Removed, of)
+			continue
+		}
+		if changes := fieldChanges(of, nf); len(changes) > 0 {
+			d.Changed = append(d.Changed, FieldChange{Field: name, Changes: changes, Old: of, New: nf})
+		}
+	}
+	for _, name := range sortedFieldNames(newFields) {
+		if _, ok := oldFields[name]; !ok {
+			d.Added = append(d.Added, newFields[name])
+		}
+	}
+
+	// greedy matching, the best scored pairs first
+	var candidates []Rename
+	for _, of := range d.Removed {
+		for _, nf := range d.Added {
+			if score := renameScore(of, nf); score >= minRenameScore {
+				candidates = append(candidates, Rename{Old: of.FieldName, New: nf.FieldName, Score: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	matched := make(map[string]bool)
+	for _, c := range candidates {
+		if matched["old:"+c.Old] || matched["new:"+c.New] {
+			continue
+		}
+		matched["old:"+c.Old], matched["new:"+c.New] = true, true
+		d.Renames = append(d.Renames, c)
+	}
+	return d
+}
+
+// SuggestRenames sets the Suggestion of mapping warnings, such as those of
+// checking a mapping against the new revision, whose field was renamed
+func (d *TemplateDiff) SuggestRenames(warnings []MappingWarning) []MappingWarning {
+	renames := make(map[string]string, len(d.Renames))
+	for _, r := range d.Renames {
+		renames[r.Old] = r.New
+	}
+	for i, w := range warnings {
+		warnings[i].Suggestion = renames[w.Field]
+	}
+	return warnings
+}
+
+func sortedFieldNames(fields map[string]Field) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fieldChanges lists the attributes differing between of and nf
+func fieldChanges(of, nf Field) []string {
+	var changes []string
+	if of.FieldType != nf.FieldType {
+		changes = append(changes, "FieldType")
+	}
+	if !reflect.DeepEqual(of.FieldOptions, nf.FieldOptions) {
+		changes = append(changes, "FieldOptions")
+	}
+	if of.FieldFlags != nf.FieldFlags {
+		changes = append(changes, "FieldFlags")
+	}
+	if of.FieldMaxLength != nf.FieldMaxLength {
+		changes = append(changes, "FieldMaxLength")
+	}
+	if !sameWidgets(of.Widgets, nf.Widgets) {
+		changes = append(changes, "Widgets")
+	}
+	return changes
+}
+
+func sameWidgets(a, b []Widget) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Page != b[i].Page {
+			return false
+		}
+		for j := range a[i].Rect {
+			if math.Abs(a[i].Rect[j]-b[i].Rect[j]) >= widgetTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// renameScore weighs the name similarity of two fields with the distance
+// of their first widgets, when both are known, and their types
+func renameScore(of, nf Field) float64 {
+	name := nameSimilarity(of.FieldName, nf.FieldName)
+	typ := 0.0
+	if of.FieldType == nf.FieldType {
+		typ = 1
+	}
+	if len(of.Widgets) == 0 || len(nf.Widgets) == 0 || of.Widgets[0].Page == 0 {
+		return 0.9*name + 0.1*typ
+	}
+	ow, nw := of.Widgets[0], nf.Widgets[0]
+	position := 0.0
+	if ow.Page == nw.Page {
+		// half an inch apart scores 0.5
+		dx := (ow.Rect[0]+ow.Rect[2])/2 - (nw.Rect[0]+nw.Rect[2])/2
+		dy := (ow.Rect[1]+ow.Rect[3])/2 - (nw.Rect[1]+nw.Rect[3])/2
+		position = 1 / (1 + math.Hypot(dx, dy)/36)
+	}
+	return 0.5*name + 0.4*position + 0.1*typ
+}
+
+// nameSimilarity is 1 minus the edit distance of the names relative to
+// the longer one, ignoring case, spaces and punctuation
+func nameSimilarity(a, b string) float64 {
+	ra, rb := normalizeFieldName(a), normalizeFieldName(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func normalizeFieldName(s string) []rune {
+	var r []rune
+	for _, c := range strings.ToLower(s) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// levenshtein returns the edit distance of a and b
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// ValueChange is a field whose value differs between two filled pdfs of
+// the same form. Old and New are strings, or []string for multi-select
+// fields.
+type ValueChange struct {
+	Field string      `json:"Field"`
+	Old   interface{} `json:"Old"`
+	New   interface{} `json:"New"`
+	// Added and Removed mark fields of the new or the old pdf only
+	Added   bool `json:"Added,omitempty"`
+	Removed bool `json:"Removed,omitempty"`
+}
+
+func (c ValueChange) String() string {
+	switch {
+	case c.Added:
+		return fmt.Sprintf("%s: added %q", c.Field, formValueString(c.New))
+	case c.Removed:
+		return fmt.Sprintf("%s: removed %q", c.Field, formValueString(c.Old))
+	}
+	return fmt.Sprintf("%s: %q -> %q", c.Field, formValueString(c.Old), formValueString(c.New))
+}
+
+// DiffValueFiles compares the values of the filled pdfs at oldPath and
+// newPath, see DiffValues
+func DiffValueFiles(ctx context.Context, oldPath, newPath string) ([]ValueChange, error) {
+	oldValues, err := FormValuesContext(ctx, oldPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("fail to read values of %s: %w", oldPath, err)
+	}
+	newValues, err := FormValuesContext(ctx, newPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("fail to read values of %s: %w", newPath, err)
+	}
+	return DiffValues(oldValues, newValues), nil
+}
+
+// DiffValues lists the fields whose values differ, ordered by field name,
+// such as the results of FormValues for two filled pdfs
+func DiffValues(oldValues, newValues map[string]interface{}) []ValueChange {
+	changes := []ValueChange{}
+	for _, k := range sortedKeys(oldValues) {
+		nv, ok := newValues[k]
+		if !ok {
+			changes = append(changes, ValueChange{Field: k, Old: oldValues[k], Removed: true})
+			continue
+		}
+		if !sameFormValue(oldValues[k], nv) {
+			changes = append(changes, ValueChange{Field: k, Old: oldValues[k], New: nv})
+		}
+	}
+	for _, k := range sortedKeys(newValues) {
+		if _, ok := oldValues[k]; !ok {
+			changes = append(changes, ValueChange{Field: k, New: newValues[k], Added: true})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// sameFormValue compares values as they are filled, a single value equals a
+// list of that value and an empty list equals an empty value
+func sameFormValue(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	al, _ := formValueList(a)
+	bl, _ := formValueList(b)
+	if len(al) == 0 {
+		al = []string{""}
+	}
+	if len(bl) == 0 {
+		bl = []string{""}
+	}
+	if len(al) != len(bl) {
+		return false
+	}
+	for i := range al {
+		if al[i] != bl[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	widget := func(page int, x, y float64) []Widget {
+		return []Widget{{Page: page, Rect: [4]float64{x, y, x + 100, y + 14}}}
+	}
+	oldFields := map[string]Field{
+		"ap.dob":            {FieldType: "Text", FieldName: "ap.dob", Widgets: widget(1, 100, 700)},
+		"ap.birth cntry":    {FieldType: "Text", FieldName: "ap.birth cntry", Widgets: widget(1, 100, 680)},
+		"ap.marital":        {FieldType: "Button", FieldName: "ap.marital", FieldOptions: []string{"Yes", "Off"}, Widgets: widget(1, 100, 660)},
+		"ap.phone":          {FieldType: "Text", FieldName: "ap.phone", FieldMaxLength: 10, Widgets: widget(1, 100, 640)},
+		"office.use":        {FieldType: "Text", FieldName: "office.use", Widgets: widget(2, 100, 100)},
+		"ap.after ph ac":    {FieldType: "Text", FieldName: "ap.after ph ac", Widgets: widget(1, 300, 400)},
+		"ap.unchanged name": {FieldType: "Text", FieldName: "ap.unchanged name", Widgets: widget(1, 100, 600)},
+	}
+	newFields := map[string]Field{
+		"ap.dob":            {FieldType: "Text", FieldName: "ap.dob", Widgets: widget(1, 100.5, 700)},
+		"ap.birth country":  {FieldType: "Text", FieldName: "ap.birth country", Widgets: widget(1, 100, 682)},
+		"ap.marital":        {FieldType: "Button", FieldName: "ap.marital", FieldOptions: []string{"Yes", "Off"}, Widgets: widget(1, 120, 660)},
+		"ap.phone":          {FieldType: "Text", FieldName: "ap.phone", FieldMaxLength: 12, Widgets: widget(1, 100, 640)},
+		"ap.email":          {FieldType: "Text", FieldName: "ap.email", Widgets: widget(2, 300, 500)},
+		"ap.after hours":    {FieldType: "Text", FieldName: "ap.after hours", Widgets: widget(1, 300, 400)},
+		"ap.unchanged name": {FieldType: "Choice", FieldName: "ap.unchanged name", Widgets: widget(1, 100, 600)},
+	}
+
+	d := DiffFields(oldFields, newFields)
+	names := func(fields []Field) []string {
+		var n []string
+		for _, f := range fields {
+			n = append(n, f.FieldName)
+		}
+		return n
+	}
+	if got := names(d.Added); !reflect.DeepEqual(got, []string{"ap.after hours", "ap.birth country", "ap.email"}) {
+		t.Errorf("Added = %v", got)
+	}
+	if got := names(d.Removed); !reflect.DeepEqual(got, []string{"ap.after ph ac", "ap.birth cntry", "office.use"}) {
+		t.Errorf("Removed = %v", got)
+	}
+	changes := make(map[string][]string)
+	for _, c := range d.Changed {
+		changes[c.Field] = c.Changes
+	}
+	want := map[string][]string{
+		"ap.marital":        {"Widgets"},
+		"ap.phone":          {"FieldMaxLength"},
+		"ap.unchanged name": {"FieldType"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Changed = %v, want %v", changes, want)
+	}
+
+	// the email field is far from the office field and named differently
+	renames := make(map[string]string)
+	for _, r := range d.Renames {
+		renames[r.Old] = r.New
+		if r.Score < minRenameScore || r.Score > 1 {
+			t.Errorf("rename %+v out of range", r)
+		}
+	}
+	wantRenames := map[string]string{"ap.birth cntry": "ap.birth country", "ap.after ph ac": "ap.after hours"}
+	if !reflect.DeepEqual(renames, wantRenames) {
+		t.Errorf("Renames = %v, want %v", renames, wantRenames)
+	}
+
+	warnings := d.SuggestRenames([]MappingWarning{{Key: "applicant.birthCountry", Field: "ap.birth cntry"}, {Key: "office", Field: "office.use"}})
+	if warnings[0].Suggestion != "ap.birth country" || len(warnings[1].Suggestion) != 0 {
+		t.Errorf("SuggestRenames = %+v", warnings)
+	}
+	if s := warnings[0].String(); s != `mapping applicant.birthCountry: field "ap.birth cntry" not found in template, likely renamed to "ap.birth country"` {
+		t.Errorf("warning = %s", s)
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want float64
+	}{
+		{"ap.dob", "AP DOB", 1},
+		{"abc", "abd", 2.0 / 3},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"", "", 1},
+		{"abc", "", 0},
+	} {
+		if got := nameSimilarity(c.a, c.b); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("nameSimilarity(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "form.pdf")
+	writeSignedPdf(t, path)
+	filled := filepath.Join(dir, "filled.pdf")
+	err := FillFormNative(context.Background(), map[string]interface{}{"Name": "Han Meimei", "Agree": "Yes"}, path, filled, FillOptions{})
+	if err != nil {
+		t.Fatalf("FillFormNative:%v", err)
+	}
+	oldValues, err := FormValuesNative(path)
+	if err != nil {
+		t.Fatalf("FormValuesNative:%v", err)
+	}
+	newValues, err := FormValuesNative(filled)
+	if err != nil {
+		t.Fatalf("FormValuesNative:%v", err)
+	}
+	want := map[string]interface{}{"Name": "Han Meimei", "Agree": "Yes", "Signature1": "", "Signature2": ""}
+	if !reflect.DeepEqual(newValues, want) {
+		t.Errorf("FormValuesNative = %v, want %v", newValues, want)
+	}
+
+	changes := DiffValues(oldValues, newValues)
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	wantLines := []string{`Agree: "Off" -> "Yes"`, `Name: "" -> "Han Meimei"`}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("DiffValues = %q, want %q", lines, wantLines)
+	}
+
+	changes = DiffValues(
+		map[string]interface{}{"list": []string{"a", "b"}, "same": []interface{}{"x"}, "cleared": []string{}, "empty": []string(nil), "gone": "1"},
+		map[string]interface{}{"list": []string{"a"}, "same": []string{"x"}, "cleared": "", "empty": []interface{}{}, "new": "2"},
+	)
+	lines = lines[:0]
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	wantLines = []string{`gone: removed "1"`, `list: "a, b" -> "a"`, `new: added "2"`}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("DiffValues = %q, want %q", lines, wantLines)
+	}
+}
@@ -2,17 +2,19 @@ package core
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
-//dump field data from pdf
-func dumpFields(pdfPath string, destPath string) (err error) {
-	err = generateCore(pdfPath, destPath, []string{"dump_data_fields_utf8"}, []string{})
+//dump field data from pdf, opened with password if it is set
+func dumpFields(ctx context.Context, pdfPath string, destPath string, password string) (err error) {
+	err = generateCorePassword(ctx, pdfPath, password, destPath, []string{"dump_data_fields_utf8"}, []string{})
 	if err != nil {
-		return fmt.Errorf("failed to invoke generateCore: %v", err)
+		return fmt.Errorf("failed to invoke generateCore: %w", err)
 	}
 	return nil
 }
@@ -29,7 +31,7 @@ func readDumpFields(filePath string) (map[string]Field, error) {
 
 	fields := make(map[string]Field)
 	fd := Field{}
-	var line string
+	var line, lastKey string
 	for {
 		line, err = reader.ReadString('\n')
 		if err != nil {
@@ -42,27 +44,33 @@ func readDumpFields(filePath string) (map[string]Field, error) {
 				fields[fd.FieldName] = fd
 			}
 			fd = Field{}
+			lastKey = ""
+			continue
 		}
 
-		if strings.HasPrefix(line, "FieldType") {
-			strs := strings.Split(strings.TrimSuffix(line, "\n"), ": ")
-			if len(strs) > 1 {
-				fd.FieldType = strs[1]
+		key, value, ok := dumpLine(line, "Field")
+		if !ok {
+			// multi-line values continue on the next lines
+			if lastKey == "FieldValue" {
+				fd.FieldValue += "\n" + strings.TrimSuffix(line, "\n")
 			}
+			continue
 		}
+		lastKey = key
 
-		if strings.HasPrefix(line, "FieldName") {
-			strs := strings.Split(strings.TrimSuffix(line, "\n"), ": ")
-			if len(strs) > 1 {
-				fd.FieldName = strs[1]
-			}
-		}
-
-		if strings.HasPrefix(line, "FieldStateOption") {
-			strs := strings.Split(strings.TrimSuffix(line, "\n"), ": ")
-			if len(strs) > 1 {
-				fd.FieldOptions = append(fd.FieldOptions, strs[1])
-			}
+		switch key {
+		case "FieldType":
+			fd.FieldType = value
+		case "FieldName":
+			fd.FieldName = value
+		case "FieldStateOption":
+			fd.FieldOptions = append(fd.FieldOptions, value)
+		case "FieldValue":
+			fd.FieldValue = value
+		case "FieldFlags":
+			fd.FieldFlags, _ = strconv.Atoi(value)
+		case "FieldMaxLength":
+			fd.FieldMaxLength, _ = strconv.Atoi(value)
 		}
 	}
 	if err != io.EOF {
@@ -75,3 +83,18 @@ func readDumpFields(filePath string) (map[string]Field, error) {
 
 	return fields, nil
 }
+
+// split a "Key: value" line of dump data, keys start with prefix such as
+// "Field" so that continued lines of multi-line values are not taken as keys
+func dumpLine(line, prefix string) (key, value string, ok bool) {
+	line = strings.TrimSuffix(line, "\n")
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	key = line[:i]
+	if !strings.HasPrefix(key, prefix) || strings.Contains(key, " ") {
+		return "", "", false
+	}
+	return key, strings.TrimPrefix(line[i+1:], " "), true
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// EncryptionAlgorithm is the cipher of an encrypted pdf
+type EncryptionAlgorithm string
+
+const (
+	// AES128 is AES with a 128 bit key, readable by Acrobat 7 and later
+	AES128 EncryptionAlgorithm = "aes128"
+	// RC4128 is RC4 with a 128 bit key, readable by Acrobat 5 and later
+	RC4128 EncryptionAlgorithm = "rc4-128"
+	// RC440 is RC4 with a 40 bit key, it is weak and only supports the
+	// permissions of Acrobat 3
+	RC440 EncryptionAlgorithm = "rc4-40"
+)
+
+// pdftk keyword of the algorithm
+func (a EncryptionAlgorithm) operation() (string, error) {
+	switch a {
+	case AES128, "":
+		return "encrypt_aes128", nil
+	case RC4128:
+		return "encrypt_128bit", nil
+	case RC440:
+		return "encrypt_40bit", nil
+	}
+	return "", fmt.Errorf("invalid encryption algorithm %q", a)
+}
+
+// Permission is a set of operations the user password grants, the owner
+// password grants all of them
+type Permission int
+
+const (
+	AllowPrinting Permission = 1 << iota
+	// AllowDegradedPrinting allows printing at low resolution only
+	AllowDegradedPrinting
+	AllowModifyContents
+	// AllowAssembly allows inserting, rotating and deleting pages
+	AllowAssembly
+	AllowCopyContents
+	// AllowScreenReaders allows copying text for accessibility
+	AllowScreenReaders
+	// AllowModifyAnnotations allows adding comments and filling fields
+	AllowModifyAnnotations
+	// AllowFillIn allows filling fields only
+	AllowFillIn
+
+	AllowAll = AllowPrinting | AllowDegradedPrinting | AllowModifyContents | AllowAssembly |
+		AllowCopyContents | AllowScreenReaders | AllowModifyAnnotations | AllowFillIn
+)
+
+// pdftk names of the permissions, in bit order
+var permissionNames = []string{
+	"Printing", "DegradedPrinting", "ModifyContents", "Assembly",
+	"CopyContents", "ScreenReaders", "ModifyAnnotations", "FillIn",
+}
+
+// permissions that need 128 bit keys
+const permissions128 = AllowDegradedPrinting | AllowAssembly | AllowScreenReaders | AllowFillIn
+
+// names returns the pdftk names of the permissions
+func (p Permission) names() []string {
+	if p&AllowAll == AllowAll {
+		return []string{"AllFeatures"}
+	}
+	var names []string
+	for i, name := range permissionNames {
+		if p&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String returns the permissions separated by commas, such as
+// "Printing,FillIn"
+func (p Permission) String() string {
+	return strings.Join(p.names(), ",")
+}
+
+// ParsePermissions parses permission names separated by commas or spaces,
+// such as "Printing,CopyContents". Names are the ones of pdftk and not case
+// sensitive, "AllFeatures" allows everything.
+func ParsePermissions(s string) (Permission, error) {
+	var p Permission
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if strings.EqualFold(name, "AllFeatures") {
+			p |= AllowAll
+			continue
+		}
+		found := false
+		for i, n := range permissionNames {
+			if strings.EqualFold(name, n) {
+				p |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown permission %q", name)
+		}
+	}
+	return p, nil
+}
+
+// Encryption protects an output pdf with passwords
+type Encryption struct {
+	// OwnerPassword grants all permissions and allows changing them
+	OwnerPassword string
+	// UserPassword is needed to open the document, empty to open it
+	// without a password
+	UserPassword string
+	// Algorithm defaults to AES128
+	Algorithm EncryptionAlgorithm
+	// Allow lists what a user may do without the owner password, nothing
+	// but viewing by default
+	Allow Permission
+}
+
+// maximum password length of the pdf standard security handler
+const maxPasswordLen = 32
+
+// Validate reports settings that pdftk rejects or that would not protect
+// the document
+func (e *Encryption) Validate() error {
+	if _, err := e.Algorithm.operation(); err != nil {
+		return err
+	}
+	if len(e.OwnerPassword) == 0 && len(e.UserPassword) == 0 {
+		return fmt.Errorf("encryption needs an owner or user password")
+	}
+	if len(e.OwnerPassword) == 0 && e.Allow != 0 {
+		// anybody could open the document with full rights
+		return fmt.Errorf("permissions need an owner password")
+	}
+	if len(e.OwnerPassword) > 0 && e.OwnerPassword == e.UserPassword {
+		return fmt.Errorf("owner and user password must differ")
+	}
+	if e.Allow&^AllowAll != 0 {
+		return fmt.Errorf("invalid permissions %#x", int(e.Allow))
+	}
+	if e.Algorithm == RC440 && e.Allow&permissions128 != 0 {
+		return fmt.Errorf("permissions %v need 128 bit encryption", e.Allow&permissions128)
+	}
+	for _, pw := range []string{e.OwnerPassword, e.UserPassword} {
+		if len(pw) > maxPasswordLen {
+			return fmt.Errorf("password longer than %d bytes", maxPasswordLen)
+		}
+		if pw == "PROMPT" {
+			// pdftk would ask for the password on stdin
+			return fmt.Errorf("invalid password %q", pw)
+		}
+		for _, r := range pw {
+			if r < 0x20 || r > 0x7e {
+				return fmt.Errorf("passwords must be printable ascii")
+			}
+		}
+	}
+	return nil
+}
+
+// args returns the pdftk output options, such as
+// encrypt_aes128 owner_pw secret allow Printing FillIn
+func (e *Encryption) args() ([]string, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	op, _ := e.Algorithm.operation()
+	args := []string{op}
+	if len(e.OwnerPassword) > 0 {
+		args = append(args, "owner_pw", e.OwnerPassword)
+	}
+	if len(e.UserPassword) > 0 {
+		args = append(args, "user_pw", e.UserPassword)
+	}
+	if e.Allow != 0 {
+		args = append(args, "allow")
+		args = append(args, e.Allow.names()...)
+	}
+	return args, nil
+}
+
+// EncryptPDF writes the pdf at pdfPath encrypted with enc to destPath
+func EncryptPDF(ctx context.Context, pdfPath, destPath string, enc Encryption) error {
+	lastOptions, err := enc.args()
+	if err != nil {
+		return err
+	}
+	// pdftk form.pdf output form.enc.pdf encrypt_aes128 owner_pw secret allow Printing
+	return generateCore(ctx, pdfPath, destPath, nil, lastOptions)
+}
+
+// encryptFile encrypts the pdf at pdfPath in place, nothing happens if enc
+// is nil
+func encryptFile(ctx context.Context, pdfPath string, enc *Encryption) error {
+	if enc == nil {
+		return nil
+	}
+	// the encrypted file replaces the input once pdftk succeeded
+	return EncryptPDF(ctx, pdfPath, pdfPath, *enc)
+}
+
+// DecryptPDF writes the pdf at pdfPath without encryption to destPath,
+// password is the owner password of the pdf
+func DecryptPDF(ctx context.Context, pdfPath, destPath, password string) error {
+	// pdftk form.pdf input_pw secret output form.plain.pdf
+	return generateCorePassword(ctx, pdfPath, password, destPath, nil, nil)
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePermissions(t *testing.T) {
+	p, err := ParsePermissions("printing, fillin,CopyContents")
+	if err != nil {
+		t.Fatalf("ParsePermissions:%v", err)
+	}
+	if p != AllowPrinting|AllowFillIn|AllowCopyContents {
+		t.Errorf("ParsePermissions = %v", p)
+	}
+	if s := p.String(); s != "Printing,CopyContents,FillIn" {
+		t.Errorf("String = %q", s)
+	}
+	if p, _ := ParsePermissions("AllFeatures"); p != AllowAll || p.String() != "AllFeatures" {
+		t.Errorf("ParsePermissions(AllFeatures) = %v", p)
+	}
+	if _, err := ParsePermissions("Printing,Everything"); err == nil {
+		t.Errorf("ParsePermissions should fail on unknown names")
+	}
+}
+
+func TestEncryptionArgs(t *testing.T) {
+	enc := Encryption{OwnerPassword: "owner", UserPassword: "user", Allow: AllowPrinting | AllowFillIn}
+	args, err := enc.args()
+	if err != nil {
+		t.Fatalf("args:%v", err)
+	}
+	want := []string{"encrypt_aes128", "owner_pw", "owner", "user_pw", "user", "allow", "Printing", "FillIn"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	enc = Encryption{UserPassword: "user", Algorithm: RC4128}
+	args, err = enc.args()
+	if err != nil {
+		t.Fatalf("args:%v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"encrypt_128bit", "user_pw", "user"}) {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestEncryptionValidate(t *testing.T) {
+	for _, enc := range []Encryption{
+		{},
+		{OwnerPassword: "a", Algorithm: "des"},
+		{UserPassword: "a", Allow: AllowPrinting},
+		{OwnerPassword: "a", UserPassword: "a"},
+		{OwnerPassword: "a", Algorithm: RC440, Allow: AllowFillIn},
+		{OwnerPassword: "a", Allow: 1 << 10},
+		{OwnerPassword: "PROMPT"},
+		{OwnerPassword: "0123456789012345678901234567890123"},
+		{OwnerPassword: "mot de passe é"},
+	} {
+		if err := enc.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", enc)
+		}
+	}
+	enc := Encryption{OwnerPassword: "a", Algorithm: RC440, Allow: AllowPrinting | AllowCopyContents}
+	if err := enc.Validate(); err != nil {
+		t.Errorf("Validate:%v", err)
+	}
+}
+
+// fakePdftk puts a pdftk script running body first in PATH
+func fakePdftk(t *testing.T, body string) string {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\n" + body + "\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "pdftk"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return filepath.Join(dir, "args")
+}
+
+func TestPasswordRequired(t *testing.T) {
+	argsPath := fakePdftk(t, `echo "Error: Failed to open PDF file: " >&2
+echo "   OWNER PASSWORD REQUIRED, but not given (or incorrect)" >&2
+exit 1`)
+
+	err := DecryptPDF(context.Background(), "../file/1022.pdf", filepath.Join(t.TempDir(), "plain.pdf"), "wrong")
+	if !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("DecryptPDF error = %v, want ErrPasswordRequired", err)
+	}
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "1022.pdf input_pw wrong output") {
+		t.Errorf("pdftk args = %s", args)
+	}
+	err = FillFormFileContext(context.Background(), nil, "../file/1022.pdf", filepath.Join(t.TempDir(), "out.pdf"), FillOptions{Password: "wrong"})
+	if !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("FillFormFileContext error = %v, want ErrPasswordRequired", err)
+	}
+	if args, _ = ioutil.ReadFile(argsPath); !strings.Contains(string(args), "1022.pdf input_pw wrong fill_form ") {
+		t.Errorf("pdftk args = %s", args)
+	}
+
+	ctx, in, dir := context.Background(), "../file/1022.pdf", t.TempDir()
+	out := filepath.Join(dir, "out.pdf")
+	calls := map[string]func() error{
+		"PdfFieldsToJSONContext": func() error { _, err := PdfFieldsToJSONContext(ctx, in, "wrong"); return err },
+		"GenerateFdfContext":     func() error { return GenerateFdfContext(ctx, in, out, "wrong") },
+		"FormValuesContext":      func() error { _, err := FormValuesContext(ctx, in, "wrong"); return err },
+		"ValidateFormContext":    func() error { _, err := ValidateFormContext(ctx, nil, in, "wrong"); return err },
+		"MergeFiles":             func() error { return MergeFiles(ctx, []string{in, in}, out, MergeOptions{Password: "wrong"}) },
+		"SelectPages":            func() error { return SelectPages(ctx, in, out, []PageRange{{First: 1}}, "wrong") },
+		"RotatePages":            func() error { return RotatePages(ctx, in, out, nil, RotateEast, "wrong") },
+		"BurstPages":             func() error { _, err := BurstPages(ctx, in, dir, "wrong"); return err },
+		"ReadMetadata":           func() error { _, err := ReadMetadata(ctx, in, "wrong"); return err },
+	}
+	for name, call := range calls {
+		os.Remove(argsPath)
+		err = call()
+		if !errors.Is(err, ErrPasswordRequired) {
+			t.Errorf("%s error = %v, want ErrPasswordRequired", name, err)
+		}
+		if args, _ = ioutil.ReadFile(argsPath); !strings.Contains(string(args), "1022.pdf input_pw wrong ") {
+			t.Errorf("%s pdftk args = %s", name, args)
+		}
+	}
+
+	err = FillFormNative(ctx, nil, in, out, FillOptions{Password: "wrong"})
+	if err == nil {
+		t.Errorf("FillFormNative with a password succeeded")
+	}
+
+	fakePdftk(t, `echo "Error: Unexpected Exception" >&2
+exit 1`)
+	// the pdftk error is wrapped once
+	enc := Encryption{OwnerPassword: "secret"}
+	for name, err := range map[string]error{
+		"DropXFA":     DropXFA(ctx, in, out),
+		"AttachFiles": AttachFiles(ctx, in, out, []string{in}, 0),
+		"EncryptPDF":  EncryptPDF(ctx, in, out, enc),
+		"UpdateInfo":  UpdateInfo(ctx, in, out, map[string]string{"Title": "1022"}),
+	} {
+		if err == nil || strings.Count(err.Error(), "pdftk exec fail") != 1 {
+			t.Errorf("%s error = %v", name, err)
+		}
+	}
+	_, err = FormValuesContext(context.Background(), "../file/1022.pdf", "")
+	if err == nil || errors.Is(err, ErrPasswordRequired) || !strings.Contains(err.Error(), "Unexpected Exception") {
+		t.Errorf("FormValuesContext error = %v, want the pdftk message", err)
+	}
+}
@@ -9,34 +9,63 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
-func init() {
-	// Check if the pdftk utility Exists.
-	_, err := exec.LookPath("pdftk")
-	if err != nil {
-		panic("pdftk utility is not installed!")
-	}
-}
+// timeout of a single pdftk run
+const pdftkTimeout = time.Second * 120
 
 //generate fdf file from pdf
 func GenerateFdf(pdfPath string, destPath string) (err error) {
-	err = generateCore(pdfPath, destPath, []string{"generate_fdf"}, []string{})
+	return generateFdf(context.Background(), pdfPath, destPath, "")
+}
+
+// GenerateFdfContext is GenerateFdf for a pdf opened with password, which
+// may be empty, pdftk is killed when ctx is done
+func GenerateFdfContext(ctx context.Context, pdfPath string, destPath string, password string) error {
+	return generateFdf(ctx, pdfPath, destPath, password)
+}
+
+func generateFdf(ctx context.Context, pdfPath string, destPath string, password string) (err error) {
+	err = generateCorePassword(ctx, pdfPath, password, destPath, []string{"generate_fdf"}, []string{})
 	if err != nil {
-		return fmt.Errorf("failed to invoke generateCore: %v", err)
+		return fmt.Errorf("failed to invoke generateCore: %w", err)
 	}
 	return nil
 }
 
 // exec pdftk  | options: between input and ouput | lastOptions: after ouput
-func generateCore(pdfPath string, destPath string, options []string, lastOptions []string) (err error) {
-	pdfPath, err = filepath.Abs(pdfPath)
-	if err != nil {
-		return fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+// pdftk is killed when ctx is done or after pdftkTimeout
+func generateCore(ctx context.Context, pdfPath string, destPath string, options []string, lastOptions []string) (err error) {
+	return generateCoreInputs(ctx, []string{pdfPath}, "", destPath, options, lastOptions)
+}
+
+// generateCorePassword is generateCore for an encrypted pdf opened with
+// password
+func generateCorePassword(ctx context.Context, pdfPath string, password string, destPath string, options []string, lastOptions []string) error {
+	return generateCoreInputs(ctx, []string{pdfPath}, password, destPath, options, lastOptions)
+}
+
+// generateCoreInputs is generateCore with several input files, such as for
+// cat, all opened with password if it is set
+func generateCoreInputs(ctx context.Context, pdfPaths []string, password string, destPath string, options []string, lastOptions []string) (err error) {
+	inputs := make([]string, len(pdfPaths))
+	for i, pdfPath := range pdfPaths {
+		pdfPath, err = filepath.Abs(pdfPath)
+		if err != nil {
+			return fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+		}
+
+		// Check if the form file Exists.
+		e, err := Exists(pdfPath)
+		if err != nil {
+			return fmt.Errorf("check pdf file Exists fail: %v", err)
+		} else if !e {
+			return fmt.Errorf("pdf file does not Exists: '%s'", pdfPath)
+		}
+		inputs[i] = pdfPath
 	}
 
 	destPath, err = filepath.Abs(destPath)
@@ -44,14 +73,6 @@ func generateCore(pdfPath string, destPath string, options []string, lastOptions
 		return fmt.Errorf("filepath abs fail|%v|%s", err, destPath)
 	}
 
-	// Check if the form file Exists.
-	e, err := Exists(pdfPath)
-	if err != nil {
-		return fmt.Errorf("check pdf file Exists fail: %v", err)
-	} else if !e {
-		return fmt.Errorf("pdf file does not Exists: '%s'", pdfPath)
-	}
-
 	// Create a temporary directory.
 	tmpDir, err := ioutil.TempDir("", "dest-")
 	if err != nil {
@@ -70,21 +91,10 @@ func generateCore(pdfPath string, destPath string, options []string, lastOptions
 	// Create the temporary output file path.
 	outFdfFile := filepath.Clean(tmpDir + "/output")
 
-	// Check if the destination file Exists.
-	e, err = Exists(destPath)
-	if err != nil {
-		return fmt.Errorf("failed to check if destination PDF file Exists: %v", err)
-	} else if e {
-		err = os.Remove(destPath)
-		if err != nil {
-			return fmt.Errorf("failed to remove destination PDF file: %v", err)
-		}
-	}
-
 	//generate fdf file command args
 	args := make([]string, 0, 5)
-	//input file
-	args = append(args, pdfPath)
+	//input files
+	args = append(args, inputs...)
 	//options
 	args = append(args, options...)
 	//output file
@@ -92,14 +102,16 @@ func generateCore(pdfPath string, destPath string, options []string, lastOptions
 	//last options
 	args = append(args, lastOptions...)
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*120)
-	_, err = execCmdInDir(ctx, tmpDir, "pdftk", args...)
+	err = runPdftk(ctx, tmpDir, password, len(inputs), args...)
 	if err != nil {
-		return fmt.Errorf("pdftk exec fail: %v", err)
+		return fmt.Errorf("pdftk exec fail: %w", err)
 	}
 
-	// On success, copy the output file to the final destination.
-	err = copyFile(outFdfFile, destPath)
+	// On success, replace the destination, which may be one of the inputs.
+	data, err := ioutil.ReadFile(outFdfFile)
+	if err == nil {
+		err = writeFileAtomic(destPath, data)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to copy created output file to final destination: %v", err)
 	}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteFDF writes form data as an fdf document accepted by pdftk fill_form.
+// Values are written as text strings, slices as arrays for multi-select
+// choice fields.
+func WriteFDF(w io.Writer, form map[string]interface{}) error {
+	bw := bufio.NewWriter(w)
+
+	// Write the fdf header.
+	bw.WriteString(fdfHeader + "\n")
+
+	// Write the form data.
+	for _, key := range sortedKeys(form) {
+		bw.WriteString("<< /T ")
+		writePdfString(bw, encodeTextString(key))
+		bw.WriteString(" /V ")
+		values, multi := formValueList(form[key])
+		if multi {
+			bw.WriteString("[")
+			for i, v := range values {
+				if i > 0 {
+					bw.WriteString(" ")
+				}
+				writePdfString(bw, encodeTextString(v))
+			}
+			bw.WriteString("]")
+		} else {
+			writePdfString(bw, encodeTextString(values[0]))
+		}
+		bw.WriteString(">>\n")
+	}
+
+	// Write the fdf footer.
+	bw.WriteString(fdfFooter + "\n")
+
+	// Flush everything.
+	return bw.Flush()
+}
+
+// ReadFDF reads the field values of an fdf document, such as the output of
+// GenerateFdf or WriteFDF. Hierarchical fields are returned with their full
+// dotted names.
+func ReadFDF(r io.Reader) (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read fdf: %v", err)
+	}
+
+	// find the catalog dictionary holding /FDF
+	lex := newPdfLexer(data)
+	for {
+		obj, err := lex.object()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no /FDF dictionary found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse fdf: %v", err)
+		}
+		d, ok := obj.(pdfDict)
+		if !ok {
+			continue
+		}
+		fdf, ok := d["FDF"].(pdfDict)
+		if !ok {
+			continue
+		}
+		fields, _ := fdf["Fields"].(pdfArray)
+
+		form := make(map[string]interface{})
+		readFdfFields(form, "", fields)
+		return form, nil
+	}
+}
+
+// collect values of an fdf /Fields or /Kids array
+func readFdfFields(form map[string]interface{}, prefix string, fields pdfArray) {
+	for _, f := range fields {
+		d, ok := f.(pdfDict)
+		if !ok {
+			continue
+		}
+		name := prefix
+		if t, ok := d["T"].(pdfString); ok {
+			name = joinFieldName(prefix, decodeTextString(t))
+		}
+
+		if kids, ok := d["Kids"].(pdfArray); ok {
+			readFdfFields(form, name, kids)
+		}
+		v, ok := d["V"]
+		if !ok || len(name) == 0 {
+			continue
+		}
+		form[name] = pdfValueToForm(v)
+	}
+}
+
+// convert a pdf field value to form data
+func pdfValueToForm(v interface{}) interface{} {
+	switch t := v.(type) {
+	case pdfString:
+		return decodeTextString(t)
+	case pdfName:
+		return string(t)
+	case pdfArray:
+		values := make([]string, 0, len(t))
+		for _, e := range t {
+			values = append(values, fmt.Sprintf("%v", pdfValueToForm(e)))
+		}
+		return values
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// formValueList returns the text of a form data value, multi is true for
+// slices which fill multi-select choice fields
+func formValueList(v interface{}) (values []string, multi bool) {
+	switch t := v.(type) {
+	case []string:
+		return t, true
+	case []interface{}:
+		values = make([]string, 0, len(t))
+		for _, e := range t {
+			values = append(values, formValueText(e))
+		}
+		return values, true
+	case nil:
+		return []string{""}, false
+	}
+	return []string{formValueText(v)}, false
+}
+
+// formValueText formats a single value, floats such as decoded json
+// numbers without an exponent
+func formValueText(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// form data keys in a stable order
+func sortedKeys(form map[string]interface{}) []string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formValueString returns the text of a form data value, values of
+// multi-select fields are joined with ", "
+func formValueString(v interface{}) string {
+	values, _ := formValueList(v)
+	return strings.Join(values, ", ")
+}
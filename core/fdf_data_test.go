@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFormDataRoundTrip(t *testing.T) {
+	form := map[string]interface{}{
+		"ap.name fam":  "O'Brien (Jr)",
+		"ap.name giv":  "Zoë",
+		"ap.resi str":  "1 Main St\nUnit 2",
+		"ap.marital":   "Yes",
+		"ap.languages": []string{"English", "Français"},
+		"ref":          `back\slash`,
+	}
+
+	var buf bytes.Buffer
+	err := WriteFDF(&buf, form)
+	if err != nil {
+		t.Fatalf("WriteFDF:%v", err)
+	}
+	got, err := ReadFDF(&buf)
+	if err != nil {
+		t.Fatalf("ReadFDF:%v", err)
+	}
+	if !reflect.DeepEqual(got, form) {
+		t.Fatalf("fdf round trip: got %v, want %v", got, form)
+	}
+
+	buf.Reset()
+	err = WriteXFDF(&buf, form)
+	if err != nil {
+		t.Fatalf("WriteXFDF:%v", err)
+	}
+	got, err = ReadXFDF(&buf)
+	if err != nil {
+		t.Fatalf("ReadXFDF:%v", err)
+	}
+	if !reflect.DeepEqual(got, form) {
+		t.Fatalf("xfdf round trip: got %v, want %v", got, form)
+	}
+}
+
+func TestFormValueList(t *testing.T) {
+	for _, c := range []struct {
+		value interface{}
+		want  []string
+	}{
+		{float64(1234567), []string{"1234567"}},
+		{61412345678.0, []string{"61412345678"}},
+		{12.5, []string{"12.5"}},
+		{json.Number("61412345678"), []string{"61412345678"}},
+		{[]interface{}{1e6, "a"}, []string{"1000000", "a"}},
+	} {
+		if got, _ := formValueList(c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("formValueList(%v) = %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+// read the hierarchical fdf generated by pdftk
+func TestReadFDF(t *testing.T) {
+	f, err := os.Open("../file/1022.fdf")
+	if err != nil {
+		t.Fatalf("Open:%v", err)
+	}
+	defer f.Close()
+
+	form, err := ReadFDF(f)
+	if err != nil {
+		t.Fatalf("ReadFDF:%v", err)
+	}
+	keys, err := readFormFields("../file/1022.fdf")
+	if err != nil {
+		t.Fatalf("readFormFields:%v", err)
+	}
+	if len(form) != len(keys) {
+		t.Fatalf("ReadFDF: got %d fields, want %d", len(form), len(keys))
+	}
+	for k := range keys {
+		if v, ok := form[k]; !ok || v != "" {
+			t.Fatalf("ReadFDF: field %s = %v", k, v)
+		}
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	fields := map[string]Field{
+		"ap.dob":     {FieldType: "Text", FieldName: "ap.dob", FieldMaxLength: 10},
+		"ap.marital": {FieldType: "Button", FieldName: "ap.marital", FieldOptions: []string{"Off", "Yes"}},
+		"ap.cntry":   {FieldType: "Choice", FieldName: "ap.cntry", FieldOptions: []string{"AU", "NZ"}},
+		"ap.file no": {FieldType: "Text", FieldName: "ap.file no", FieldFlags: flagReadOnly},
+	}
+	form := map[string]interface{}{
+		"ap.dob":     "01/01/19800",
+		"ap.marital": "On",
+		"ap.cntry":   "NZ",
+		"ap.file no": "1",
+		"ap.unknown": "x",
+	}
+
+	errs := validateFields(form, fields)
+	want := []string{"ap.dob", "ap.file no", "ap.marital", "ap.unknown"}
+	if len(errs) != len(want) {
+		t.Fatalf("validateFields: got %v", errs)
+	}
+	for i, e := range errs {
+		if e.Field != want[i] {
+			t.Fatalf("validateFields: got %s, want %s", e.Field, want[i])
+		}
+	}
+}
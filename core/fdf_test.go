@@ -1,24 +1,55 @@
 package core
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/google/uuid"
-	"io/ioutil"
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
+// skipNoPdftk skips tests of pdftk operations where pdftk is not installed
+func skipNoPdftk(t *testing.T, err error) {
+	t.Helper()
+	if errors.Is(err, ErrNoPdftk) {
+		t.Skip(err)
+	}
+}
+
 // test generate fdf
 func TestGenerateFdfByPdf(t *testing.T) {
 	pdfPath := "../file/1022.pdf"
-	fdfPath := "../file/1022.fdf"
+	fdfPath := filepath.Join(t.TempDir(), "1022.fdf")
 
 	err := GenerateFdf(pdfPath, fdfPath)
+	skipNoPdftk(t, err)
 	if err != nil {
 		t.Fatalf("fail to GenerateFdfByPdf:%v", err)
 		return
 	}
+
+	// the fixture was generated from the same pdf
+	got, err := readFDFFile(fdfPath)
+	if err != nil {
+		t.Fatalf("ReadFDF:%v", err)
+	}
+	want, err := readFDFFile("../file/1022.fdf")
+	if err != nil {
+		t.Fatalf("ReadFDF:%v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GenerateFdf = %v, want %v", got, want)
+	}
+}
+
+func readFDFFile(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFDF(f)
 }
 
 // test readFormFields
@@ -34,69 +65,72 @@ func TestReadFormFields(t *testing.T) {
 
 func TestPdfFormFields(t *testing.T) {
 	pdfPath := "../file/1022.pdf"
-	resultData, err := pdfFormFields(pdfPath)
+	resultData, err := pdfFormFields(context.Background(), pdfPath, "")
+	skipNoPdftk(t, err)
 	if err != nil {
 		t.Fatalf("fail to pdfFormFields:%v", err)
 		return
 	}
 	t.Logf("%+v\n", resultData)
 
-	result := make(map[string]interface{})
-	for k, _ := range resultData {
-		result[k] = k
-	}
-	data, err := json.Marshal(result)
-	if err != nil {
-		t.Fatalf("fail to pdfFormFields:%v", err)
-		return
+	f, ok := resultData["ap.dob"]
+	if !ok || f.FieldName != "ap.dob" || f.FieldType != "Text" {
+		t.Errorf("pdfFormFields ap.dob = %+v", f)
 	}
-	f, err := os.Create("../file/result.json")
-	if err != nil {
-		t.Fatalf("Create:%v", err)
-		return
-	}
-	defer f.Close()
-
-	_, err = f.Write(data)
-	if err != nil {
-		t.Fatalf("Write:%v", err)
-		return
+	if len(f.Widgets) != 1 || f.Widgets[0].Page != 1 {
+		t.Errorf("pdfFormFields ap.dob widgets = %+v", f.Widgets)
 	}
 }
 
 func TestFillForm(t *testing.T) {
 	pdfPath := "../file/1022.pdf"
-	data, err := ioutil.ReadFile("../file/result.json")
+	keys, err := readFormFields("../file/1022.fdf")
 	if err != nil {
-		t.Fatalf("Open:%v", err)
+		t.Fatalf("fail to readFormFields:%v", err)
 		return
 	}
 
-	var m map[string]interface{}
-	err = json.Unmarshal(data, &m)
-	if err != nil {
-		t.Fatalf("Unmarshal:%v", err)
-		return
+	// every field is filled with its name
+	m := make(map[string]interface{}, len(keys))
+	for k := range keys {
+		m[k] = k
 	}
 
-	_, err = FillForm(m, pdfPath, true)
+	dir := t.TempDir()
+	err = FillFormFile(m, pdfPath, filepath.Join(dir, "filled.pdf"), FillOptions{})
+	skipNoPdftk(t, err)
 	if err != nil {
 		t.Fatalf("FillForm:%v", err)
 		return
 	}
+	values, err := FormValuesNative(filepath.Join(dir, "filled.pdf"))
+	if err != nil {
+		t.Fatalf("FormValuesNative:%v", err)
+	}
+	if values["ap.dob"] != "ap.dob" || values["ap.email"] != "ap.email" {
+		t.Errorf("filled values ap.dob %q, ap.email %q", values["ap.dob"], values["ap.email"])
+	}
+
+	err = FillFormFile(m, pdfPath, filepath.Join(dir, "flat.pdf"), FillOptions{Flatten: true})
+	if err != nil {
+		t.Fatalf("FillForm flatten:%v", err)
+	}
+	values, err = FormValuesNative(filepath.Join(dir, "flat.pdf"))
+	if err != nil || len(values) != 0 {
+		t.Errorf("flattened pdf has fields %v, %v", values, err)
+	}
 }
 
 func TestDumpFields(t *testing.T) {
 	pdfPath := "../file/1022.pdf"
-	fileID := uuid.New()
 	// dump fields to dest file
-	dumpPath := fmt.Sprintf("../file/%s.dump", fileID)
-	err := dumpFields(pdfPath, dumpPath)
+	dumpPath := filepath.Join(t.TempDir(), "1022.dump")
+	err := dumpFields(context.Background(), pdfPath, dumpPath, "")
+	skipNoPdftk(t, err)
 	if err != nil {
 		t.Fatalf("dumpFields:%v", err)
 		return
 	}
-	//defer os.Remove(dumpPath)
 
 	// read dump fields
 	fields, err := readDumpFields(dumpPath)
@@ -106,12 +140,19 @@ func TestDumpFields(t *testing.T) {
 	}
 
 	t.Logf("%+v\n", fields)
+	if f := fields["ap.dob"]; f.FieldType != "Text" {
+		t.Errorf("readDumpFields ap.dob = %+v", f)
+	}
 }
 
 func TestPdfFieldsToJSON(t *testing.T) {
-	_, err := PdfFieldsToJSON("../file/1022.pdf")
+	info, err := PdfFieldsToJSON("../file/1022.pdf")
+	skipNoPdftk(t, err)
 	if err != nil {
 		t.Fatalf("PdfFieldsToJSON:%v", err)
 		return
 	}
+	if info.PdfPath != "../file/1022.pdf" || len(info.GroupFields) == 0 || len(info.Pages) == 0 {
+		t.Errorf("PdfFieldsToJSON = %+v", info)
+	}
 }
@@ -1,7 +1,7 @@
 package core
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"io/ioutil"
@@ -12,10 +12,17 @@ import (
 )
 
 type Field struct {
-	FieldType    string   `json:"FieldType"`
-	FieldName    string   `json:"FieldName"`
-	ViewName     string   `json:"ViewName"`
-	FieldOptions []string `json:"FieldOptions,omitempty"`
+	FieldType      string   `json:"FieldType"`
+	FieldName      string   `json:"FieldName"`
+	ViewName       string   `json:"ViewName"`
+	FieldOptions   []string `json:"FieldOptions,omitempty"`
+	FieldValue     string   `json:"FieldValue,omitempty"`
+	FieldFlags     int      `json:"FieldFlags,omitempty"`
+	FieldMaxLength int      `json:"FieldMaxLength,omitempty"`
+	// Signed is true for signature fields holding a signature
+	Signed bool `json:"Signed,omitempty"`
+	// Widgets are where the field is shown
+	Widgets []Widget `json:"Widgets,omitempty"`
 }
 
 type GroupField struct {
@@ -28,15 +35,33 @@ type FieldInfo struct {
 	PdfPath      string       `json:"PdfPath"`
 	GroupFields  []GroupField `json:"GroupFields"`
 	SingleFields []Field      `json:"SingleFields"`
+	// XFA is true for forms with an XFA part, which viewers may show
+	// instead of the filled fields, see FillOptions.DropXFA
+	XFA bool `json:"XFA,omitempty"`
+	// Pages are the visible areas of the pages the widgets are placed on
+	Pages []Page `json:"Pages,omitempty"`
 }
 
 // extract form fields and convert to json
 func PdfFieldsToJSON(pdfPath string) (*FieldInfo, error) {
-	rawFields, err := pdfFormFields(pdfPath)
+	return PdfFieldsToJSONContext(context.Background(), pdfPath, "")
+}
+
+// PdfFieldsToJSONContext is PdfFieldsToJSON for a pdf opened with password,
+// which may be empty, pdftk is killed when ctx is done
+func PdfFieldsToJSONContext(ctx context.Context, pdfPath string, password string) (*FieldInfo, error) {
+	rawFields, err := pdfFormFields(ctx, pdfPath, password)
 	if err != nil {
-		return nil, fmt.Errorf("fail to pdfFormFields: %+v", err)
+		return nil, fmt.Errorf("fail to pdfFormFields: %w", err)
 	}
+	info := buildFieldInfo(pdfPath, rawFields)
+	info.XFA = hasXFA(pdfPath)
+	info.Pages = fieldGeometry(pdfPath).Pages
+	return info, nil
+}
 
+// group form fields by the first word of their names
+func buildFieldInfo(pdfPath string, rawFields map[string]Field) *FieldInfo {
 	tmpFields := make(map[string]*GroupField, len(rawFields))
 	for k, fd := range rawFields {
 
@@ -70,23 +95,32 @@ func PdfFieldsToJSON(pdfPath string) (*FieldInfo, error) {
 		SingleFields: singleFields,
 	}
 
-	return result, nil
+	return result
 }
 
-// extract pdf form infos
-func pdfFormFields(pdfPath string) (map[string]Field, error) {
-	fileID := uuid.New()
-
-	// dump fields to dest file
-	dumpPath, err := filepath.Abs(fmt.Sprintf("../file/%s.dump", fileID))
+// extract pdf form infos, the pdf is opened with password if it is set
+func pdfFormFields(ctx context.Context, pdfPath string, password string) (map[string]Field, error) {
+	// Create a temporary directory.
+	tmpDir, err := ioutil.TempDir("", "fields-")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
 	}
-	err = dumpFields(pdfPath, dumpPath)
+
+	// Remove the temporary directory on defer again.
+	defer func() {
+		errD := os.RemoveAll(tmpDir)
+		// Log the error only.
+		if errD != nil {
+			log.Printf("fillpdf: failed to remove temporary directory '%s' again: %v", tmpDir, errD)
+		}
+	}()
+
+	// dump fields to dest file
+	dumpPath := filepath.Join(tmpDir, "fields.dump")
+	err = dumpFields(ctx, pdfPath, dumpPath, password)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(dumpPath)
 
 	// read dump fields
 	fields, err := readDumpFields(dumpPath)
@@ -95,15 +129,11 @@ func pdfFormFields(pdfPath string) (map[string]Field, error) {
 	}
 
 	// generate fdf file
-	fdfPath, err := filepath.Abs(fmt.Sprintf("../file/%s.fdf", fileID))
-	if err != nil {
-		return nil, err
-	}
-	err = GenerateFdf(pdfPath, fdfPath)
+	fdfPath := filepath.Join(tmpDir, "fields.fdf")
+	err = generateFdf(ctx, pdfPath, fdfPath, password)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(fdfPath)
 
 	// pdf form keys
 	formKeys, err := readFormFields(fdfPath)
@@ -112,9 +142,13 @@ func pdfFormFields(pdfPath string) (map[string]Field, error) {
 	}
 
 	// select form fields from all fields
+	signed := signedFields(pdfPath)
+	geometry := fieldGeometry(pdfPath)
 	result := make(map[string]Field)
 	for k, v := range fields {
 		if _, ok := formKeys[k]; ok {
+			v.Signed = signed[k]
+			v.Widgets = geometry.Fields[k]
 			result[k] = v
 		}
 	}
@@ -122,13 +156,79 @@ func pdfFormFields(pdfPath string) (map[string]Field, error) {
 	return result, nil
 }
 
+// FillOptions controls how form data is written into the pdf
+type FillOptions struct {
+	// Flatten merges the filled fields into the page content so
+	// they can no longer be edited
+	Flatten bool
+	// NeedAppearances asks the viewer to regenerate field appearances
+	// instead of using the ones created by pdftk, useful for non-latin text
+	NeedAppearances bool
+	// Mapping translates the keys of form to pdf field names before the
+	// fill, see FieldMapping
+	Mapping *FieldMapping
+	// Formats formats values by form key after the mapping, such as dates
+	// or a value split over several fields, see FieldFormat
+	Formats map[string]FieldFormat
+	// Info is set in the document information of the filled pdf, such as
+	// a case ID to trace the output back to its data
+	Info map[string]string
+	// Encryption protects the filled pdf with passwords, see Encryption
+	Encryption *Encryption
+	// Password opens an encrypted pdf, pdftk needs the owner password to
+	// fill. The filled pdf is not encrypted unless Encryption is set.
+	Password string
+	// DropXFA removes the XFA form of hybrid forms, so that viewers show
+	// the filled fields
+	DropXFA bool
+	// FillXFA also writes the data into the XFA datasets of hybrid forms,
+	// keyed by the AcroForm field names
+	FillXFA bool
+	// AttachData embeds the filled data in the pdf as "json", "fdf" or
+	// "xfdf", keyed by field name, so the output can be audited against
+	// its input
+	AttachData string
+	// Images are placed in push button fields or on pages, such as a
+	// passport photo
+	Images []Image
+	// BreakSignatures lets pdftk rewrite signed pdfs, which invalidates
+	// their signatures. Without it such fills fail with ErrSigned, use the
+	// Native backend to keep the signatures.
+	BreakSignatures bool
+}
+
 // fill form to designated pdf
 func FillForm(form map[string]interface{}, pdfPath string, flatten bool) (string, error) {
+	outID := fmt.Sprintf("%s.pdf", uuid.New())
+	outPdfPath := fmt.Sprintf("file/%s", outID)
+
+	err := FillFormFile(form, pdfPath, outPdfPath, FillOptions{Flatten: flatten})
+	if err != nil {
+		return "", err
+	}
+	return outPdfPath, nil
+}
+
+// FillFormFile fills form into the pdf at pdfPath and writes the result to destPath
+func FillFormFile(form map[string]interface{}, pdfPath string, destPath string, opts FillOptions) error {
+	return FillFormFileContext(context.Background(), form, pdfPath, destPath, opts)
+}
+
+// FillFormFileContext is FillFormFile, pdftk is killed when ctx is done
+func FillFormFileContext(ctx context.Context, form map[string]interface{}, pdfPath string, destPath string, opts FillOptions) error {
+	form, err := opts.prepareForm(form)
+	if err != nil {
+		return err
+	}
+	err = opts.validate()
+	if err != nil {
+		return err
+	}
 
 	// Create a temporary directory.
 	tmpDir, err := ioutil.TempDir("", "fillpdf-")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary directory: %v", err)
+		return fmt.Errorf("failed to create temporary directory: %v", err)
 	}
 
 	// Remove the temporary directory on defer again.
@@ -144,26 +244,122 @@ func FillForm(form map[string]interface{}, pdfPath string, flatten bool) (string
 	fdfFile := filepath.Clean(tmpDir + "/data.fdf")
 	err = createFdfFile(form, fdfFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to create fdf form data file: %v", err)
+		return fmt.Errorf("failed to create fdf form data file: %v", err)
 	}
 
-	outID := fmt.Sprintf("%s.pdf", uuid.New())
-	outPdfPath := fmt.Sprintf("file/%s", outID)
-
 	// pdftk form.pdf fill_form data.fdf output form.filled.pdf
 	args := []string{
 		"fill_form",
 		fdfFile,
 	}
 	var lastOptions []string
-	if flatten {
+	if opts.NeedAppearances {
+		lastOptions = append(lastOptions, "need_appearances")
+	}
+	if opts.Flatten {
 		lastOptions = append(lastOptions, "flatten")
 	}
-	err = generateCore(pdfPath, outPdfPath, args, lastOptions)
+	if opts.DropXFA {
+		lastOptions = append(lastOptions, "drop_xfa")
+	}
+	// attachments and info are written natively and cannot go into an
+	// encrypted file, without them the fill encrypts right away
+	enc := opts.Encryption
+	if enc != nil && !opts.updatesOutput() {
+		encArgs, err := enc.args()
+		if err != nil {
+			return err
+		}
+		lastOptions = append(lastOptions, encArgs...)
+		enc = nil
+	}
+	err = opts.checkSignatures(ctx, pdfPath)
 	if err != nil {
-		return "", fmt.Errorf("pdftk exec fail: %v", err)
+		return err
 	}
-	return outPdfPath, nil
+	err = generateCorePassword(ctx, pdfPath, opts.Password, destPath, args, lastOptions)
+	if err != nil {
+		return fmt.Errorf("pdftk exec fail: %w", err)
+	}
+	err = opts.updateOutput(destPath, form)
+	if err != nil {
+		return err
+	}
+	return encryptFile(ctx, destPath, enc)
+}
+
+// validate checks the options that are applied after the fill
+func (opts *FillOptions) validate() error {
+	if _, ok := dataAttachments[opts.AttachData]; len(opts.AttachData) > 0 && !ok {
+		return fmt.Errorf("unknown data format %q", opts.AttachData)
+	}
+	if opts.DropXFA && opts.FillXFA {
+		return fmt.Errorf("DropXFA and FillXFA exclude each other")
+	}
+	for _, img := range opts.Images {
+		// flattening removes the push buttons before the images are placed
+		if opts.Flatten && len(img.Field) > 0 {
+			return fmt.Errorf("image of field %s cannot be placed in a flattened form, give its page rectangle", img.Field)
+		}
+	}
+	if opts.Encryption != nil {
+		return opts.Encryption.Validate()
+	}
+	return nil
+}
+
+// updatesOutput reports whether updateOutput changes the filled pdf
+func (opts *FillOptions) updatesOutput() bool {
+	return len(opts.Info) > 0 || len(opts.AttachData) > 0 || opts.FillXFA || len(opts.Images) > 0
+}
+
+// updateOutput places the images, fills the XFA datasets, attaches the
+// data and sets the document info of the filled pdf at pdfPath in place, in
+// one incremental update
+func (opts *FillOptions) updateOutput(pdfPath string, form map[string]interface{}) error {
+	if !opts.updatesOutput() {
+		return nil
+	}
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	err = opts.applyUpdate(doc, u, form)
+	if err != nil {
+		return err
+	}
+	return u.writeFile(pdfPath, nil)
+}
+
+// applyUpdate adds the changes of updateOutput to u
+func (opts *FillOptions) applyUpdate(doc *pdfDocument, u *pdfUpdate, form map[string]interface{}) error {
+	if len(opts.Images) > 0 {
+		err := doc.addImages(u, opts.Images)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.FillXFA {
+		err := doc.fillXFA(u, form)
+		if err != nil {
+			return fmt.Errorf("fail to fill XFA: %v", err)
+		}
+	}
+	if len(opts.AttachData) > 0 {
+		a, err := dataAttachment(form, opts.AttachData)
+		if err != nil {
+			return err
+		}
+		err = doc.attach(u, []Attachment{a})
+		if err != nil {
+			return fmt.Errorf("fail to attach data: %v", err)
+		}
+	}
+	if len(opts.Info) > 0 {
+		doc.setInfo(u, opts.Info)
+	}
+	return nil
 }
 
 func createFdfFile(form map[string]interface{}, path string) error {
@@ -174,22 +370,7 @@ func createFdfFile(form map[string]interface{}, path string) error {
 	}
 	defer file.Close()
 
-	// Create a new writer.
-	w := bufio.NewWriter(file)
-
-	// Write the fdf header.
-	fmt.Fprintln(w, fdfHeader)
-
-	// Write the form data.
-	for key, value := range form {
-		fmt.Fprintf(w, "<< /T (%s) /V (%v)>>\n", key, value)
-	}
-
-	// Write the fdf footer.
-	fmt.Fprintln(w, fdfFooter)
-
-	// Flush everything.
-	return w.Flush()
+	return WriteFDF(file, form)
 }
 
 const fdfHeader = `%FDF-1.2
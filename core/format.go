@@ -0,0 +1,289 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FieldFormat formats the value of one form key before the fill. Dates and
+// numbers are written with a layout, and Split distributes the formatted
+// value over several fields, such as a phone number written to an area code
+// and a number field or a date written to day, month and year boxes:
+//
+//	"ap.after phone": {"split": {"pattern": "## ########", "fields": ["ap.after ph ac", "ap.after pn"]}}
+//	"ap.dob": {"date": "02012006", "split": {"pattern": "## ## ####", "fields": ["ap.dob dd", "ap.dob mm", "ap.dob yyyy"]}}
+//	"ap.income": {"decimals": 2, "thousands": ","}
+type FieldFormat struct {
+	// Date is the layout of time.Time values and of strings parsed with
+	// ParseDate, default "2006-01-02"
+	Date      string `json:"date,omitempty"`
+	ParseDate string `json:"parseDate,omitempty"`
+	// Decimals formats numbers with a fixed number of decimals, numbers
+	// are written unchanged when it is nil
+	Decimals *int `json:"decimals,omitempty"`
+	// Thousands separates groups of thousands, such as ","
+	Thousands string `json:"thousands,omitempty"`
+	// DecimalPoint replaces the ".", such as "," for european forms
+	DecimalPoint string `json:"decimalPoint,omitempty"`
+	// Split writes the formatted value to several fields instead of the
+	// field of the form key
+	Split *SplitFormat `json:"split,omitempty"`
+}
+
+// SplitFormat cuts a value into parts by a pattern. Every run of '#' in the
+// pattern is one part of that many characters, a '*' is a part taking the
+// remaining characters, other characters only separate parts. The value is
+// matched without spaces and punctuation, so "(02) 9999 8888" and
+// "0299998888" split the same.
+type SplitFormat struct {
+	Pattern string   `json:"pattern"`
+	Fields  []string `json:"fields"`
+}
+
+// width of a '*' part
+const splitRest = -1
+
+// part widths of the pattern
+func (s *SplitFormat) parts() ([]int, error) {
+	var parts []int
+	for i := 0; i < len(s.Pattern); i++ {
+		switch s.Pattern[i] {
+		case '#':
+			n := 1
+			for i+1 < len(s.Pattern) && s.Pattern[i+1] == '#' {
+				n++
+				i++
+			}
+			parts = append(parts, n)
+		case '*':
+			parts = append(parts, splitRest)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("split pattern %q has no parts", s.Pattern)
+	}
+	if len(parts) != len(s.Fields) {
+		return nil, fmt.Errorf("split pattern %q has %d parts for %d fields", s.Pattern, len(parts), len(s.Fields))
+	}
+	return parts, nil
+}
+
+// split value into one part per field
+func (s *SplitFormat) split(value string) (map[string]string, error) {
+	parts, err := s.parts()
+	if err != nil {
+		return nil, err
+	}
+	chars := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value))
+
+	result := make(map[string]string, len(parts))
+	for i, n := range parts {
+		if n == splitRest || n > len(chars) {
+			n = len(chars)
+		}
+		result[s.Fields[i]] = string(chars[:n])
+		chars = chars[n:]
+	}
+	if len(chars) > 0 {
+		return nil, fmt.Errorf("%q is too long for pattern %q", value, s.Pattern)
+	}
+	return result, nil
+}
+
+func (f *FieldFormat) check() error {
+	if f.Decimals != nil && (*f.Decimals < 0 || *f.Decimals > 20) {
+		return fmt.Errorf("invalid decimals %d", *f.Decimals)
+	}
+	if f.Split != nil {
+		_, err := f.Split.parts()
+		return err
+	}
+	return nil
+}
+
+// format writes the formatted value of key to form
+func (f *FieldFormat) format(form map[string]interface{}, key string, value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case []string, []interface{}:
+		if f.Split != nil {
+			return fmt.Errorf("cannot split a list")
+		}
+		values, _ := formValueList(v)
+		list := make([]string, len(values))
+		for i, e := range values {
+			formatted, err := f.formatValue(e)
+			if err != nil {
+				return err
+			}
+			list[i] = formatted
+		}
+		form[key] = list
+		return nil
+	default:
+		var err error
+		s, err = f.formatValue(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.Split == nil {
+		form[key] = s
+		return nil
+	}
+	parts, err := f.Split.split(s)
+	if err != nil {
+		return err
+	}
+	delete(form, key)
+	for field, part := range parts {
+		form[field] = part
+	}
+	return nil
+}
+
+func (f *FieldFormat) formatValue(value interface{}) (string, error) {
+	layout := f.Date
+	if len(layout) == 0 {
+		layout = defaultTimeFormat
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case time.Time:
+		if v.IsZero() {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	case *time.Time:
+		if v == nil || v.IsZero() {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	case float64:
+		return f.formatNumber(v), nil
+	case float32:
+		return f.formatNumber(float64(v)), nil
+	case int:
+		if !f.formatsNumbers() {
+			return strconv.Itoa(v), nil
+		}
+		return f.formatNumber(float64(v)), nil
+	case int64:
+		// large integers such as IDs keep their digits
+		if !f.formatsNumbers() {
+			return strconv.FormatInt(v, 10), nil
+		}
+		return f.formatNumber(float64(v)), nil
+	case json.Number:
+		if !f.formatsNumbers() {
+			return v.String(), nil
+		}
+		n, err := v.Float64()
+		if err != nil {
+			return "", err
+		}
+		return f.formatNumber(n), nil
+	}
+
+	s := formValueString(value)
+	if len(strings.TrimSpace(s)) == 0 {
+		return s, nil
+	}
+	if len(f.ParseDate) > 0 {
+		d, err := time.Parse(f.ParseDate, strings.TrimSpace(s))
+		if err != nil {
+			return "", err
+		}
+		return d.Format(layout), nil
+	}
+	if f.formatsNumbers() {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", s)
+		}
+		return f.formatNumber(n), nil
+	}
+	return s, nil
+}
+
+// formatsNumbers reports whether f changes how numbers are written
+func (f *FieldFormat) formatsNumbers() bool {
+	return f.Decimals != nil || len(f.Thousands) > 0 || len(f.DecimalPoint) > 0
+}
+
+func (f *FieldFormat) formatNumber(n float64) string {
+	prec := -1
+	if f.Decimals != nil {
+		prec = *f.Decimals
+	}
+	s := strconv.FormatFloat(n, 'f', prec, 64)
+	if math.IsInf(n, 0) || math.IsNaN(n) {
+		return s
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	if len(f.Thousands) > 0 {
+		var b strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteString(f.Thousands)
+			}
+			b.WriteRune(c)
+		}
+		intPart = b.String()
+	}
+	if len(frac) == 0 {
+		return sign + intPart
+	}
+	point := f.DecimalPoint
+	if len(point) == 0 {
+		point = "."
+	}
+	return sign + intPart + point + frac
+}
+
+// applyFormats formats the keys of form that have a format, form is not
+// modified
+func applyFormats(form map[string]interface{}, formats map[string]FieldFormat) (map[string]interface{}, error) {
+	if len(formats) == 0 {
+		return form, nil
+	}
+	result := make(map[string]interface{}, len(form))
+	for k, v := range form {
+		result[k] = v
+	}
+	for _, key := range sortedKeys(form) {
+		f, ok := formats[key]
+		if !ok {
+			continue
+		}
+		err := f.check()
+		if err == nil {
+			err = f.format(result, key, form[key])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("format %s: %v", key, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyFormats(t *testing.T) {
+	var formats map[string]FieldFormat
+	err := json.Unmarshal([]byte(`{
+		"ap.after phone": {"split": {"pattern": "## ########", "fields": ["ap.after ph ac", "ap.after pn"]}},
+		"ap.dob": {"date": "02012006", "split": {"pattern": "## ## ####", "fields": ["ap.dob dd", "ap.dob mm", "ap.dob yyyy"]}},
+		"ap.arrival": {"date": "02/01/2006", "parseDate": "2006-01-02"},
+		"ap.income": {"decimals": 2, "thousands": ",", "decimalPoint": "."},
+		"ap.assets": {"thousands": "."},
+		"ap.ref": {"split": {"pattern": "### *", "fields": ["ap.ref a", "ap.ref b"]}},
+		"ap.id": {"split": {"pattern": "### *", "fields": ["ap.id a", "ap.id b"]}},
+		"ap.account": {"split": {"pattern": "#### *", "fields": ["ap.account a", "ap.account b"]}}
+	}`), &formats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := map[string]interface{}{
+		"ap.after phone": "(02) 9999 8888",
+		"ap.dob":         time.Date(1980, 3, 7, 0, 0, 0, 0, time.UTC),
+		"ap.arrival":     "2019-10-01",
+		"ap.income":      -1234567.5,
+		"ap.assets":      "1200000",
+		"ap.ref":         "ABC-12345",
+		"ap.id":          int64(9007199254740993),
+		"ap.account":     json.Number("12345678901234567890"),
+		"ap.name fam":    "SMITH",
+	}
+	got, err := applyFormats(form, formats)
+	if err != nil {
+		t.Fatalf("applyFormats:%v", err)
+	}
+	want := map[string]interface{}{
+		"ap.after ph ac": "02",
+		"ap.after pn":    "99998888",
+		"ap.dob dd":      "07",
+		"ap.dob mm":      "03",
+		"ap.dob yyyy":    "1980",
+		"ap.arrival":     "01/10/2019",
+		"ap.income":      "-1,234,567.50",
+		"ap.assets":      "1.200.000",
+		"ap.ref a":       "ABC",
+		"ap.ref b":       "12345",
+		"ap.id a":        "900",
+		"ap.id b":        "7199254740993",
+		"ap.account a":   "1234",
+		"ap.account b":   "5678901234567890",
+		"ap.name fam":    "SMITH",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyFormats = %v, want %v", got, want)
+	}
+	if _, ok := form["ap.after ph ac"]; ok {
+		t.Errorf("applyFormats modified its input")
+	}
+
+	bad := []map[string]interface{}{
+		{"ap.after phone": "02 9999 8888 1"},
+		{"ap.arrival": "1 Oct 2019"},
+		{"ap.income": "lots"},
+		{"ap.after phone": []string{"02", "9999"}},
+	}
+	for _, form := range bad {
+		if _, err := applyFormats(form, formats); err == nil {
+			t.Errorf("applyFormats(%v) should fail", form)
+		}
+	}
+
+	_, err = applyFormats(map[string]interface{}{"x": "1"}, map[string]FieldFormat{
+		"x": {Split: &SplitFormat{Pattern: "# #", Fields: []string{"a"}}},
+	})
+	if err == nil {
+		t.Errorf("pattern with more parts than fields should fail")
+	}
+}
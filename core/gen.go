@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GenOptions controls the Go source emitted by GenerateGo
+type GenOptions struct {
+	// Package is the package clause of the generated file, default "forms"
+	Package string
+	// TypeName is the name of the top level struct, derived from the pdf
+	// file name when empty
+	TypeName string
+}
+
+// GenerateGo emits a Go source file declaring a struct for the form described
+// by info, ready to be used with Marshal and Unmarshal.
+//
+// Every field group becomes its own struct embedded in the top level type,
+// single fields become members of the top level type. Text fields are strings,
+// checkboxes are bools and radio/choice fields get a named string type with a
+// constant per option, so a template revision that renames or removes a field
+// or option breaks the build instead of the fill.
+func GenerateGo(info *FieldInfo, opts GenOptions) ([]byte, error) {
+	if info == nil {
+		return nil, fmt.Errorf("nil field info")
+	}
+	if len(opts.Package) == 0 {
+		opts.Package = "forms"
+	}
+	if len(opts.TypeName) == 0 {
+		base := filepath.Base(info.PdfPath)
+		opts.TypeName = goIdent("Form " + strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+
+	g := &goGen{types: make(map[string]bool)}
+	g.types[opts.TypeName] = true
+
+	groups := make([]GroupField, len(info.GroupFields))
+	copy(groups, info.GroupFields)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupName < groups[j].GroupName })
+
+	singles := make([]Field, len(info.SingleFields))
+	copy(singles, info.SingleFields)
+	sortFields(singles)
+
+	// top level struct
+	top := &goStruct{name: opts.TypeName, idents: make(map[string]bool)}
+	for _, gf := range groups {
+		fields := make([]Field, len(gf.Fields))
+		copy(fields, gf.Fields)
+		sortFields(fields)
+
+		gs := &goStruct{
+			name:   g.typeName(goIdent(gf.GroupName)),
+			group:  gf.GroupName,
+			idents: make(map[string]bool),
+		}
+		for _, fd := range fields {
+			member := strings.TrimPrefix(fd.FieldName, gf.GroupName)
+			g.addMember(gs, member, fd)
+		}
+		if len(gs.members) == 0 {
+			continue
+		}
+		g.structs = append(g.structs, gs)
+		top.idents[gs.name] = true
+		top.members = append(top.members, goMember{name: gs.name, embedded: true})
+	}
+	for _, fd := range singles {
+		g.addMember(top, fd.FieldName, fd)
+	}
+
+	// write source
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by lipdf gen from %s. DO NOT EDIT.\n\n", filepath.Base(info.PdfPath))
+	fmt.Fprintf(&buf, "package %s\n\n", opts.Package)
+
+	fmt.Fprintf(&buf, "// %s holds the form data of %s.\n", top.name, filepath.Base(info.PdfPath))
+	top.write(&buf)
+	for _, s := range g.structs {
+		fmt.Fprintf(&buf, "// %s holds the fields of group %q.\n", s.name, s.group)
+		s.write(&buf)
+	}
+	for _, e := range g.enums {
+		e.write(&buf)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("fail to format generated source: %v", err)
+	}
+	return src, nil
+}
+
+// generator state, used to keep type names unique
+type goGen struct {
+	types   map[string]bool
+	structs []*goStruct
+	enums   []*goEnum
+}
+
+type goStruct struct {
+	name    string
+	group   string
+	members []goMember
+	idents  map[string]bool
+}
+
+type goMember struct {
+	name     string
+	typ      string
+	tag      string
+	comment  string
+	embedded bool
+}
+
+// named string type with a constant per option
+type goEnum struct {
+	name      string
+	fieldName string
+	options   []string
+}
+
+func (g *goGen) typeName(name string) string {
+	n := name
+	for i := 2; g.types[n]; i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	g.types[n] = true
+	return n
+}
+
+// add a member for the form field fd, member is the field name relative
+// to the struct
+func (g *goGen) addMember(s *goStruct, member string, fd Field) {
+	ident := goIdent(member)
+	for i := 2; s.idents[ident]; i++ {
+		ident = fmt.Sprintf("%s%d", goIdent(member), i)
+	}
+
+	m := goMember{name: ident, typ: "string", comment: fd.FieldType}
+	options := fieldValueOptions(fd)
+	switch fd.FieldType {
+	case "Button":
+		switch len(options) {
+		case 0:
+			// push button, holds no value
+			return
+		case 1:
+			// checkbox
+			m.typ = "bool"
+			if options[0] != checkboxOn {
+				m.tag = fmt.Sprintf("%s,option=%s", fd.FieldName, options[0])
+			}
+		default:
+			// radio group
+			m.typ = g.enum(s.enumName(ident), fd.FieldName, options)
+		}
+	case "Choice":
+		if len(options) > 0 {
+			m.typ = g.enum(s.enumName(ident), fd.FieldName, options)
+		}
+	case "Signature":
+		return
+	}
+	if len(m.tag) == 0 {
+		m.tag = fd.FieldName
+	}
+
+	s.idents[ident] = true
+	s.members = append(s.members, m)
+}
+
+func (g *goGen) enum(name, fieldName string, options []string) string {
+	e := &goEnum{name: g.typeName(name), fieldName: fieldName, options: options}
+	g.enums = append(g.enums, e)
+	return e.name
+}
+
+// name of the option type of a member, members of the top level
+// struct already carry the full field name
+func (s *goStruct) enumName(ident string) string {
+	if len(s.group) == 0 {
+		return ident
+	}
+	return s.name + ident
+}
+
+func (s *goStruct) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "type %s struct {\n", s.name)
+	for _, m := range s.members {
+		if m.embedded {
+			fmt.Fprintf(buf, "\t%s\n", m.name)
+			continue
+		}
+		fmt.Fprintf(buf, "\t%s %s `pdf:%q` // %s\n", m.name, m.typ, m.tag, m.comment)
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+func (e *goEnum) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "// %s is an option of field %q.\n", e.name, e.fieldName)
+	fmt.Fprintf(buf, "type %s string\n\n", e.name)
+	fmt.Fprintf(buf, "// options of %s\n", e.name)
+	fmt.Fprintf(buf, "const (\n")
+	idents := make(map[string]bool)
+	for _, o := range e.options {
+		ident := e.name + goIdent(o)
+		for i := 2; idents[ident]; i++ {
+			ident = fmt.Sprintf("%s%s%d", e.name, goIdent(o), i)
+		}
+		idents[ident] = true
+		fmt.Fprintf(buf, "\t%s %s = %q\n", ident, e.name, o)
+	}
+	fmt.Fprintf(buf, ")\n\n")
+}
+
+// options that can be written as a value, the Off state of
+// buttons is implied
+func fieldValueOptions(fd Field) []string {
+	options := make([]string, 0, len(fd.FieldOptions))
+	for _, o := range fd.FieldOptions {
+		if fd.FieldType == "Button" && o == checkboxOff {
+			continue
+		}
+		if len(o) == 0 {
+			continue
+		}
+		options = append(options, o)
+	}
+	return options
+}
+
+func sortFields(fields []Field) {
+	sort.Slice(fields, func(i, j int) bool { return fields[i].FieldName < fields[j].FieldName })
+}
+
+// goIdent converts a field name such as "ap.marital nev mar" into an
+// exported identifier such as ApMaritalNevMar
+func goIdent(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	ident := b.String()
+	if len(ident) == 0 {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(ident)[0]) {
+		return "F" + ident
+	}
+	return ident
+}
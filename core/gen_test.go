@@ -0,0 +1,58 @@
+package core
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	info := &FieldInfo{
+		PdfPath: "../file/1022.pdf",
+		GroupFields: []GroupField{
+			{
+				GroupName: "ap.marital",
+				Fields: []Field{
+					{FieldType: "Button", FieldName: "ap.marital wid", FieldOptions: []string{"Off", "Yes"}},
+					{FieldType: "Button", FieldName: "ap.marital status", FieldOptions: []string{"Off", "Married", "Never Married"}},
+				},
+			},
+		},
+		SingleFields: []Field{
+			{FieldType: "Text", FieldName: "ap.dob"},
+			{FieldType: "Choice", FieldName: "ap.cit", FieldOptions: []string{"Australia", "Other"}},
+			{FieldType: "Button", FieldName: "ap.reset"},
+			{FieldType: "Signature", FieldName: "ap.sig"},
+		},
+	}
+
+	src, err := GenerateGo(info, GenOptions{Package: "forms"})
+	if err != nil {
+		t.Fatalf("GenerateGo:%v", err)
+	}
+	t.Logf("%s\n", src)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "form.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile:%v", err)
+	}
+
+	// ignore gofmt alignment
+	code := strings.Join(strings.Fields(string(src)), " ")
+	for _, want := range []string{
+		"type Form1022 struct { ApMarital",
+		"Wid bool `pdf:\"ap.marital wid\"`",
+		"Status ApMaritalStatus `pdf:\"ap.marital status\"`",
+		"ApMaritalStatusNeverMarried ApMaritalStatus = \"Never Married\"",
+		"ApDob string `pdf:\"ap.dob\"`",
+		"ApCitAustralia ApCit = \"Australia\"",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("GenerateGo: missing %q", want)
+		}
+	}
+	if strings.Contains(string(src), "ap.reset") || strings.Contains(string(src), "ap.sig") {
+		t.Fatalf("GenerateGo: push button or signature field generated")
+	}
+}
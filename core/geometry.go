@@ -0,0 +1,163 @@
+package core
+
+// Geometry is where the pages and fields of a pdf are shown, for overlays
+// on page images or placing images and signatures
+type Geometry struct {
+	Pages []Page `json:"Pages"`
+	// Fields maps field names to their widgets
+	Fields map[string][]Widget `json:"Fields"`
+}
+
+// Page is the visible area of a page
+type Page struct {
+	// Number is counted from 1
+	Number int `json:"Number"`
+	// Box is the crop box x1, y1, x2, y2 in points
+	Box [4]float64 `json:"Box"`
+	// Rotation is the clockwise rotation in degrees the page is shown with
+	Rotation int `json:"Rotation,omitempty"`
+}
+
+// Widget is a place a field is shown, a field has one widget per
+// appearance such as a radio button
+type Widget struct {
+	// Page is counted from 1, 0 if the widget is on no page
+	Page int `json:"Page"`
+	// Rect is x1, y1, x2, y2 in points from the lower left corner of the
+	// unrotated page, x1 < x2 and y1 < y2
+	Rect [4]float64 `json:"Rect"`
+	// Rotation is the counterclockwise rotation in degrees of the content
+	Rotation int `json:"Rotation,omitempty"`
+	// DA is the default appearance such as "/Helv 12 Tf 0 g", inherited
+	// from the form. Font and FontSize are read from it, a FontSize of 0
+	// means the text is auto sized.
+	DA       string  `json:"DA,omitempty"`
+	Font     string  `json:"Font,omitempty"`
+	FontSize float64 `json:"FontSize,omitempty"`
+}
+
+// ReadGeometry returns the pages and the widgets of the fields of the pdf
+// at pdfPath
+func ReadGeometry(pdfPath string) (*Geometry, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	return doc.geometry()
+}
+
+// fieldGeometry is ReadGeometry, empty if the pdf cannot be read natively
+func fieldGeometry(pdfPath string) *Geometry {
+	g, err := ReadGeometry(pdfPath)
+	if err != nil {
+		return &Geometry{}
+	}
+	return g
+}
+
+func (doc *pdfDocument) geometry() (*Geometry, error) {
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+	g := &Geometry{Pages: make([]Page, len(pages)), Fields: make(map[string][]Widget)}
+	// widgets are found by the annotations of the pages, /P is optional
+	pageOf := make(map[int]int)
+	for i, p := range pages {
+		box := p.dict["CropBox"]
+		if box == nil {
+			box = p.dict["MediaBox"]
+		}
+		rotation, _ := doc.resolve(p.dict["Rotate"]).(int64)
+		g.Pages[i] = Page{Number: i + 1, Box: doc.rect(box), Rotation: normalizeRotation(rotation)}
+		for _, a := range doc.array(p.dict["Annots"]) {
+			if ref, ok := a.(pdfRef); ok {
+				pageOf[ref.num] = i + 1
+			}
+		}
+	}
+
+	da, _ := doc.resolve(doc.dict(doc.catalog()["AcroForm"])["DA"]).(pdfString)
+	for _, f := range doc.fields() {
+		fieldDA := da
+		if s, ok := f.attrs["DA"].(pdfString); ok {
+			fieldDA = s
+		}
+		var widgets []Widget
+		for _, w := range doc.widgets(f) {
+			d := doc.dict(w)
+			wd := Widget{Rect: doc.rect(d["Rect"]), DA: string(fieldDA)}
+			if ref, ok := w.(pdfRef); ok {
+				wd.Page = pageOf[ref.num]
+			}
+			r, _ := doc.resolve(doc.dict(d["MK"])["R"]).(int64)
+			wd.Rotation = normalizeRotation(r)
+			// a widget may have its own appearance
+			if s, ok := doc.resolve(d["DA"]).(pdfString); ok {
+				wd.DA = string(s)
+			}
+			wd.Font, wd.FontSize = parseDA(wd.DA)
+			widgets = append(widgets, wd)
+		}
+		g.Fields[f.name] = widgets
+	}
+	return g, nil
+}
+
+// widgets returns the widget annotations of a field, the field itself if
+// it has no kids
+func (doc *pdfDocument) widgets(f pdfField) []interface{} {
+	kids := doc.array(f.dict["Kids"])
+	if len(kids) == 0 {
+		if f.ref.num == 0 {
+			return []interface{}{f.dict}
+		}
+		return []interface{}{f.ref}
+	}
+	return kids
+}
+
+// rect returns a rectangle with x1 < x2 and y1 < y2
+func (doc *pdfDocument) rect(v interface{}) [4]float64 {
+	var r [4]float64
+	for i, n := range doc.array(v) {
+		if i < 4 {
+			r[i] = pdfFloat(doc.resolve(n))
+		}
+	}
+	if r[2] < r[0] {
+		r[0], r[2] = r[2], r[0]
+	}
+	if r[3] < r[1] {
+		r[1], r[3] = r[3], r[1]
+	}
+	return r
+}
+
+// normalizeRotation returns the rotation in [0, 360)
+func normalizeRotation(r int64) int {
+	return int((r%360 + 360) % 360)
+}
+
+// parseDA returns the font and size of the last Tf operator of a default
+// appearance string
+func parseDA(da string) (font string, size float64) {
+	l := newPdfLexer([]byte(da))
+	var operands []interface{}
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return font, size
+		}
+		op, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+		if op == "Tf" && len(operands) >= 2 {
+			name, _ := operands[len(operands)-2].(pdfName)
+			font, size = string(name), pdfFloat(operands[len(operands)-1])
+		}
+		operands = operands[:0]
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadGeometry(t *testing.T) {
+	w := newPdfWriter("1.7")
+	pages := w.alloc()
+	page1, page2 := w.alloc(), w.alloc()
+	name := w.add(pdfDict{"FT": pdfName("Tx"), "T": pdfString("Name"), "DA": pdfString("/Helv 0 Tf 0 g"),
+		"Type": pdfName("Annot"), "Subtype": pdfName("Widget"), "Rect": pdfArray{int64(236), int64(720), int64(36), 700.5},
+		"MK": pdfDict{"R": int64(-90)}})
+	yes := w.add(pdfDict{"Type": pdfName("Annot"), "Subtype": pdfName("Widget"), "Rect": pdfArray{int64(10), int64(10), int64(20), int64(20)},
+		"DA": pdfString("/ZaDb 9 Tf")})
+	no := w.add(pdfDict{"Type": pdfName("Annot"), "Subtype": pdfName("Widget"), "Rect": pdfArray{int64(30), int64(10), int64(40), int64(20)}})
+	radio := w.add(pdfDict{"FT": pdfName("Btn"), "T": pdfString("Agree"), "Kids": pdfArray{yes, no}})
+	w.writeObject(page1, pdfDict{"Type": pdfName("Page"), "Parent": pages, "Annots": pdfArray{name}})
+	w.writeObject(page2, pdfDict{"Type": pdfName("Page"), "Parent": pages, "Annots": pdfArray{yes, no},
+		"CropBox": pdfArray{int64(10), int64(10), int64(410), int64(610)}, "Rotate": int64(-270)})
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": pdfArray{page1, page2}, "Count": int64(2),
+		"MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)}})
+	form := w.add(pdfDict{"Fields": pdfArray{name, radio}, "DA": pdfString("/Helv 12 Tf 0 0 1 rg")})
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages, "AcroForm": form})
+	path := filepath.Join(t.TempDir(), "form.pdf")
+	if err := w.writeFile(path, pdfDict{"Root": catalog}); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := ReadGeometry(path)
+	if err != nil {
+		t.Fatalf("ReadGeometry:%v", err)
+	}
+	want := &Geometry{
+		Pages: []Page{
+			{Number: 1, Box: [4]float64{0, 0, 612, 792}},
+			{Number: 2, Box: [4]float64{10, 10, 410, 610}, Rotation: 90},
+		},
+		Fields: map[string][]Widget{
+			"Name": {{Page: 1, Rect: [4]float64{36, 700.5, 236, 720}, Rotation: 270, DA: "/Helv 0 Tf 0 g", Font: "Helv"}},
+			"Agree": {
+				{Page: 2, Rect: [4]float64{10, 10, 20, 20}, DA: "/ZaDb 9 Tf", Font: "ZaDb", FontSize: 9},
+				{Page: 2, Rect: [4]float64{30, 10, 40, 20}, DA: "/Helv 12 Tf 0 0 1 rg", Font: "Helv", FontSize: 12},
+			},
+		},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("ReadGeometry = %+v, want %+v", g, want)
+	}
+}
+
+func TestParseDA(t *testing.T) {
+	for da, want := range map[string]struct {
+		font string
+		size float64
+	}{
+		"/Helv 12 Tf 0 g":           {"Helv", 12},
+		"0 g /F1 9.5 Tf /F2 8 Tf":   {"F2", 8},
+		"/Cour 0 Tf":                {"Cour", 0},
+		"0 0 1 rg":                  {"", 0},
+		"":                          {"", 0},
+		"/Helv 12 Tf (unterminated": {"Helv", 12},
+	} {
+		font, size := parseDA(da)
+		if font != want.font || size != want.size {
+			t.Errorf("parseDA(%q) = %q, %v", da, font, size)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+)
+
+// Image places a JPEG or PNG image in a pdf, such as a passport photo. The
+// image is scaled to fit its box with the aspect ratio kept and centered.
+type Image struct {
+	Data []byte
+	// Field is a push button field showing the image, leave it empty to
+	// draw the image at Rect on Page
+	Field string
+	// Page is counted from 1, Rect is x1, y1, x2, y2 in points from the
+	// lower left corner of the page
+	Page int
+	Rect [4]float64
+}
+
+// AddImagesNative places the images in the pdf at pdfPath and writes the
+// result to destPath. The images are appended as an incremental update.
+func AddImagesNative(pdfPath, destPath string, images []Image) error {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	err = doc.addImages(u, images)
+	if err != nil {
+		return err
+	}
+	return u.writeFile(destPath, nil)
+}
+
+// addImages adds the images to the update
+func (doc *pdfDocument) addImages(u *pdfUpdate, images []Image) error {
+	var fields map[string]pdfField
+	var pages []pdfPage
+	for i, img := range images {
+		xobj, width, height, err := imageXObject(u, img.Data)
+		if err != nil {
+			return fmt.Errorf("image %d: %v", i+1, err)
+		}
+
+		if len(img.Field) > 0 {
+			if fields == nil {
+				fields = make(map[string]pdfField)
+				for _, f := range doc.fields() {
+					fields[f.name] = f
+				}
+			}
+			err = doc.setButtonImage(u, fields[img.Field], img.Field, xobj, width, height)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if pages == nil {
+			pages, err = doc.pages()
+			if err != nil {
+				return err
+			}
+		}
+		if img.Page < 1 || img.Page > len(pages) {
+			return fmt.Errorf("image %d: no page %d", i+1, img.Page)
+		}
+		x, y, w, h := fitImage(width, height, img.Rect)
+		if w <= 0 || h <= 0 {
+			return fmt.Errorf("image %d: empty rectangle", i+1)
+		}
+		err = doc.drawOnPage(u, pages[img.Page-1], xobj, x, y, w, h)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setButtonImage shows the image as the normal appearance and the icon of
+// every widget of a push button
+func (doc *pdfDocument) setButtonImage(u *pdfUpdate, f pdfField, name string, xobj pdfRef, width, height int) error {
+	if f.dict == nil {
+		return fmt.Errorf("no field %s", name)
+	}
+	flags, _ := f.attrs["Ff"].(int64)
+	if f.attrs["FT"] != pdfName("Btn") || flags&flagPushButton == 0 {
+		return fmt.Errorf("field %s is not a push button", name)
+	}
+	for _, w := range doc.widgets(f) {
+		ref, ok := w.(pdfRef)
+		if !ok {
+			return fmt.Errorf("field %s is not an indirect object", name)
+		}
+		widget := pdfDict{}
+		for k, v := range doc.dict(ref) {
+			widget[k] = v
+		}
+		r := doc.rect(widget["Rect"])
+		bw, bh := r[2]-r[0], r[3]-r[1]
+		x, y, w, h := fitImage(width, height, [4]float64{0, 0, bw, bh})
+		appearance := u.add(pdfStream{dict: pdfDict{
+			"Type":      pdfName("XObject"),
+			"Subtype":   pdfName("Form"),
+			"BBox":      pdfArray{int64(0), int64(0), bw, bh},
+			"Resources": pdfDict{"XObject": pdfDict{"Im0": xobj}},
+		}, data: []byte(drawImage("Im0", x, y, w, h))})
+
+		widget["AP"] = pdfDict{"N": appearance}
+		mk := pdfDict{}
+		for k, v := range doc.dict(widget["MK"]) {
+			mk[k] = v
+		}
+		// icon only, viewers redrawing the button keep the image
+		mk["I"] = appearance
+		mk["TP"] = int64(1)
+		widget["MK"] = mk
+		u.set(ref.num, widget)
+	}
+	return nil
+}
+
+// drawOnPage appends content drawing the image to the page, the existing
+// content is wrapped in q/Q so its graphics state does not leak
+func (doc *pdfDocument) drawOnPage(u *pdfUpdate, p pdfPage, xobj pdfRef, x, y, w, h float64) error {
+	page := pdfDict{}
+	for k, v := range doc.dict(p.ref) {
+		page[k] = v
+	}
+
+	// resources may be inherited, the page gets its own copy. The page may
+	// have been updated by an earlier image, p holds the original.
+	inherited := page["Resources"]
+	if inherited == nil {
+		inherited = p.dict["Resources"]
+	}
+	resources := pdfDict{}
+	for k, v := range doc.dict(inherited) {
+		resources[k] = v
+	}
+	xobjects := pdfDict{}
+	for k, v := range doc.dict(resources["XObject"]) {
+		xobjects[k] = v
+	}
+	name := pdfName("LiImg1")
+	for i := 2; xobjects[name] != nil; i++ {
+		name = pdfName(fmt.Sprintf("LiImg%d", i))
+	}
+	xobjects[name] = xobj
+	resources["XObject"] = xobjects
+	page["Resources"] = resources
+
+	var contents pdfArray
+	switch c := page["Contents"].(type) {
+	case pdfRef:
+		if _, ok := doc.resolve(c).(pdfArray); ok {
+			contents = append(contents, doc.array(c)...)
+		} else {
+			contents = pdfArray{c}
+		}
+	case pdfArray:
+		contents = append(contents, c...)
+	}
+	if len(contents) > 0 {
+		contents = append(pdfArray{u.add(pdfStream{dict: pdfDict{}, data: []byte("q\n")})}, contents...)
+		contents = append(contents, u.add(pdfStream{dict: pdfDict{}, data: []byte("Q\n" + drawImage(name, x, y, w, h))}))
+	} else {
+		contents = pdfArray{u.add(pdfStream{dict: pdfDict{}, data: []byte(drawImage(name, x, y, w, h))})}
+	}
+	page["Contents"] = contents
+	u.set(p.ref.num, page)
+	return nil
+}
+
+// drawImage returns content drawing the image xobject name into the box
+func drawImage(name pdfName, x, y, w, h float64) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "q\n%s 0 0 %s %s %s cm\n", pdfNumber(w), pdfNumber(h), pdfNumber(x), pdfNumber(y))
+	writePdfName(&buf, name)
+	buf.WriteString(" Do\nQ\n")
+	return buf.String()
+}
+
+// fitImage scales an image of width x height pixels into box keeping the
+// aspect ratio, the result is centered
+func fitImage(width, height int, box [4]float64) (x, y, w, h float64) {
+	x1, y1, x2, y2 := box[0], box[1], box[2], box[3]
+	if x2 < x1 {
+		x1, x2 = x2, x1
+	}
+	if y2 < y1 {
+		y1, y2 = y2, y1
+	}
+	bw, bh := x2-x1, y2-y1
+	if width <= 0 || height <= 0 || bw <= 0 || bh <= 0 {
+		return x1, y1, 0, 0
+	}
+	scale := bw / float64(width)
+	if s := bh / float64(height); s < scale {
+		scale = s
+	}
+	w, h = float64(width)*scale, float64(height)*scale
+	return x1 + (bw-w)/2, y1 + (bh-h)/2, w, h
+}
+
+// imageXObject adds a JPEG or PNG as an image xobject. JPEGs are embedded
+// as they are, PNGs are recompressed with their alpha channel as soft mask.
+func imageXObject(u *pdfUpdate, data []byte) (ref pdfRef, width, height int, err error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return pdfRef{}, 0, 0, fmt.Errorf("invalid jpeg: %v", err)
+		}
+		dict := pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            int64(cfg.Width),
+			"Height":           int64(cfg.Height),
+			"BitsPerComponent": int64(8),
+			"Filter":           pdfName("DCTDecode"),
+			"ColorSpace":       pdfName("DeviceRGB"),
+		}
+		switch cfg.ColorModel {
+		case color.GrayModel:
+			dict["ColorSpace"] = pdfName("DeviceGray")
+		case color.CMYKModel:
+			// Adobe CMYK jpegs are stored inverted
+			dict["ColorSpace"] = pdfName("DeviceCMYK")
+			dict["Decode"] = pdfArray{int64(1), int64(0), int64(1), int64(0), int64(1), int64(0), int64(1), int64(0)}
+		}
+		return u.add(pdfStream{dict: dict, data: data}), cfg.Width, cfg.Height, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return pdfRef{}, 0, 0, fmt.Errorf("invalid png: %v", err)
+		}
+		b := img.Bounds()
+		width, height = b.Dx(), b.Dy()
+		gray := img.ColorModel() == color.GrayModel || img.ColorModel() == color.Gray16Model
+		var pixels, alpha []byte
+		opaque := true
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if gray {
+					pixels = append(pixels, c.R)
+				} else {
+					pixels = append(pixels, c.R, c.G, c.B)
+				}
+				alpha = append(alpha, c.A)
+				if c.A != 0xff {
+					opaque = false
+				}
+			}
+		}
+		dict := pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            int64(width),
+			"Height":           int64(height),
+			"BitsPerComponent": int64(8),
+			"ColorSpace":       pdfName("DeviceRGB"),
+		}
+		if gray {
+			dict["ColorSpace"] = pdfName("DeviceGray")
+		}
+		if !opaque {
+			dict["SMask"] = u.add(flateStream(pdfDict{
+				"Type":             pdfName("XObject"),
+				"Subtype":          pdfName("Image"),
+				"Width":            int64(width),
+				"Height":           int64(height),
+				"BitsPerComponent": int64(8),
+				"ColorSpace":       pdfName("DeviceGray"),
+			}, alpha))
+		}
+		return u.add(flateStream(dict, pixels)), width, height, nil
+	}
+	return pdfRef{}, 0, 0, fmt.Errorf("unsupported image format, use jpeg or png")
+}
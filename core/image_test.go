@@ -0,0 +1,197 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeButtonPdf writes a form with a text field and a push button of
+// 100 x 120 points
+func writeButtonPdf(t *testing.T, path string) {
+	w := newPdfWriter("1.7")
+	pages := w.alloc()
+	text := w.add(pdfDict{"FT": pdfName("Tx"), "T": pdfString("Name"), "Type": pdfName("Annot"), "Subtype": pdfName("Widget"),
+		"Rect": pdfArray{int64(36), int64(700), int64(236), int64(720)}})
+	photo := w.add(pdfDict{"FT": pdfName("Btn"), "Ff": int64(flagPushButton), "T": pdfString("Photo"),
+		"Type": pdfName("Annot"), "Subtype": pdfName("Widget"),
+		"Rect": pdfArray{int64(400), int64(600), int64(500), int64(720)}, "MK": pdfDict{"BG": pdfArray{int64(1)}}})
+	contents := w.add(pdfStream{dict: pdfDict{}, data: []byte("0 0 1 rg\n")})
+	page := w.add(pdfDict{"Type": pdfName("Page"), "Parent": pages, "MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)},
+		"Contents": contents, "Annots": pdfArray{text, photo}})
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": pdfArray{page}, "Count": int64(1),
+		"Resources": pdfDict{"XObject": pdfDict{"LiImg1": pdfDict{}}}})
+	form := w.add(pdfDict{"Fields": pdfArray{text, photo}})
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages, "AcroForm": form})
+	err := w.writeFile(path, pdfDict{"Root": catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testImages returns a 40 x 20 JPEG and a 10 x 10 PNG with transparency
+func testImages(t *testing.T) (jpg, pngData []byte) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg = append([]byte(nil), buf.Bytes()...)
+
+	img = image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.Set(1, 1, color.NRGBA{R: 0xff, A: 0x80})
+	buf.Reset()
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return jpg, buf.Bytes()
+}
+
+func TestAddImages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "form.pdf")
+	writeButtonPdf(t, path)
+	jpg, pngData := testImages(t)
+
+	dest := filepath.Join(dir, "filled.pdf")
+	err := FillFormNative(context.Background(), map[string]interface{}{"Name": "Li Lei"}, path, dest, FillOptions{Images: []Image{
+		{Data: jpg, Field: "Photo"},
+		{Data: pngData, Page: 1, Rect: [4]float64{300, 100, 200, 300}},
+	}})
+	if err != nil {
+		t.Fatalf("FillFormNative:%v", err)
+	}
+	doc, err := readPdfFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var photo pdfDict
+	for _, f := range doc.fields() {
+		if f.name == "Photo" {
+			photo = f.dict
+		}
+	}
+	appearance, _ := doc.resolve(doc.dict(photo["AP"])["N"]).(pdfStream)
+	mk := doc.dict(photo["MK"])
+	if appearance.dict == nil || mk["I"] != doc.dict(photo["AP"])["N"] || mk["TP"] != int64(1) || mk["BG"] == nil {
+		t.Fatalf("Photo = %v", photo)
+	}
+	// 40 x 20 fitted into 100 x 120
+	if content := string(appearance.data); !strings.Contains(content, "100 0 0 50 0 35 cm") {
+		t.Errorf("button content = %q", content)
+	}
+	jpgObj, _ := doc.resolve(doc.dict(doc.dict(appearance.dict["Resources"])["XObject"])["Im0"]).(pdfStream)
+	if jpgObj.dict["Filter"] != pdfName("DCTDecode") || !bytes.Equal(jpgObj.data, jpg) {
+		t.Errorf("jpeg xobject = %v", jpgObj)
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := pages[0].dict
+	contents := doc.array(page["Contents"])
+	if len(contents) != 3 {
+		t.Fatalf("page contents = %v", contents)
+	}
+	last, err := doc.decodeStream(doc.resolve(contents[2]).(pdfStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 x 10 centred in 100 x 200, under a name not taken by the page
+	if content := string(last); !strings.HasPrefix(content, "Q\n") || !strings.Contains(content, "100 0 0 100 200 150 cm\n/LiImg2 Do") {
+		t.Errorf("page content = %q", content)
+	}
+	xobjects := doc.dict(doc.dict(page["Resources"])["XObject"])
+	pngObj, _ := doc.resolve(xobjects["LiImg2"]).(pdfStream)
+	if xobjects["LiImg1"] == nil || pngObj.dict["ColorSpace"] != pdfName("DeviceRGB") || pngObj.dict["SMask"] == nil {
+		t.Errorf("png xobject = %v", pngObj)
+	}
+
+	for name, img := range map[string]Image{
+		"text field":   {Data: jpg, Field: "Name"},
+		"missing page": {Data: jpg, Page: 2, Rect: [4]float64{0, 0, 10, 10}},
+		"gif":          {Data: []byte("GIF89a"), Page: 1, Rect: [4]float64{0, 0, 10, 10}},
+	} {
+		err = AddImagesNative(path, dest, []Image{img})
+		if err == nil {
+			t.Errorf("AddImagesNative placed the %s image", name)
+		}
+	}
+	err = FillFormFile(nil, path, dest, FillOptions{Flatten: true, Images: []Image{{Data: jpg, Field: "Photo"}}})
+	if err == nil {
+		t.Errorf("FillFormFile placed an image in a flattened field")
+	}
+}
+
+func TestAddImagesSamePage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "form.pdf")
+	writeButtonPdf(t, path)
+	jpg, pngData := testImages(t)
+
+	dest := filepath.Join(dir, "images.pdf")
+	err := AddImagesNative(path, dest, []Image{
+		{Data: jpg, Page: 1, Rect: [4]float64{0, 0, 40, 20}},
+		{Data: pngData, Page: 1, Rect: [4]float64{100, 100, 110, 110}},
+	})
+	if err != nil {
+		t.Fatalf("AddImagesNative:%v", err)
+	}
+	doc, err := readPdfFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := pages[0].dict
+	// every image keeps its own name, LiImg1 is taken by the inherited
+	// resources
+	xobjects := doc.dict(doc.dict(page["Resources"])["XObject"])
+	jpgObj, _ := doc.resolve(xobjects["LiImg2"]).(pdfStream)
+	pngObj, _ := doc.resolve(xobjects["LiImg3"]).(pdfStream)
+	if xobjects["LiImg1"] == nil || jpgObj.dict["Filter"] != pdfName("DCTDecode") || pngObj.dict["SMask"] == nil {
+		t.Errorf("xobjects = %v", xobjects)
+	}
+	var content []byte
+	for _, c := range doc.array(page["Contents"]) {
+		data, err := doc.decodeStream(doc.resolve(c).(pdfStream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, data...)
+	}
+	if !bytes.Contains(content, []byte("/LiImg2 Do")) || !bytes.Contains(content, []byte("/LiImg3 Do")) {
+		t.Errorf("page content = %q", content)
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	for _, c := range []struct {
+		width, height int
+		box           [4]float64
+		want          [4]float64
+	}{
+		{100, 50, [4]float64{0, 0, 200, 200}, [4]float64{0, 50, 200, 100}},
+		{50, 100, [4]float64{10, 10, 210, 110}, [4]float64{85, 10, 50, 100}},
+		{10, 10, [4]float64{100, 100, 0, 0}, [4]float64{0, 0, 100, 100}},
+		{10, 10, [4]float64{0, 0, 0, 10}, [4]float64{0, 0, 0, 0}},
+	} {
+		x, y, w, h := fitImage(c.width, c.height, c.box)
+		if got := [4]float64{x, y, w, h}; got != c.want {
+			t.Errorf("fitImage(%d, %d, %v) = %v, want %v", c.width, c.height, c.box, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package lipdftest fills forms in tests and compares the values read back
+// from the filled pdf with golden json files:
+//
+//	func TestFill1022(t *testing.T) {
+//		form := map[string]interface{}{"ap.dob": "01/01/1980"}
+//		lipdftest.FillGolden(t, &lipdftest.Backend{}, "testdata/1022.pdf", form, core.FillOptions{}, "testdata/1022.golden.json")
+//	}
+//
+// Run go test -update to write the golden files from the current output.
+// The values are read back without pdftk, and Backend fills without pdftk
+// too, so tests using it run where pdftk is not installed. A nil backend
+// fills with core.Pdftk.
+package lipdftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+func init() {
+	// the test binary may define -update itself
+	if flag.Lookup("update") == nil {
+		flag.Bool("update", false, "write the golden files of lipdftest")
+	}
+}
+
+// updating reports whether -update is set
+func updating() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String() == "true"
+	}
+	update, _ := g.Get().(bool)
+	return update
+}
+
+// FillValues fills form into the pdf at pdfPath with b, core.Pdftk if b is
+// nil, and returns the field values of the result. The filled pdf is
+// written to a temporary directory of t.
+func FillValues(t testing.TB, b core.Backend, pdfPath string, form map[string]interface{}, opts core.FillOptions) map[string]interface{} {
+	t.Helper()
+	if b == nil {
+		b = core.Pdftk
+	}
+	dest := filepath.Join(t.TempDir(), "filled.pdf")
+	err := b.FillForm(context.Background(), form, pdfPath, dest, opts)
+	if err != nil {
+		t.Fatalf("fill %s: %v", pdfPath, err)
+	}
+	values, err := core.FormValuesNative(dest)
+	if err != nil {
+		t.Fatalf("read values of filled %s: %v", pdfPath, err)
+	}
+	return values
+}
+
+// FillGolden fills like FillValues and compares the values with the golden
+// file at goldenPath
+func FillGolden(t testing.TB, b core.Backend, pdfPath string, form map[string]interface{}, opts core.FillOptions, goldenPath string) {
+	t.Helper()
+	Golden(t, goldenPath, FillValues(t, b, pdfPath, form, opts))
+}
+
+// Golden compares got as indented json with the file at path, differing
+// fields are reported for maps of field values. With -update the file is
+// written instead.
+func Golden(t testing.TB, path string, got interface{}) {
+	t.Helper()
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal %T: %v", got, err)
+	}
+	data = append(data, '\n')
+	if updating() {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v, run go test -update to create it", err)
+	}
+	if bytes.Equal(data, want) {
+		return
+	}
+	var gotValues, wantValues map[string]interface{}
+	if json.Unmarshal(data, &gotValues) == nil && json.Unmarshal(want, &wantValues) == nil {
+		changes := core.DiffValues(wantValues, gotValues)
+		for _, c := range changes {
+			t.Errorf("%s: %v", path, c)
+		}
+		if len(changes) == 0 {
+			t.Errorf("%s: output differs in formatting, run go test -update", path)
+		}
+		return
+	}
+	t.Errorf("%s differs, run go test -update\ngot:\n%s\nwant:\n%s", path, data, want)
+}
+
+// Fill is a fill recorded by Backend
+type Fill struct {
+	Form    map[string]interface{}
+	PdfPath string
+	Opts    core.FillOptions
+}
+
+// Backend is a core.Backend for tests. It fills with core.Native, so
+// without pdftk, and fails fills with Flatten, DropXFA, Encryption or
+// Password, which need pdftk. Every fill is recorded with its original
+// options. The zero value is ready to use and safe for concurrent fills.
+type Backend struct {
+	// Err fails every fill if set
+	Err error
+
+	mu    sync.Mutex
+	fills []Fill
+}
+
+func (b *Backend) FillForm(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts core.FillOptions) error {
+	b.mu.Lock()
+	b.fills = append(b.fills, Fill{Form: form, PdfPath: pdfPath, Opts: opts})
+	b.mu.Unlock()
+	if b.Err != nil {
+		return b.Err
+	}
+	if opts.Flatten || opts.DropXFA || opts.Encryption != nil || len(opts.Password) > 0 {
+		return fmt.Errorf("lipdftest: Flatten, DropXFA, Encryption and Password need pdftk, fill with a nil backend")
+	}
+	return core.Native.FillForm(ctx, form, pdfPath, destPath, opts)
+}
+
+// Fills returns the fills so far in call order
+func (b *Backend) Fills() []Fill {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Fill(nil), b.fills...)
+}
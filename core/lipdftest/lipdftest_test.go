@@ -0,0 +1,76 @@
+package lipdftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+const form1022 = "../../file/1022.pdf"
+
+func TestFillGolden(t *testing.T) {
+	b := &Backend{}
+	form := map[string]interface{}{
+		"ap.name fam":      "Li",
+		"ap.name giv":      "Lei",
+		"ap.dob":           "01/01/1980",
+		"ap.marital mar":   "Yes",
+		"not a 1022 field": "ignored",
+	}
+	opts := core.FillOptions{Info: map[string]string{"CaseID": "A1"}}
+	FillGolden(t, b, form1022, form, opts, "testdata/1022.golden.json")
+
+	fills := b.Fills()
+	if len(fills) != 1 || fills[0].PdfPath != form1022 || fills[0].Opts.Info["CaseID"] != "A1" || fills[0].Form["ap.dob"] != "01/01/1980" {
+		t.Errorf("Fills = %+v", fills)
+	}
+}
+
+// recorder collects the errors of a test
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestGoldenMismatch(t *testing.T) {
+	r := &recorder{TB: t}
+	Golden(r, "testdata/1022.golden.json", map[string]interface{}{"ap.dob": "02/01/1980"})
+	joined := strings.Join(r.errors, "\n")
+	if !strings.Contains(joined, `ap.dob: "01/01/1980" -> "02/01/1980"`) || !strings.Contains(joined, `ap.name fam: removed "Li"`) {
+		t.Errorf("Golden errors = %s", joined)
+	}
+
+	r = &recorder{TB: t}
+	Golden(r, "testdata/1022.golden.json", []string{"not", "values"})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "run go test -update") {
+		t.Errorf("Golden errors = %q", r.errors)
+	}
+}
+
+func TestBackendErr(t *testing.T) {
+	b := &Backend{Err: errors.New("pdftk crashed")}
+	err := b.FillForm(context.Background(), nil, form1022, filepath.Join(t.TempDir(), "out.pdf"), core.FillOptions{})
+	if err != b.Err || len(b.Fills()) != 1 {
+		t.Errorf("FillForm = %v, fills %d", err, len(b.Fills()))
+	}
+
+	// options needing pdftk are not silently dropped
+	b = &Backend{}
+	for _, opts := range []core.FillOptions{{Flatten: true}, {DropXFA: true}, {Encryption: &core.Encryption{OwnerPassword: "secret"}}, {Password: "secret"}} {
+		err = b.FillForm(context.Background(), nil, form1022, filepath.Join(t.TempDir(), "out.pdf"), opts)
+		if err == nil || !strings.Contains(err.Error(), "need pdftk") {
+			t.Errorf("FillForm with %+v = %v", opts, err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// FieldMapping translates the keys of a domain data model to pdf field
+// names, so that callers keep filling "applicant.birthCountry" while form
+// revisions rename "ap.birth cntry". It is loaded from a yaml or json file:
+//
+//	fields:
+//	  applicant.birthCountry: ap.birth cntry
+//	  applicant.familyName:
+//	    field: ap.name fam
+//	    transform: [trim, upper]
+//	  applicant.phone:
+//	    fields: [ap.after pn, ap.off ph]
+//	  applicant.dateOfBirth:
+//	    field: ap.dob
+//	    parseDate: "2006-01-02"
+//	    formatDate: 02/01/2006
+//	  applicant.married:
+//	    field: ap.marital mar
+//	    values: {"true": "Yes", "false": "Off"}
+//	formats:
+//	  ap.after phone:
+//	    split:
+//	      pattern: "## ########"
+//	      fields: [ap.after ph ac, ap.after pn]
+//
+// Formats are applied to the translated keys, see FieldFormat. Nested data
+// such as {"applicant": {"familyName": "Smith"}} is addressed by the dotted
+// path of its keys.
+type FieldMapping struct {
+	Fields map[string]MappingRule `json:"fields"`
+	// PassThrough copies keys without a rule unchanged, by default they
+	// are dropped
+	PassThrough bool `json:"passThrough,omitempty"`
+	// Formats formats the values of the translated keys
+	Formats map[string]FieldFormat `json:"formats,omitempty"`
+}
+
+// MappingRule writes one domain value to one or more pdf fields
+type MappingRule struct {
+	// Field is the target pdf field, Fields lists several targets
+	// receiving the same value
+	Field  string   `json:"field,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	// Values translates values, such as "true" to a checkbox "Yes",
+	// values without an entry are kept
+	Values map[string]string `json:"values,omitempty"`
+	// Transform is applied in order: trim, upper, lower or title
+	Transform []string `json:"transform,omitempty"`
+	// ParseDate is the layout of a date value, which is written with the
+	// FormatDate layout
+	ParseDate  string `json:"parseDate,omitempty"`
+	FormatDate string `json:"formatDate,omitempty"`
+}
+
+// UnmarshalJSON accepts a field name or a list of field names as shorthand
+func (r *MappingRule) UnmarshalJSON(data []byte) error {
+	var field string
+	if err := json.Unmarshal(data, &field); err == nil {
+		*r = MappingRule{Field: field}
+		return nil
+	}
+	var fields []string
+	if err := json.Unmarshal(data, &fields); err == nil {
+		*r = MappingRule{Fields: fields}
+		return nil
+	}
+	type plain MappingRule
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// LoadFieldMapping reads a mapping file, yaml when the extension is .yaml
+// or .yml, json otherwise
+func LoadFieldMapping(path string) (*FieldMapping, error) {
+	var m FieldMapping
+	err := loadConfig(path, &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, m.check()
+}
+
+func (m *FieldMapping) check() error {
+	for key, r := range m.Fields {
+		if len(r.targets()) == 0 {
+			return fmt.Errorf("mapping %s: no target field", key)
+		}
+		if err := checkConversion(r.Transform, r.ParseDate, r.FormatDate); err != nil {
+			return fmt.Errorf("mapping %s: %v", key, err)
+		}
+	}
+	for key, f := range m.Formats {
+		if err := f.check(); err != nil {
+			return fmt.Errorf("format %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// pdf fields written by a rule
+func (r MappingRule) targets() []string {
+	if len(r.Field) > 0 {
+		return append([]string{r.Field}, r.Fields...)
+	}
+	return r.Fields
+}
+
+// Apply translates domain data to form data keyed by pdf field names
+func (m *FieldMapping) Apply(data map[string]interface{}) (map[string]interface{}, error) {
+	data = flattenFormData(data)
+	form := make(map[string]interface{}, len(data))
+	for _, key := range sortedKeys(data) {
+		value := data[key]
+		r, ok := m.Fields[key]
+		if !ok {
+			if m.PassThrough {
+				form[key] = value
+			}
+			continue
+		}
+
+		v, err := r.apply(value)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %v", key, err)
+		}
+		for _, field := range r.targets() {
+			form[field] = v
+		}
+	}
+	return applyFormats(form, m.Formats)
+}
+
+func (r MappingRule) apply(value interface{}) (interface{}, error) {
+	list, multi := formValueList(value)
+	values := make([]string, len(list))
+	for i, v := range list {
+		if t, ok := r.Values[v]; ok {
+			v = t
+		}
+		var err error
+		values[i], err = convertValue(v, r.Transform, r.ParseDate, r.FormatDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if multi {
+		return values, nil
+	}
+	return values[0], nil
+}
+
+// MappingWarning reports a mapping rule whose target is not a field of the
+// template, usually because a form revision renamed it
+type MappingWarning struct {
+	Key   string `json:"Key"`
+	Field string `json:"Field"`
+	// Suggestion is the likely new name of a renamed field, see
+	// TemplateDiff.SuggestRenames
+	Suggestion string `json:"Suggestion,omitempty"`
+}
+
+func (w MappingWarning) String() string {
+	if len(w.Suggestion) > 0 {
+		return fmt.Sprintf("mapping %s: field %q not found in template, likely renamed to %q", w.Key, w.Field, w.Suggestion)
+	}
+	return fmt.Sprintf("mapping %s: field %q not found in template", w.Key, w.Field)
+}
+
+// Check lists the mapping targets missing from fields, such as the result
+// of Template.Fields
+func (m *FieldMapping) Check(fields map[string]Field) []MappingWarning {
+	var warnings []MappingWarning
+	for key, r := range m.Fields {
+		for _, field := range r.targets() {
+			if _, ok := fields[field]; !ok {
+				warnings = append(warnings, MappingWarning{Key: key, Field: field})
+			}
+		}
+	}
+	for key, f := range m.Formats {
+		if f.Split == nil {
+			continue
+		}
+		for _, field := range f.Split.Fields {
+			if _, ok := fields[field]; !ok {
+				warnings = append(warnings, MappingWarning{Key: key, Field: field})
+			}
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Key != warnings[j].Key {
+			return warnings[i].Key < warnings[j].Key
+		}
+		return warnings[i].Field < warnings[j].Field
+	})
+	return warnings
+}
+
+// flattenFormData turns nested objects into dotted keys,
+// {"ap": {"dob": "x"}} becomes {"ap.dob": "x"}
+func flattenFormData(data map[string]interface{}) map[string]interface{} {
+	nested := false
+	for _, v := range data {
+		if _, ok := v.(map[string]interface{}); ok {
+			nested = true
+			break
+		}
+	}
+	if !nested {
+		return data
+	}
+	flat := make(map[string]interface{}, len(data))
+	flattenInto(flat, "", data)
+	return flat
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, data map[string]interface{}) {
+	for k, v := range data {
+		key := joinFieldName(prefix, k)
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenInto(flat, key, m)
+			continue
+		}
+		flat[key] = v
+	}
+}
+
+// CheckFieldMapping lists the mapping targets missing from the form fields of
+// the pdf at pdfPath
+func CheckFieldMapping(m *FieldMapping, pdfPath string) ([]MappingWarning, error) {
+	fields, err := pdfFormFields(context.Background(), pdfPath, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.Check(fields), nil
+}
+
+// prepareForm applies the mapping and formats of the options to form and
+// clears them, so that they are applied once when fills are passed on to a
+// Backend
+func (opts *FillOptions) prepareForm(form map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	if opts.Mapping != nil {
+		form, err = opts.Mapping.Apply(form)
+		if err != nil {
+			return nil, err
+		}
+		opts.Mapping = nil
+	}
+	form, err = applyFormats(form, opts.Formats)
+	if err != nil {
+		return nil, err
+	}
+	opts.Formats = nil
+	return form, nil
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testMappingYaml = `# 1022 revision 2019
+fields:
+  applicant.birthCountry: ap.birth cntry
+  applicant.familyName:
+    field: ap.name fam
+    transform: [trim, upper]
+  applicant.phone:
+    fields:
+      - ap.after pn
+      - ap.off ph
+  applicant.dateOfBirth:
+    field: ap.dob
+    parseDate: "2006-01-02"
+    formatDate: 02/01/2006
+  applicant.married:
+    field: ap.marital mar
+    values:
+      "true": "Yes"
+      "false": "Off"
+  applicant.oldField: ap.removed   # renamed in 2019
+`
+
+func TestLoadFieldMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapping-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "1022.yaml")
+	err = ioutil.WriteFile(path, []byte(testMappingYaml), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadFieldMapping(path)
+	if err != nil {
+		t.Fatalf("LoadFieldMapping:%v", err)
+	}
+
+	var data map[string]interface{}
+	err = json.Unmarshal([]byte(`{
+		"applicant": {
+			"birthCountry": "Australia",
+			"familyName": " smith ",
+			"phone": "0400 000 000",
+			"dateOfBirth": "1980-03-07",
+			"married": "true",
+			"unmapped": "x"
+		}
+	}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := m.Apply(data)
+	if err != nil {
+		t.Fatalf("Apply:%v", err)
+	}
+	want := map[string]interface{}{
+		"ap.birth cntry": "Australia",
+		"ap.name fam":    "SMITH",
+		"ap.after pn":    "0400 000 000",
+		"ap.off ph":      "0400 000 000",
+		"ap.dob":         "07/03/1980",
+		"ap.marital mar": "Yes",
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("Apply = %v, want %v", form, want)
+	}
+
+	fields := map[string]Field{}
+	for _, name := range []string{"ap.birth cntry", "ap.name fam", "ap.after pn", "ap.off ph", "ap.dob", "ap.marital mar"} {
+		fields[name] = Field{FieldName: name}
+	}
+	warnings := m.Check(fields)
+	if len(warnings) != 1 || warnings[0] != (MappingWarning{Key: "applicant.oldField", Field: "ap.removed"}) {
+		t.Errorf("Check = %v", warnings)
+	}
+
+	_, err = m.Apply(map[string]interface{}{"applicant.dateOfBirth": "7 March"})
+	if err == nil {
+		t.Errorf("Apply with a bad date should fail")
+	}
+}
+
+func TestYamlToJSON(t *testing.T) {
+	tests := []struct {
+		yaml string
+		json string
+	}{
+		{"a: 1\nb: 'it''s'\nc: \"x # y\" # comment\n", `{"a":"1","b":"it's","c":"x # y"}`},
+		{"list:\n- a\n- b: c\n  d: e\n- [x, 'y, z']\n", `{"list":["a",{"b":"c","d":"e"},["x","y, z"]]}`},
+		{"a:\n  b:\n    c: true\n  d: ~\n", `{"a":{"b":{"c":true},"d":null}}`},
+		{"url: http://x.org/a\n\"ap.birth cntry\": y\n", `{"ap.birth cntry":"y","url":"http://x.org/a"}`},
+		{"a: {b: c, 1: 2}\nd: |\n  x\n  y\ne: &v [1]\nf: *v\n", `{"a":{"1":"2","b":"c"},"d":"x\ny\n","e":["1"],"f":["1"]}`},
+		{"", `null`},
+	}
+	for _, tt := range tests {
+		got, err := yamlToJSON([]byte(tt.yaml))
+		if err != nil {
+			t.Errorf("yamlToJSON(%q):%v", tt.yaml, err)
+			continue
+		}
+		if string(got) != tt.json {
+			t.Errorf("yamlToJSON(%q) = %s, want %s", tt.yaml, got, tt.json)
+		}
+	}
+
+	for _, bad := range []string{"a: 1\n   b: 2\n", "a: [b\n", "\ta: 1\n", "[a]: b\n"} {
+		if _, err := yamlToJSON([]byte(bad)); err == nil {
+			t.Errorf("yamlToJSON(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package core
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkbox states used when a bool field has no explicit option
+const (
+	checkboxOn  = "Yes"
+	checkboxOff = "Off"
+)
+
+// default layout for time.Time fields without a format option
+const defaultTimeFormat = "2006-01-02"
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Marshal converts a struct tagged with `pdf:"..."` into the form data map
+// consumed by FillForm.
+//
+// The tag holds the full field name followed by comma separated options:
+//
+//	DOB     time.Time `pdf:"ap.dob,format=02/01/2006"`
+//	Married bool      `pdf:"ap.marital,option=Married"`
+//	Phone   string    `pdf:"ap.after pn,omitempty"`
+//
+// format sets the time.Time layout and must be the last option since the
+// layout itself may contain commas. option sets the value written for a true
+// bool, which is how radio groups and checkboxes with custom export values
+// are filled; false bools with an option are left out so that several
+// members can share one radio field. Bools without an option use Yes/Off.
+//
+// Struct members are hierarchical groups: their tag name (or the Go field
+// name) becomes the prefix of the nested fields. Embedded structs without a
+// tag are flattened into the parent, like encoding/json does.
+// A tag of "-" skips the member.
+func Marshal(v interface{}) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("marshal nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("marshal expects a struct, got %s", rv.Type())
+	}
+
+	form := make(map[string]interface{})
+	err := marshalStruct(form, "", rv)
+	if err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// Unmarshal fills the struct pointed to by v from form data, such as the
+// current values of a filled PDF. It is the inverse of Marshal and uses the
+// same tags. Fields missing from form are left untouched.
+func Unmarshal(form map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal expects a non-nil pointer, got %T", v)
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal expects a pointer to struct, got %T", v)
+	}
+	return unmarshalStruct(form, "", rv)
+}
+
+// parsed `pdf` struct tag
+type fieldTag struct {
+	name      string
+	format    string
+	option    string
+	omitEmpty bool
+}
+
+func parseFieldTag(tag string) fieldTag {
+	var ft fieldTag
+	parts := strings.Split(tag, ",")
+	ft.name = parts[0]
+	for i := 1; i < len(parts); i++ {
+		p := parts[i]
+		switch {
+		case strings.HasPrefix(p, "format="):
+			// the layout may contain commas, take the rest of the tag
+			ft.format = strings.TrimPrefix(strings.Join(parts[i:], ","), "format=")
+			return ft
+		case strings.HasPrefix(p, "option="):
+			ft.option = strings.TrimPrefix(p, "option=")
+		case p == "omitempty":
+			ft.omitEmpty = true
+		}
+	}
+	return ft
+}
+
+// join group prefix and field name
+func joinFieldName(prefix, name string) string {
+	if len(prefix) == 0 {
+		return name
+	}
+	if len(name) == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%s.%s", prefix, name)
+}
+
+// isGroup reports whether a struct member holds nested form fields
+// rather than a single value
+func isGroup(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(textMarshalerType) && !t.Implements(textMarshalerType)
+}
+
+// walk the exported members of a struct, resolving field names and groups
+func structFields(prefix string, t reflect.Type, fn func(index int, name string, ft fieldTag, group bool) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("pdf")
+		if tag == "-" {
+			continue
+		}
+		ft := parseFieldTag(tag)
+		group := isGroup(sf.Type)
+
+		// unexported members are skipped, except embedded structs
+		// whose exported fields are promoted
+		if len(sf.PkgPath) > 0 && !(sf.Anonymous && group && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		name := ft.name
+		if len(name) == 0 && !(group && sf.Anonymous) {
+			name = sf.Name
+		}
+
+		err := fn(i, joinFieldName(prefix, name), ft, group)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func marshalStruct(form map[string]interface{}, prefix string, rv reflect.Value) error {
+	return structFields(prefix, rv.Type(), func(index int, name string, ft fieldTag, group bool) error {
+		fv := rv.Field(index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				return nil
+			}
+			fv = fv.Elem()
+		}
+		if group {
+			return marshalStruct(form, name, fv)
+		}
+
+		value, ok, err := marshalValue(fv, ft)
+		if err != nil {
+			return fmt.Errorf("marshal field %s: %v", name, err)
+		}
+		if !ok || (ft.omitEmpty && len(value) == 0) {
+			return nil
+		}
+		form[name] = value
+		return nil
+	})
+}
+
+// marshalValue formats a single value, ok is false when nothing
+// should be written for it
+func marshalValue(fv reflect.Value, ft fieldTag) (string, bool, error) {
+	if fv.Type() == timeType {
+		t := fv.Interface().(time.Time)
+		if t.IsZero() {
+			return "", false, nil
+		}
+		format := ft.format
+		if len(format) == 0 {
+			format = defaultTimeFormat
+		}
+		return t.Format(format), true, nil
+	}
+	if fv.Type().Implements(textMarshalerType) {
+		text, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", false, err
+		}
+		return string(text), true, nil
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textMarshalerType) {
+		text, err := fv.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", false, err
+		}
+		return string(text), true, nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), true, nil
+	case reflect.Bool:
+		if len(ft.option) > 0 {
+			// radio member: only the selected option is written
+			return ft.option, fv.Bool(), nil
+		}
+		if fv.Bool() {
+			return checkboxOn, true, nil
+		}
+		return checkboxOff, true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()), true, nil
+	}
+	return "", false, fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+func unmarshalStruct(form map[string]interface{}, prefix string, rv reflect.Value) error {
+	return structFields(prefix, rv.Type(), func(index int, name string, ft fieldTag, group bool) error {
+		fv := rv.Field(index)
+		if group {
+			if fv.Kind() == reflect.Ptr {
+				if !hasFieldPrefix(form, name) {
+					return nil
+				}
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			return unmarshalStruct(form, name, fv)
+		}
+
+		raw, ok := form[name]
+		if !ok || raw == nil {
+			return nil
+		}
+		value := fmt.Sprintf("%v", raw)
+
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		err := unmarshalValue(fv, ft, value)
+		if err != nil {
+			return fmt.Errorf("unmarshal field %s: %v", name, err)
+		}
+		return nil
+	})
+}
+
+// reports whether form has any field below the group prefix
+func hasFieldPrefix(form map[string]interface{}, prefix string) bool {
+	if len(prefix) == 0 {
+		return len(form) > 0
+	}
+	for k := range form {
+		if strings.HasPrefix(k, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func unmarshalValue(fv reflect.Value, ft fieldTag, value string) error {
+	if fv.Type() == timeType {
+		if len(value) == 0 {
+			fv.Set(reflect.Zero(timeType))
+			return nil
+		}
+		format := ft.format
+		if len(format) == 0 {
+			format = defaultTimeFormat
+		}
+		t, err := time.Parse(format, value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+		return nil
+	case reflect.Bool:
+		if len(ft.option) > 0 {
+			fv.SetBool(value == ft.option)
+		} else {
+			fv.SetBool(len(value) > 0 && value != checkboxOff)
+		}
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", fv.Type())
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+type testName struct {
+	Family string `pdf:"fam name"`
+	Given  string `pdf:"given names,omitempty"`
+}
+
+type testApplicant struct {
+	testName
+	DOB     time.Time `pdf:"dob,format=02/01/2006"`
+	Married bool      `pdf:"marital,option=Married"`
+	Single  bool      `pdf:"marital,option=Single"`
+	Aus     bool      `pdf:"aus cit"`
+	Age     int       `pdf:"age"`
+	Height  *float64  `pdf:"height"`
+	Ignored string    `pdf:"-"`
+}
+
+type testForm struct {
+	Applicant testApplicant `pdf:"ap"`
+	Agent     *testName     `pdf:"ag"`
+	Ref       string        `pdf:"ref no"`
+}
+
+func TestMarshal(t *testing.T) {
+	height := 1.75
+	f := testForm{
+		Applicant: testApplicant{
+			testName: testName{Family: "Smith"},
+			DOB:      time.Date(1980, 3, 7, 0, 0, 0, 0, time.UTC),
+			Married:  true,
+			Age:      40,
+			Height:   &height,
+			Ignored:  "x",
+		},
+		Ref: "A1",
+	}
+
+	form, err := Marshal(&f)
+	if err != nil {
+		t.Fatalf("Marshal:%v", err)
+	}
+
+	want := map[string]string{
+		"ap.fam name": "Smith",
+		"ap.dob":      "07/03/1980",
+		"ap.marital":  "Married",
+		"ap.aus cit":  "Off",
+		"ap.age":      "40",
+		"ap.height":   "1.75",
+		"ref no":      "A1",
+	}
+	if len(form) != len(want) {
+		t.Fatalf("Marshal: got %d fields, want %d: %v", len(form), len(want), form)
+	}
+	for k, v := range want {
+		if form[k] != v {
+			t.Fatalf("Marshal: %s = %v, want %s", k, form[k], v)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	form := map[string]interface{}{
+		"ap.fam name":    "Smith",
+		"ap.given names": "John",
+		"ap.dob":         "07/03/1980",
+		"ap.marital":     "Single",
+		"ap.aus cit":     "Yes",
+		"ap.age":         "40",
+		"ap.height":      "1.75",
+		"ag.fam name":    "Jones",
+		"ref no":         "A1",
+	}
+
+	var f testForm
+	err := Unmarshal(form, &f)
+	if err != nil {
+		t.Fatalf("Unmarshal:%v", err)
+	}
+
+	ap := f.Applicant
+	if ap.Family != "Smith" || ap.Given != "John" {
+		t.Fatalf("Unmarshal: name %+v", ap.testName)
+	}
+	if !ap.DOB.Equal(time.Date(1980, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unmarshal: dob %v", ap.DOB)
+	}
+	if ap.Married || !ap.Single || !ap.Aus || ap.Age != 40 {
+		t.Fatalf("Unmarshal: applicant %+v", ap)
+	}
+	if ap.Height == nil || *ap.Height != 1.75 {
+		t.Fatalf("Unmarshal: height %v", ap.Height)
+	}
+	if f.Agent == nil || f.Agent.Family != "Jones" {
+		t.Fatalf("Unmarshal: agent %+v", f.Agent)
+	}
+	if f.Ref != "A1" {
+		t.Fatalf("Unmarshal: ref %q", f.Ref)
+	}
+
+	err = Unmarshal(map[string]interface{}{"ap.age": "forty"}, &f)
+	if err == nil {
+		t.Fatalf("Unmarshal: expected error for invalid int")
+	}
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// MergeOptions controls MergeFiles
+type MergeOptions struct {
+	// KeepFieldNames merges fields of the same name into one field sharing
+	// its value, by default conflicting fields of later documents are
+	// renamed
+	KeepFieldNames bool
+	// Native merges in go instead of running pdftk cat
+	Native bool
+	// Password opens encrypted inputs, they are decrypted with pdftk
+	// before the merge and the merged pdf is not encrypted
+	Password string
+}
+
+// MergeFiles concatenates the pdfs at pdfPaths into destPath. Documents
+// filled from the same template have the same field names, which would
+// share their values once merged, so the top level fields of every later
+// document that clash with an earlier one are renamed with the position of
+// the document, "ap.name fam" becomes "ap_2.name fam" in the second
+// document.
+func MergeFiles(ctx context.Context, pdfPaths []string, destPath string, opts MergeOptions) error {
+	if len(pdfPaths) == 0 {
+		return fmt.Errorf("no pdf to merge")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "merge-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	if len(opts.Password) > 0 {
+		plain := make([]string, len(pdfPaths))
+		for i, pdfPath := range pdfPaths {
+			plain[i] = filepath.Join(tmpDir, "plain_"+strconv.Itoa(i)+".pdf")
+			err = DecryptPDF(ctx, pdfPath, plain[i], opts.Password)
+			if err != nil {
+				return err
+			}
+		}
+		pdfPaths = plain
+	}
+
+	var docs []*pdfDocument
+	if opts.Native || !opts.KeepFieldNames {
+		docs = make([]*pdfDocument, len(pdfPaths))
+		for i, pdfPath := range pdfPaths {
+			doc, err := readPdfFile(pdfPath)
+			if err != nil {
+				return err
+			}
+			docs[i] = doc
+		}
+	}
+	var renames [][]fieldRename
+	if !opts.KeepFieldNames {
+		renames = fieldRenames(docs)
+	}
+
+	if opts.Native {
+		return mergeNative(docs, renames, destPath)
+	}
+
+	// pdftk cat, documents with renamed fields are rewritten first
+	inputs := make([]string, len(pdfPaths))
+	copy(inputs, pdfPaths)
+	for i, r := range renames {
+		if len(r) == 0 {
+			continue
+		}
+		inputs[i] = filepath.Join(tmpDir, strconv.Itoa(i)+".pdf")
+		err = rewritePdf(docs[i], r, inputs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return generateCoreInputs(ctx, inputs, "", destPath, []string{"cat"}, nil)
+}
+
+// fieldRename is a conflicting top level field and its new name
+type fieldRename struct {
+	field pdfField
+	name  string
+}
+
+// fieldRenames returns the conflicting top level fields per document with
+// their new names
+func fieldRenames(docs []*pdfDocument) [][]fieldRename {
+	used := make(map[string]bool)
+	renames := make([][]fieldRename, len(docs))
+	for i, doc := range docs {
+		var names []string
+		for _, f := range doc.topFields() {
+			name := f.name
+			if used[name] {
+				for n := i + 1; used[name]; n++ {
+					name = f.name + "_" + strconv.Itoa(n)
+				}
+				renames[i] = append(renames[i], fieldRename{field: f, name: name})
+			}
+			names = append(names, name)
+		}
+		// names of one document may repeat, kids of the same field
+		for _, name := range names {
+			used[name] = true
+		}
+	}
+	return renames
+}
+
+// topFields returns the roots of the field tree with their partial names
+func (doc *pdfDocument) topFields() []pdfField {
+	form := doc.dict(doc.catalog()["AcroForm"])
+	var fields []pdfField
+	for _, v := range doc.array(form["Fields"]) {
+		d := doc.dict(v)
+		if d == nil {
+			continue
+		}
+		ref, _ := v.(pdfRef)
+		t, _ := doc.resolve(d["T"]).(pdfString)
+		fields = append(fields, pdfField{ref: ref, name: decodeTextString(t), dict: d})
+	}
+	return fields
+}
+
+// renameFields registers the renamed field dictionaries with the copier.
+// Fields written inline in the /Fields array have no object to replace,
+// they are renamed in doc and copied along with the array.
+func renameFields(c *pdfCopier, doc *pdfDocument, renames []fieldRename) {
+	for _, r := range renames {
+		if r.field.ref.num == 0 {
+			r.field.dict["T"] = encodeTextString(r.name)
+			continue
+		}
+		renamed := make(pdfDict, len(r.field.dict))
+		for k, v := range r.field.dict {
+			renamed[k] = v
+		}
+		renamed["T"] = encodeTextString(r.name)
+		c.override[r.field.ref.num] = renamed
+	}
+}
+
+// rewritePdf writes doc to destPath with renamed fields
+func rewritePdf(doc *pdfDocument, renames []fieldRename, destPath string) error {
+	w := newPdfWriter(doc.version)
+	c := newPdfCopier(doc, w)
+	renameFields(c, doc, renames)
+	trailer := pdfDict{"Root": c.value(doc.trailer["Root"])}
+	if info, ok := doc.trailer["Info"]; ok {
+		trailer["Info"] = c.value(info)
+	}
+	c.flush()
+	return w.writeFile(destPath, trailer)
+}
+
+// mergeNative concatenates the pages of docs into one document with a
+// single page tree and form
+func mergeNative(docs []*pdfDocument, renames [][]fieldRename, destPath string) error {
+	version := "1.4"
+	for _, doc := range docs {
+		if doc.version > version {
+			version = doc.version
+		}
+	}
+	w := newPdfWriter(version)
+	pagesRef := w.alloc()
+
+	var kids, fields, co pdfArray
+	form := pdfDict{}
+	resources := pdfDict{}
+	for i, doc := range docs {
+		c := newPdfCopier(doc, w)
+		if renames != nil {
+			renameFields(c, doc, renames[i])
+		}
+
+		pages, err := doc.pages()
+		if err != nil {
+			return fmt.Errorf("document %d: %v", i+1, err)
+		}
+		for _, p := range pages {
+			// the page joins the new tree with its inherited attributes
+			page := make(pdfDict, len(p.dict))
+			for k, v := range p.dict {
+				page[k] = v
+			}
+			delete(page, "Parent")
+			c.override[p.ref.num] = page
+			c.fixed[p.ref.num] = pdfDict{"Parent": pagesRef}
+			kids = append(kids, c.ref(p.ref))
+		}
+
+		acroForm := doc.dict(doc.catalog()["AcroForm"])
+		if acroForm != nil {
+			fields = append(fields, c.value(doc.array(acroForm["Fields"])).(pdfArray)...)
+			co = append(co, c.value(doc.array(acroForm["CO"])).(pdfArray)...)
+			if v, ok := acroForm["NeedAppearances"].(bool); ok && v {
+				form["NeedAppearances"] = true
+			}
+			if _, ok := form["DA"]; !ok && acroForm["DA"] != nil {
+				form["DA"] = c.value(acroForm["DA"])
+			}
+			// default resources, the first document wins on conflicts
+			dr := doc.dict(acroForm["DR"])
+			for k, v := range dr {
+				sub := doc.dict(v)
+				if sub == nil {
+					if _, ok := resources[k]; !ok {
+						resources[k] = c.value(v)
+					}
+					continue
+				}
+				merged, _ := resources[k].(pdfDict)
+				if merged == nil {
+					merged = pdfDict{}
+					resources[k] = merged
+				}
+				for name, r := range sub {
+					if _, ok := merged[name]; !ok {
+						merged[name] = c.value(r)
+					}
+				}
+			}
+		}
+		c.flush()
+	}
+
+	w.writeObject(pagesRef, pdfDict{
+		"Type":  pdfName("Pages"),
+		"Kids":  kids,
+		"Count": int64(len(kids)),
+	})
+	catalog := pdfDict{"Type": pdfName("Catalog"), "Pages": pagesRef}
+	if len(fields) > 0 {
+		form["Fields"] = fields
+		if len(co) > 0 {
+			form["CO"] = co
+		}
+		if len(resources) > 0 {
+			form["DR"] = resources
+		}
+		catalog["AcroForm"] = w.add(form)
+	}
+	return w.writeFile(destPath, pdfDict{"Root": w.add(catalog)})
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeNative(t *testing.T) {
+	src, err := readPdfFile("../file/1022.pdf")
+	if err != nil {
+		t.Fatalf("readPdfFile:%v", err)
+	}
+	srcPages, err := src.pages()
+	if err != nil {
+		t.Fatalf("pages:%v", err)
+	}
+	srcFields := src.fields()
+	if len(srcPages) == 0 || len(srcFields) == 0 {
+		t.Fatalf("1022.pdf: %d pages %d fields", len(srcPages), len(srcFields))
+	}
+
+	dir, err := ioutil.TempDir("", "merge-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "merged.pdf")
+
+	err = MergeFiles(context.Background(), []string{"../file/1022.pdf", "../file/1022.pdf"}, dest, MergeOptions{Native: true})
+	if err != nil {
+		t.Fatalf("MergeFiles:%v", err)
+	}
+
+	merged, err := readPdfFile(dest)
+	if err != nil {
+		t.Fatalf("readPdfFile merged:%v", err)
+	}
+	pages, err := merged.pages()
+	if err != nil {
+		t.Fatalf("pages merged:%v", err)
+	}
+	if len(pages) != 2*len(srcPages) {
+		t.Errorf("merged pages = %d, want %d", len(pages), 2*len(srcPages))
+	}
+	for _, p := range pages {
+		if _, ok := p.dict["MediaBox"]; !ok {
+			t.Errorf("page %d lost its inherited MediaBox", p.ref.num)
+		}
+	}
+
+	fields := merged.fields()
+	if len(fields) != 2*len(srcFields) {
+		t.Fatalf("merged fields = %d, want %d", len(fields), 2*len(srcFields))
+	}
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if names[f.name] {
+			t.Errorf("field %q is not unique", f.name)
+		}
+		names[f.name] = true
+	}
+	first := srcFields[0].name
+	top := strings.SplitN(first, ".", 2)
+	top[0] += "_2"
+	if !names[first] || !names[strings.Join(top, ".")] {
+		t.Errorf("field %q not renamed to %q", first, strings.Join(top, "."))
+	}
+}
+
+func TestFieldRenamesKeepFirst(t *testing.T) {
+	doc, err := readPdfFile("../file/1022.pdf")
+	if err != nil {
+		t.Fatalf("readPdfFile:%v", err)
+	}
+	renames := fieldRenames([]*pdfDocument{doc, doc, doc})
+	if len(renames[0]) != 0 {
+		t.Errorf("first document renamed: %v", renames[0])
+	}
+	for _, r := range renames[2] {
+		if !strings.HasSuffix(r.name, "_3") {
+			t.Errorf("third document field %q renamed to %q", r.field.name, r.name)
+		}
+	}
+}
+
+func TestMergeInlineFields(t *testing.T) {
+	// a form whose only field is written inline in /Fields
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inline.pdf")
+	w := newPdfWriter("1.7")
+	pages := w.alloc()
+	page := w.add(pdfDict{"Type": pdfName("Page"), "Parent": pages, "MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)}})
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": pdfArray{page}, "Count": int64(1)})
+	form := pdfDict{"Fields": pdfArray{pdfDict{"FT": pdfName("Tx"), "T": pdfString("Name"), "V": pdfString("Li Lei")}}}
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages, "AcroForm": form})
+	if err := w.writeFile(path, pdfDict{"Root": catalog}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, native := range []bool{true, false} {
+		dest := filepath.Join(dir, "merged.pdf")
+		var err error
+		if native {
+			err = MergeFiles(context.Background(), []string{path, path}, dest, MergeOptions{Native: true})
+		} else {
+			// the rewritten second document, as passed to pdftk cat
+			docs := make([]*pdfDocument, 2)
+			for i := range docs {
+				if docs[i], err = readPdfFile(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = rewritePdf(docs[1], fieldRenames(docs)[1], dest)
+		}
+		if err != nil {
+			t.Fatalf("merge native %v:%v", native, err)
+		}
+		values, err := FormValuesNative(dest)
+		if err != nil {
+			t.Fatalf("FormValuesNative:%v", err)
+		}
+		if _, ok := values["Name_2"]; !ok || native && len(values) != 2 {
+			t.Errorf("merge native %v values = %v", native, values)
+		}
+	}
+}
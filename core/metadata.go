@@ -0,0 +1,309 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the document information of a pdf
+type Metadata struct {
+	// Info holds the entries of the document information dictionary,
+	// such as Title, Author, Subject, Keywords and custom keys
+	Info          map[string]string `json:"Info"`
+	Bookmarks     []Bookmark        `json:"Bookmarks,omitempty"`
+	NumberOfPages int               `json:"NumberOfPages"`
+}
+
+// Bookmark is an entry of the document outline
+type Bookmark struct {
+	Title string `json:"Title"`
+	// Level is 1 for top level entries
+	Level int `json:"Level"`
+	// PageNumber is the target page counted from 1, 0 if the bookmark
+	// has no page
+	PageNumber int `json:"PageNumber"`
+}
+
+// ReadMetadata returns the document information of the pdf at pdfPath
+// using pdftk dump_data_utf8, the pdf is opened with password if it is set
+func ReadMetadata(ctx context.Context, pdfPath, password string) (*Metadata, error) {
+	tmpDir, err := ioutil.TempDir("", "metadata-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	// pdftk form.pdf dump_data_utf8 output data.txt
+	dataPath := filepath.Join(tmpDir, "data.txt")
+	err = generateCorePassword(ctx, pdfPath, password, dataPath, []string{"dump_data_utf8"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke generateCore: %w", err)
+	}
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open file:%v", err)
+	}
+	defer f.Close()
+	return readDumpData(f)
+}
+
+// readDumpData parses the report of pdftk dump_data_utf8:
+//
+//	InfoBegin
+//	InfoKey: Title
+//	InfoValue: Application for a visa
+//	NumberOfPages: 19
+//	BookmarkBegin
+//	BookmarkTitle: Part A
+//	BookmarkLevel: 1
+//	BookmarkPageNumber: 3
+func readDumpData(r io.Reader) (*Metadata, error) {
+	meta := &Metadata{Info: make(map[string]string)}
+	var key string
+	var bookmark *Bookmark
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		k, v, ok := dumpLine(scanner.Text(), "")
+		if !ok {
+			continue
+		}
+		v = html.UnescapeString(v)
+		switch k {
+		case "InfoKey":
+			key = v
+		case "InfoValue":
+			if len(key) > 0 {
+				meta.Info[key] = v
+			}
+			key = ""
+		case "NumberOfPages":
+			meta.NumberOfPages, _ = strconv.Atoi(v)
+		case "BookmarkTitle":
+			meta.Bookmarks = append(meta.Bookmarks, Bookmark{Title: v})
+			bookmark = &meta.Bookmarks[len(meta.Bookmarks)-1]
+		case "BookmarkLevel":
+			if bookmark != nil {
+				bookmark.Level, _ = strconv.Atoi(v)
+			}
+		case "BookmarkPageNumber":
+			if bookmark != nil {
+				bookmark.PageNumber, _ = strconv.Atoi(v)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("fail to read dump data: %v", err)
+	}
+	return meta, nil
+}
+
+// UpdateInfo sets the entries of info in the document information of the
+// pdf at pdfPath using pdftk update_info_utf8, the result is written to
+// destPath. Entries with an empty value are removed.
+func UpdateInfo(ctx context.Context, pdfPath, destPath string, info map[string]string) error {
+	tmpDir, err := ioutil.TempDir("", "metadata-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	infoPath := filepath.Join(tmpDir, "info.txt")
+	err = ioutil.WriteFile(infoPath, infoData(info), 0600)
+	if err != nil {
+		return err
+	}
+	// pdftk form.pdf update_info_utf8 info.txt output form.info.pdf
+	return generateCore(ctx, pdfPath, destPath, []string{"update_info_utf8", infoPath}, nil)
+}
+
+// infoData writes info in the dump_data format read by update_info_utf8
+func infoData(info map[string]string) []byte {
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "InfoBegin\nInfoKey: %s\nInfoValue: %s\n", escapeDumpValue(k), escapeDumpValue(info[k]))
+	}
+	return buf.Bytes()
+}
+
+// values are single lines, pdftk reads xml character references
+func escapeDumpValue(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '\n', '\r':
+			fmt.Fprintf(&b, "&#%d;", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ReadMetadataNative is ReadMetadata without pdftk
+func ReadMetadataNative(pdfPath string) (*Metadata, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{Info: make(map[string]string), NumberOfPages: len(pages)}
+	for k, v := range doc.dict(doc.trailer["Info"]) {
+		if s, ok := doc.resolve(v).(pdfString); ok {
+			meta.Info[string(k)] = decodeTextString(s)
+		}
+	}
+
+	pageNumbers := make(map[int]int, len(pages))
+	for i, p := range pages {
+		pageNumbers[p.ref.num] = i + 1
+	}
+	outlines := doc.dict(doc.catalog()["Outlines"])
+	seen := make(map[int]bool)
+	var walk func(v interface{}, level int)
+	walk = func(v interface{}, level int) {
+		for v != nil {
+			ref, ok := v.(pdfRef)
+			if !ok || seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+			item := doc.dict(ref)
+			if item == nil {
+				return
+			}
+			title, _ := doc.resolve(item["Title"]).(pdfString)
+			meta.Bookmarks = append(meta.Bookmarks, Bookmark{
+				Title:      decodeTextString(title),
+				Level:      level,
+				PageNumber: pageNumbers[doc.destPage(item).num],
+			})
+			walk(item["First"], level+1)
+			v = item["Next"]
+		}
+	}
+	walk(outlines["First"], 1)
+	return meta, nil
+}
+
+// destPage returns the page an outline item or link points to
+func (doc *pdfDocument) destPage(item pdfDict) pdfRef {
+	dest := item["Dest"]
+	if action := doc.dict(item["A"]); action != nil && action["S"] == pdfName("GoTo") {
+		dest = action["D"]
+	}
+	dest = doc.resolve(dest)
+
+	// named destinations
+	var name pdfString
+	switch d := dest.(type) {
+	case pdfName:
+		name = pdfString(d)
+	case pdfString:
+		name = d
+	}
+	if len(name) > 0 {
+		catalog := doc.catalog()
+		dest = doc.resolve(doc.dict(catalog["Dests"])[pdfName(name)])
+		if dest == nil {
+			dest = doc.nameTreeLookup(doc.dict(catalog["Names"])["Dests"], name)
+		}
+	}
+	// a destination is an array or a dictionary holding it in /D
+	if d := doc.dict(dest); d != nil {
+		dest = doc.resolve(d["D"])
+	}
+	if a, ok := dest.(pdfArray); ok && len(a) > 0 {
+		ref, _ := a[0].(pdfRef)
+		return ref
+	}
+	return pdfRef{}
+}
+
+// nameTreeLookup finds key in a name tree
+func (doc *pdfDocument) nameTreeLookup(node interface{}, key pdfString) interface{} {
+	seen := make(map[int]bool)
+	var lookup func(v interface{}) interface{}
+	lookup = func(v interface{}) interface{} {
+		if ref, ok := v.(pdfRef); ok {
+			if seen[ref.num] {
+				return nil
+			}
+			seen[ref.num] = true
+		}
+		n := doc.dict(v)
+		names := doc.array(n["Names"])
+		for i := 0; i+1 < len(names); i += 2 {
+			if k, ok := doc.resolve(names[i]).(pdfString); ok && k == key {
+				return doc.resolve(names[i+1])
+			}
+		}
+		for _, kid := range doc.array(n["Kids"]) {
+			if r := lookup(kid); r != nil {
+				return r
+			}
+		}
+		return nil
+	}
+	return lookup(node)
+}
+
+// UpdateInfoNative is UpdateInfo without pdftk. The change is appended to
+// the file as an incremental update.
+func UpdateInfoNative(pdfPath, destPath string, info map[string]string) error {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	doc.setInfo(u, info)
+	return u.writeFile(destPath, nil)
+}
+
+// setInfo adds the updated document information to u
+func (doc *pdfDocument) setInfo(u *pdfUpdate, info map[string]string) {
+	dict := pdfDict{}
+	for k, v := range doc.dict(doc.trailer["Info"]) {
+		dict[k] = v
+	}
+	for k, v := range info {
+		if len(v) == 0 {
+			delete(dict, pdfName(k))
+			continue
+		}
+		dict[pdfName(k)] = encodeTextString(v)
+	}
+
+	if ref, ok := doc.trailer["Info"].(pdfRef); ok {
+		u.set(ref.num, dict)
+	} else {
+		doc.trailer["Info"] = u.add(dict)
+	}
+}
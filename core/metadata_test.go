@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDumpData(t *testing.T) {
+	data := `InfoBegin
+InfoKey: Title
+InfoValue: Application &amp; declaration
+InfoBegin
+InfoKey: CaseID
+InfoValue: A1&#10;B2
+PdfID0: f3f3d85aac4e1cdb187d6bd233208295
+NumberOfPages: 19
+BookmarkBegin
+BookmarkTitle: Part A
+BookmarkLevel: 1
+BookmarkPageNumber: 3
+BookmarkBegin
+BookmarkTitle: Applicant
+BookmarkLevel: 2
+BookmarkPageNumber: 4
+`
+	meta, err := readDumpData(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("readDumpData:%v", err)
+	}
+	want := &Metadata{
+		Info:          map[string]string{"Title": "Application & declaration", "CaseID": "A1\nB2"},
+		NumberOfPages: 19,
+		Bookmarks:     []Bookmark{{"Part A", 1, 3}, {"Applicant", 2, 4}},
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("readDumpData = %+v, want %+v", meta, want)
+	}
+
+	info := string(infoData(map[string]string{"CaseID": "A1\nB2", "Title": "a & b"}))
+	if info != "InfoBegin\nInfoKey: CaseID\nInfoValue: A1&#10;B2\nInfoBegin\nInfoKey: Title\nInfoValue: a &amp; b\n" {
+		t.Errorf("infoData = %q", info)
+	}
+}
+
+func TestUpdateInfoNative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	before, err := ReadMetadataNative("../file/1022.pdf")
+	if err != nil {
+		t.Fatalf("ReadMetadataNative:%v", err)
+	}
+	if before.NumberOfPages == 0 {
+		t.Fatalf("ReadMetadataNative: no pages")
+	}
+
+	dest := filepath.Join(dir, "tagged.pdf")
+	err = UpdateInfoNative("../file/1022.pdf", dest, map[string]string{"CaseID": "A-1", "Title": "Visa – Ünïcode"})
+	if err != nil {
+		t.Fatalf("UpdateInfoNative:%v", err)
+	}
+	after, err := ReadMetadataNative(dest)
+	if err != nil {
+		t.Fatalf("ReadMetadataNative:%v", err)
+	}
+	if after.Info["CaseID"] != "A-1" || after.Info["Title"] != "Visa – Ünïcode" {
+		t.Errorf("Info = %v", after.Info)
+	}
+	for k, v := range before.Info {
+		if k != "Title" && after.Info[k] != v {
+			t.Errorf("Info[%s] = %q, want %q", k, after.Info[k], v)
+		}
+	}
+	if after.NumberOfPages != before.NumberOfPages {
+		t.Errorf("NumberOfPages = %d, want %d", after.NumberOfPages, before.NumberOfPages)
+	}
+
+	// incremental update keeps the original bytes
+	orig, _ := ioutil.ReadFile("../file/1022.pdf")
+	updated, _ := ioutil.ReadFile(dest)
+	if !bytes.HasPrefix(updated, orig) {
+		t.Errorf("update is not incremental")
+	}
+}
+
+func TestUpdateXrefStream(t *testing.T) {
+	doc, err := readPdfFile("../file/1022.pdf")
+	if err != nil {
+		t.Fatalf("readPdfFile:%v", err)
+	}
+	// continue the file with an xref stream
+	doc.xrefStream = true
+	u := doc.update()
+	doc.setInfo(u, map[string]string{"CaseID": "B-2"})
+	data := u.bytes(nil)
+
+	updated, err := parsePdf(data)
+	if err != nil {
+		t.Fatalf("parsePdf:%v", err)
+	}
+	if updated.startxref == 0 || !updated.xrefStream {
+		t.Fatalf("xref stream not read")
+	}
+	info := updated.dict(updated.trailer["Info"])
+	if s, _ := info["CaseID"].(pdfString); s != "B-2" {
+		t.Errorf("CaseID = %v", info["CaseID"])
+	}
+	if len(updated.fields()) != len(doc.fields()) {
+		t.Errorf("fields lost")
+	}
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// Native is the Backend filling without pdftk. The values are appended to
+// the pdf as an incremental update, which keeps existing signatures valid.
+// Appearances are left to the viewer, see FillFormNative.
+var Native Backend = nativeBackend{}
+
+type nativeBackend struct{}
+
+func (nativeBackend) FillForm(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts FillOptions) error {
+	return FillFormNative(ctx, form, pdfPath, destPath, opts)
+}
+
+// FillFormNative is FillFormFileContext without pdftk. The field values are
+// set with NeedAppearances, so viewers draw the filled fields themselves.
+// Flatten, DropXFA and opening an encrypted pdf with Password need pdftk and
+// are rejected, encryption rewrites the file and is refused for signed pdfs
+// like a pdftk fill.
+func FillFormNative(ctx context.Context, form map[string]interface{}, pdfPath, destPath string, opts FillOptions) error {
+	form, err := opts.prepareForm(form)
+	if err != nil {
+		return err
+	}
+	err = opts.validate()
+	if err != nil {
+		return err
+	}
+	if opts.Flatten || opts.DropXFA {
+		return fmt.Errorf("flatten and drop XFA are not supported without pdftk")
+	}
+	if len(opts.Password) > 0 {
+		return fmt.Errorf("encrypted pdfs are not supported without pdftk, decrypt with DecryptPDF first")
+	}
+	if opts.Encryption != nil {
+		err = opts.checkSignatures(ctx, pdfPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	err = doc.fillFields(u, form)
+	if err != nil {
+		return err
+	}
+	err = opts.applyUpdate(doc, u, form)
+	if err != nil {
+		return err
+	}
+	err = u.writeFile(destPath, nil)
+	if err != nil {
+		return err
+	}
+	return encryptFile(ctx, destPath, opts.Encryption)
+}
+
+// fillFields sets the values of form in the fields of the document. Keys
+// without a field are ignored like pdftk does, signature fields cannot be
+// filled.
+func (doc *pdfDocument) fillFields(u *pdfUpdate, form map[string]interface{}) error {
+	// fields and widgets are copied once, a field may be its own widget
+	edited := make(map[int]pdfDict)
+	edit := func(ref pdfRef) pdfDict {
+		if d, ok := edited[ref.num]; ok {
+			return d
+		}
+		d := pdfDict{}
+		for k, v := range doc.dict(ref) {
+			d[k] = v
+		}
+		edited[ref.num] = d
+		return d
+	}
+
+	for _, f := range doc.fields() {
+		v, ok := form[f.name]
+		if !ok {
+			continue
+		}
+		if f.ref.num == 0 {
+			return fmt.Errorf("field %s is not an indirect object", f.name)
+		}
+		widgets := []pdfRef{f.ref}
+		if kids := doc.array(f.dict["Kids"]); len(kids) > 0 {
+			widgets = widgets[:0]
+			for _, kid := range kids {
+				if ref, ok := kid.(pdfRef); ok {
+					widgets = append(widgets, ref)
+				}
+			}
+		}
+
+		values, multi := formValueList(v)
+		if len(values) == 0 {
+			// an empty list clears the field, a check box is Off
+			values, multi = []string{""}, false
+		}
+		flags, _ := f.attrs["Ff"].(int64)
+		switch f.attrs["FT"] {
+		case pdfName("Sig"):
+			return fmt.Errorf("signature field %s cannot be filled", f.name)
+		case pdfName("Btn"):
+			if flags&flagPushButton != 0 {
+				continue
+			}
+			state := pdfName(values[0])
+			if len(state) == 0 {
+				state = checkboxOff
+			}
+			edit(f.ref)["V"] = state
+			// widgets show the state if they have an appearance for it
+			for _, w := range widgets {
+				wd := edit(w)
+				if _, ok := doc.dict(doc.dict(wd["AP"])["N"])[state]; ok {
+					wd["AS"] = state
+				} else {
+					wd["AS"] = pdfName(checkboxOff)
+				}
+			}
+		default:
+			if multi {
+				arr := make(pdfArray, len(values))
+				for i, s := range values {
+					arr[i] = encodeTextString(s)
+				}
+				edit(f.ref)["V"] = arr
+			} else {
+				edit(f.ref)["V"] = encodeTextString(values[0])
+			}
+			// selected indices and appearances would show the old value
+			delete(edit(f.ref), "I")
+			for _, w := range widgets {
+				delete(edit(w), "AP")
+			}
+		}
+	}
+	if len(edited) == 0 {
+		return nil
+	}
+	for num, d := range edited {
+		u.set(num, d)
+	}
+
+	acroForm := pdfDict{}
+	for k, v := range doc.dict(doc.catalog()["AcroForm"]) {
+		acroForm[k] = v
+	}
+	acroForm["NeedAppearances"] = true
+	return doc.setAcroForm(u, acroForm)
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// pdf object model, shared by the fdf reader and the native pdf code
+type (
+	pdfName   string
+	pdfString string
+	pdfDict   map[pdfName]interface{}
+	pdfArray  []interface{}
+	pdfRef    struct{ num, gen int }
+	// keyword such as obj, endobj, R, stream or trailer
+	pdfKeyword string
+)
+
+// tokenizer of pdf/fdf syntax
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func newPdfLexer(data []byte) *pdfLexer {
+	return &pdfLexer{data: data}
+}
+
+func isPdfWhite(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPdfDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skip white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPdfWhite(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// token returns the next token: a delimiter such as "<<" or "[" as
+// pdfKeyword, or a scalar object, io.EOF at end of data
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch c {
+	case '/':
+		return l.name()
+	case '(':
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		return nil, fmt.Errorf("unexpected '>' at offset %d", l.pos)
+	case '[', ']', '{', '}':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case ')':
+		return nil, fmt.Errorf("unexpected ')' at offset %d", l.pos)
+	}
+
+	// number or keyword
+	start := l.pos
+	for l.pos < len(l.data) && !isPdfWhite(l.data[l.pos]) && !isPdfDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) name() (interface{}, error) {
+	// skip '/'
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) && !isPdfWhite(l.data[l.pos]) && !isPdfDelim(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			n, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			if err == nil {
+				b = append(b, byte(n))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b), nil
+}
+
+func (l *pdfLexer) literalString() (interface{}, error) {
+	// skip '('
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func (l *pdfLexer) hexString() (interface{}, error) {
+	// skip '<'
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			b := make([]byte, len(digits)/2)
+			for i := range b {
+				n, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("invalid hex string: %v", err)
+				}
+				b[i] = byte(n)
+			}
+			return pdfString(b), nil
+		}
+		if isPdfWhite(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	return nil, fmt.Errorf("unterminated hex string")
+}
+
+// object parses the next complete object, resolving dictionaries, arrays
+// and indirect references "n g R"
+func (l *pdfLexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.objectFrom(tok)
+}
+
+func (l *pdfLexer) objectFrom(tok interface{}) (interface{}, error) {
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "<<":
+			return l.dict()
+		case "[":
+			return l.array()
+		}
+		return t, nil
+	case int64:
+		// lookahead for "gen R"
+		save := l.pos
+		gen, err := l.token()
+		if g, ok := gen.(int64); err == nil && ok {
+			kw, err := l.token()
+			if k, ok := kw.(pdfKeyword); err == nil && ok && k == "R" {
+				return pdfRef{num: int(t), gen: int(g)}, nil
+			}
+		}
+		l.pos = save
+		return t, nil
+	}
+	return tok, nil
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	d := make(pdfDict)
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, fmt.Errorf("unterminated dictionary: %v", err)
+		}
+		if k, ok := tok.(pdfKeyword); ok && k == ">>" {
+			return d, nil
+		}
+		key, ok := tok.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key is not a name: %v", tok)
+		}
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := value.(pdfKeyword); ok && k == ">>" {
+			return nil, fmt.Errorf("missing value of key /%s", key)
+		}
+		d[key] = value
+	}
+}
+
+func (l *pdfLexer) array() (pdfArray, error) {
+	a := make(pdfArray, 0)
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, fmt.Errorf("unterminated array: %v", err)
+		}
+		if k, ok := tok.(pdfKeyword); ok && k == "]" {
+			return a, nil
+		}
+		value, err := l.objectFrom(tok)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, value)
+	}
+}
+
+// decodeTextString converts a pdf text string, PDFDocEncoding or UTF-16BE
+// with byte order mark, to utf-8
+func decodeTextString(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		b := []byte(s[2:])
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+	if len(s) >= 3 && s[0] == 0xef && s[1] == 0xbb && s[2] == 0xbf {
+		// utf-8 with byte order mark, pdf 2.0
+		return string(s[3:])
+	}
+	if utf8.ValidString(string(s)) {
+		return string(s)
+	}
+	// PDFDocEncoding matches Latin-1 for the printable range
+	r := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		r[i] = rune(s[i])
+	}
+	return string(r)
+}
+
+// encodeTextString converts utf-8 to a pdf text string, plain ASCII stays
+// as is, anything else is written as UTF-16BE with byte order mark
+func encodeTextString(s string) pdfString {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfString(s)
+	}
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2+2*len(u))
+	b[0], b[1] = 0xfe, 0xff
+	for i, c := range u {
+		binary.BigEndian.PutUint16(b[2+2*i:], c)
+	}
+	return pdfString(b)
+}
+
+// write a pdf literal string with escapes
+func writePdfString(w io.Writer, s pdfString) {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString("\\r")
+		case '\n':
+			buf.WriteString("\\n")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	w.Write(buf.Bytes())
+}
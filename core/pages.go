@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PageRange selects the pages First to Last, counted from 1. Last 0 stands
+// for the last page of the document.
+type PageRange struct {
+	First int
+	Last  int
+}
+
+// String returns the range in pdftk syntax, such as "1-3", "5" or "7-end"
+func (r PageRange) String() string {
+	switch {
+	case r.Last == 0:
+		return fmt.Sprintf("%d-end", r.First)
+	case r.First == r.Last:
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// ParsePageRanges parses ranges such as "1-3 5 7-end" or "1-3,5", "end"
+// stands for the last page
+func ParsePageRanges(s string) ([]PageRange, error) {
+	var ranges []PageRange
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		first, last := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		f, err := parsePageNumber(first)
+		if err != nil || f == 0 {
+			return nil, fmt.Errorf("invalid page range %q", part)
+		}
+		l, err := parsePageNumber(last)
+		if err != nil || (l != 0 && l < f) {
+			return nil, fmt.Errorf("invalid page range %q", part)
+		}
+		ranges = append(ranges, PageRange{First: f, Last: l})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no page range in %q", s)
+	}
+	return ranges, nil
+}
+
+// page number, 0 for "end"
+func parsePageNumber(s string) (int, error) {
+	if s == "end" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid page number %q", s)
+	}
+	return n, nil
+}
+
+// Rotation turns pages for RotatePages. North, east, south and west set
+// the orientation, left, right and down turn pages relative to their
+// current orientation.
+type Rotation string
+
+const (
+	RotateNorth Rotation = "north"
+	RotateEast  Rotation = "east"
+	RotateSouth Rotation = "south"
+	RotateWest  Rotation = "west"
+	RotateLeft  Rotation = "left"
+	RotateRight Rotation = "right"
+	RotateDown  Rotation = "down"
+)
+
+func (r Rotation) valid() bool {
+	switch r {
+	case RotateNorth, RotateEast, RotateSouth, RotateWest, RotateLeft, RotateRight, RotateDown:
+		return true
+	}
+	return false
+}
+
+// SelectPages writes the pages of ranges, in the given order, to destPath,
+// such as dropping the instruction pages of a form. An encrypted pdf is
+// opened with password, the output is not encrypted.
+func SelectPages(ctx context.Context, pdfPath, destPath string, ranges []PageRange, password string) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("no page range")
+	}
+	// pdftk form.pdf cat 1-3 5 output form.pages.pdf
+	args := []string{"cat"}
+	for _, r := range ranges {
+		args = append(args, r.String())
+	}
+	return generateCorePassword(ctx, pdfPath, password, destPath, args, nil)
+}
+
+// RotatePages turns the pages of ranges, all pages when ranges is empty,
+// and writes the whole document to destPath. An encrypted pdf is opened
+// with password, the output is not encrypted.
+func RotatePages(ctx context.Context, pdfPath, destPath string, ranges []PageRange, rotation Rotation, password string) error {
+	if !rotation.valid() {
+		return fmt.Errorf("invalid rotation %q", rotation)
+	}
+	if len(ranges) == 0 {
+		ranges = []PageRange{{First: 1}}
+	}
+	// pdftk form.pdf rotate 1-2east output form.rotated.pdf
+	args := []string{"rotate"}
+	for _, r := range ranges {
+		args = append(args, r.String()+string(rotation))
+	}
+	return generateCorePassword(ctx, pdfPath, password, destPath, args, nil)
+}
+
+// BurstPages writes every page to its own file in destDir, named
+// page_0001.pdf, page_0002.pdf and so on, and returns their paths in page
+// order. An encrypted pdf is opened with password.
+func BurstPages(ctx context.Context, pdfPath, destDir, password string) ([]string, error) {
+	pdfPath, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	e, err := Exists(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("check pdf file Exists fail: %v", err)
+	} else if !e {
+		return nil, fmt.Errorf("pdf file does not Exists: '%s'", pdfPath)
+	}
+
+	// burst in a temporary directory, pdftk also writes doc_data.txt
+	tmpDir, err := ioutil.TempDir("", "burst-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary directory fail: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	// pdftk form.pdf burst output page_%04d.pdf
+	err = runPdftk(ctx, tmpDir, password, 1, pdfPath, "burst", "output", filepath.Join(tmpDir, "page_%04d.pdf"))
+	if err != nil {
+		return nil, fmt.Errorf("pdftk exec fail: %w", err)
+	}
+
+	pages, err := filepath.Glob(filepath.Join(tmpDir, "page_*.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("pdftk burst created no pages")
+	}
+	sort.Strings(pages)
+
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(pages))
+	for i, page := range pages {
+		paths[i] = filepath.Join(destDir, filepath.Base(page))
+		err = copyFile(page, paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy page to destination: %v", err)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	ranges, err := ParsePageRanges("1-3 5,7-end")
+	if err != nil {
+		t.Fatalf("ParsePageRanges:%v", err)
+	}
+	if !reflect.DeepEqual(ranges, []PageRange{{1, 3}, {5, 5}, {7, 0}}) {
+		t.Errorf("ParsePageRanges = %v", ranges)
+	}
+	var strs []string
+	for _, r := range ranges {
+		strs = append(strs, r.String())
+	}
+	if !reflect.DeepEqual(strs, []string{"1-3", "5", "7-end"}) {
+		t.Errorf("String = %v", strs)
+	}
+
+	for _, bad := range []string{"", "0", "3-1", "a-2", "end", "1-x"} {
+		if _, err := ParsePageRanges(bad); err == nil {
+			t.Errorf("ParsePageRanges(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSelectPagesInPlace(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.pdf")
+	if err := ioutil.WriteFile(in, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertContent := func(want string) {
+		t.Helper()
+		if data, _ := ioutil.ReadFile(in); string(data) != want {
+			t.Errorf("%s holds %q, want %q", in, data, want)
+		}
+	}
+	ranges := []PageRange{{2, 0}}
+
+	// the input survives a missing or failing pdftk
+	t.Setenv("PATH", t.TempDir())
+	if err := SelectPages(context.Background(), in, in, ranges, ""); !errors.Is(err, ErrNoPdftk) {
+		t.Fatalf("SelectPages error = %v, want ErrNoPdftk", err)
+	}
+	assertContent("original")
+	fakePdftk(t, "exit 1")
+	if err := SelectPages(context.Background(), in, in, ranges, ""); err == nil {
+		t.Fatalf("SelectPages should fail")
+	}
+	assertContent("original")
+
+	// and is replaced by the output of pdftk
+	fakePdftk(t, `while [ $# -gt 0 ]; do [ "$1" = output ] && printf selected > "$2"; shift; done`)
+	if err := SelectPages(context.Background(), in, in, ranges, ""); err != nil {
+		t.Fatalf("SelectPages:%v", err)
+	}
+	assertContent("selected")
+}
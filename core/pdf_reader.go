@@ -0,0 +1,798 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+// pdfStream is a stream object, data is the raw content as stored in the
+// file, still encoded with the filters of the dictionary
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// location of an object in the file
+type xrefEntry struct {
+	// offset of "n g obj" for objects stored in the file
+	offset int
+	// number of the object stream and index within it for compressed
+	// objects, stream is 0 otherwise
+	stream int
+	index  int
+	gen    int
+}
+
+// pdfDocument is a parsed pdf file. Objects are read lazily from the
+// cross-reference table, which is rebuilt by scanning the file when it is
+// damaged. Encrypted files are not supported.
+type pdfDocument struct {
+	data    []byte
+	version string
+	xref    map[int]xrefEntry
+	trailer pdfDict
+	// resolved objects
+	cache map[int]interface{}
+	// objects of decoded object streams
+	objStreams map[int][]interface{}
+	// offset of the last cross-reference section, 0 when the table was
+	// rebuilt
+	startxref int
+	// the last section is an xref stream
+	xrefStream bool
+}
+
+// readPdfFile parses the pdf at path
+func readPdfFile(path string) (*pdfDocument, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read %s: %v", path, err)
+	}
+	doc, err := parsePdf(data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse %s: %v", path, err)
+	}
+	return doc, nil
+}
+
+var pdfHeader = regexp.MustCompile(`%PDF-(\d\.\d)`)
+
+func parsePdf(data []byte) (*pdfDocument, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	m := pdfHeader.FindSubmatch(head)
+	if m == nil {
+		return nil, fmt.Errorf("not a pdf file")
+	}
+
+	doc := &pdfDocument{
+		data:       data,
+		version:    string(m[1]),
+		xref:       make(map[int]xrefEntry),
+		cache:      make(map[int]interface{}),
+		objStreams: make(map[int][]interface{}),
+	}
+	err := doc.readXref()
+	if err != nil {
+		// damaged or missing cross-reference table
+		doc.xref = make(map[int]xrefEntry)
+		doc.trailer = nil
+		doc.startxref, doc.xrefStream = 0, false
+		err = doc.rebuildXref()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, fmt.Errorf("encrypted pdf is not supported")
+	}
+	if _, ok := doc.resolve(doc.trailer["Root"]).(pdfDict); !ok {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+	return doc, nil
+}
+
+var startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// read the cross-reference sections starting at the last startxref
+func (doc *pdfDocument) readXref() error {
+	tail := doc.data
+	if len(tail) > 2048 {
+		tail = tail[len(tail)-2048:]
+	}
+	all := startxrefPattern.FindAllSubmatch(tail, -1)
+	if len(all) == 0 {
+		return fmt.Errorf("startxref not found")
+	}
+	offset, _ := strconv.Atoi(string(all[len(all)-1][1]))
+	doc.startxref = offset
+
+	seen := make(map[int]bool)
+	for offset > 0 {
+		if seen[offset] || offset >= len(doc.data) {
+			return fmt.Errorf("invalid xref offset %d", offset)
+		}
+		seen[offset] = true
+
+		trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if doc.trailer == nil {
+			doc.trailer = trailer
+			doc.xrefStream = trailer["Type"] == pdfName("XRef")
+		}
+		// hybrid files keep compressed objects in an extra xref stream
+		if stm, ok := trailer["XRefStm"].(int64); ok {
+			if _, err := doc.readXrefSection(int(stm)); err != nil {
+				return err
+			}
+		}
+		prev, _ := trailer["Prev"].(int64)
+		offset = int(prev)
+	}
+	if doc.trailer == nil {
+		return fmt.Errorf("trailer not found")
+	}
+	return nil
+}
+
+// readXrefSection reads a classic xref table or an xref stream, entries of
+// later sections read first take precedence
+func (doc *pdfDocument) readXrefSection(offset int) (pdfDict, error) {
+	l := newPdfLexer(doc.data)
+	l.pos = offset
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == pdfKeyword("xref") {
+		return doc.readXrefTable(l)
+	}
+
+	// xref stream "n g obj << /Type /XRef ... >> stream"
+	_, obj, err := doc.readObjectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(pdfStream)
+	if !ok || s.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("no xref at offset %d", offset)
+	}
+	return s.dict, doc.readXrefStream(s)
+}
+
+func (doc *pdfDocument) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == pdfKeyword("trailer") {
+			return l.trailerDict()
+		}
+		start, ok1 := tok.(int64)
+		tok, err = l.token()
+		count, ok2 := tok.(int64)
+		if err != nil || !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid xref subsection")
+		}
+		for i := 0; i < int(count); i++ {
+			off, err1 := l.token()
+			gen, err2 := l.token()
+			kind, err3 := l.token()
+			if err1 != nil || err2 != nil || err3 != nil {
+				return nil, fmt.Errorf("invalid xref entry")
+			}
+			num := int(start) + i
+			if _, ok := doc.xref[num]; ok || kind != pdfKeyword("n") {
+				continue
+			}
+			o, _ := off.(int64)
+			g, _ := gen.(int64)
+			if o > 0 {
+				doc.xref[num] = xrefEntry{offset: int(o), gen: int(g)}
+			}
+		}
+	}
+}
+
+// trailerDict reads "<< ... >>" after the trailer keyword
+func (l *pdfLexer) trailerDict() (pdfDict, error) {
+	obj, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := obj.(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("trailer is not a dictionary")
+	}
+	return d, nil
+}
+
+func (doc *pdfDocument) readXrefStream(s pdfStream) error {
+	data, err := doc.decodeStream(s)
+	if err != nil {
+		return fmt.Errorf("xref stream: %v", err)
+	}
+	w, _ := s.dict["W"].(pdfArray)
+	if len(w) != 3 {
+		return fmt.Errorf("xref stream: invalid /W")
+	}
+	var widths [3]int
+	rowSize := 0
+	for i := range widths {
+		n, _ := w[i].(int64)
+		if n < 0 || n > 8 {
+			return fmt.Errorf("xref stream: invalid /W")
+		}
+		widths[i] = int(n)
+		rowSize += int(n)
+	}
+	if rowSize == 0 {
+		return fmt.Errorf("xref stream: invalid /W")
+	}
+	index, _ := s.dict["Index"].(pdfArray)
+	if index == nil {
+		size, _ := s.dict["Size"].(int64)
+		index = pdfArray{int64(0), size}
+	}
+
+	field := func(row []byte, i int) int {
+		start := 0
+		for j := 0; j < i; j++ {
+			start += widths[j]
+		}
+		v := 0
+		for _, b := range row[start : start+widths[i]] {
+			v = v<<8 | int(b)
+		}
+		return v
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for j := 0; j < int(count); j++ {
+			if pos+rowSize > len(data) {
+				return fmt.Errorf("xref stream: truncated")
+			}
+			row := data[pos : pos+rowSize]
+			pos += rowSize
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(row, 0)
+			}
+			num := int(start) + j
+			if _, ok := doc.xref[num]; ok {
+				continue
+			}
+			switch kind {
+			case 1:
+				doc.xref[num] = xrefEntry{offset: field(row, 1), gen: field(row, 2)}
+			case 2:
+				doc.xref[num] = xrefEntry{stream: field(row, 1), index: field(row, 2)}
+			}
+		}
+	}
+	return nil
+}
+
+var objPattern = regexp.MustCompile(`(?m)(\d+)[ \t\r\n]+(\d+)[ \t\r\n]+obj\b`)
+
+// rebuildXref locates objects by scanning the file for "n g obj"
+func (doc *pdfDocument) rebuildXref() error {
+	for _, m := range objPattern.FindAllSubmatchIndex(doc.data, -1) {
+		// the number must start a token
+		if m[0] > 0 && !isPdfWhite(doc.data[m[0]-1]) && !isPdfDelim(doc.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(doc.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(doc.data[m[4]:m[5]]))
+		// later objects replace earlier ones, as incremental updates do
+		doc.xref[num] = xrefEntry{offset: m[0], gen: gen}
+	}
+	if len(doc.xref) == 0 {
+		return fmt.Errorf("no objects found")
+	}
+
+	// objects of object streams, and the catalog for the trailer
+	var root pdfRef
+	for num := range doc.xref {
+		obj := doc.resolve(pdfRef{num: num})
+		switch o := obj.(type) {
+		case pdfStream:
+			if o.dict["Type"] == pdfName("ObjStm") {
+				doc.indexObjStream(num)
+			}
+		case pdfDict:
+			if o["Type"] == pdfName("Catalog") && (root.num == 0 || num > root.num) {
+				root = pdfRef{num: num}
+			}
+		}
+	}
+	doc.cache = make(map[int]interface{})
+
+	tr := bytes.LastIndex(doc.data, []byte("trailer"))
+	if tr >= 0 {
+		l := newPdfLexer(doc.data)
+		l.pos = tr + len("trailer")
+		if d, err := l.trailerDict(); err == nil {
+			doc.trailer = d
+		}
+	}
+	if doc.trailer == nil {
+		doc.trailer = pdfDict{}
+	}
+	if _, ok := doc.resolve(doc.trailer["Root"]).(pdfDict); !ok && root.num > 0 {
+		doc.trailer["Root"] = root
+	}
+	return nil
+}
+
+// add the objects of an object stream missing from the xref
+func (doc *pdfDocument) indexObjStream(num int) {
+	objs, err := doc.objStream(num)
+	if err != nil {
+		return
+	}
+	s := doc.resolve(pdfRef{num: num}).(pdfStream)
+	n, _ := s.dict["N"].(int64)
+	data, _ := doc.decodeStream(s)
+	l := newPdfLexer(data)
+	for i := 0; i < int(n) && i < len(objs); i++ {
+		tok, _ := l.token()
+		l.token()
+		if objNum, ok := tok.(int64); ok {
+			if _, exists := doc.xref[int(objNum)]; !exists {
+				doc.xref[int(objNum)] = xrefEntry{stream: num, index: i}
+			}
+		}
+	}
+}
+
+// readObjectAt parses "n g obj ... endobj" at offset
+func (doc *pdfDocument) readObjectAt(offset int) (int, interface{}, error) {
+	if offset < 0 || offset >= len(doc.data) {
+		return 0, nil, fmt.Errorf("invalid object offset %d", offset)
+	}
+	l := newPdfLexer(doc.data)
+	l.pos = offset
+	num, err1 := l.token()
+	_, err2 := l.token()
+	kw, err3 := l.token()
+	n, ok := num.(int64)
+	if err1 != nil || err2 != nil || err3 != nil || !ok || kw != pdfKeyword("obj") {
+		return 0, nil, fmt.Errorf("no object at offset %d", offset)
+	}
+	obj, err := l.object()
+	if err != nil {
+		return 0, nil, fmt.Errorf("object %d: %v", n, err)
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return int(n), obj, nil
+	}
+
+	save := l.pos
+	if tok, err := l.token(); err != nil || tok != pdfKeyword("stream") {
+		l.pos = save
+		return int(n), obj, nil
+	}
+	// the data starts after the end of line following "stream"
+	if l.pos < len(doc.data) && doc.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(doc.data) && doc.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int64:
+		length = int(v)
+	case pdfRef:
+		if v.num != int(n) {
+			if i, ok := doc.resolve(v).(int64); ok {
+				length = int(i)
+			}
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(doc.data) || !bytes.HasPrefix(bytes.TrimLeft(doc.data[end:], "\r\n \t"), []byte("endstream")) {
+		// wrong length, search the end of the stream
+		i := bytes.Index(doc.data[start:], []byte("endstream"))
+		if i < 0 {
+			return 0, nil, fmt.Errorf("object %d: endstream not found", n)
+		}
+		end = start + i
+		for end > start && (doc.data[end-1] == '\n' || doc.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return int(n), pdfStream{dict: dict, data: doc.data[start:end]}, nil
+}
+
+// resolve returns the object a reference points to, other values are
+// returned as is. Missing objects resolve to nil.
+func (doc *pdfDocument) resolve(v interface{}) interface{} {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return v
+	}
+	if obj, ok := doc.cache[ref.num]; ok {
+		return obj
+	}
+	// guard against reference cycles such as a /Length pointing to itself
+	doc.cache[ref.num] = nil
+
+	var obj interface{}
+	e, ok := doc.xref[ref.num]
+	switch {
+	case !ok:
+	case e.stream > 0:
+		objs, err := doc.objStream(e.stream)
+		if err == nil && e.index >= 0 && e.index < len(objs) {
+			obj = objs[e.index]
+		}
+	default:
+		num, o, err := doc.readObjectAt(e.offset)
+		if err == nil && num == ref.num {
+			obj = o
+		}
+	}
+	doc.cache[ref.num] = obj
+	return obj
+}
+
+// dict resolves v to a dictionary, nil if it is none
+func (doc *pdfDocument) dict(v interface{}) pdfDict {
+	switch o := doc.resolve(v).(type) {
+	case pdfDict:
+		return o
+	case pdfStream:
+		return o.dict
+	}
+	return nil
+}
+
+// array resolves v to an array
+func (doc *pdfDocument) array(v interface{}) pdfArray {
+	a, _ := doc.resolve(v).(pdfArray)
+	return a
+}
+
+// objects of the object stream num
+func (doc *pdfDocument) objStream(num int) ([]interface{}, error) {
+	if objs, ok := doc.objStreams[num]; ok {
+		return objs, nil
+	}
+	doc.objStreams[num] = nil
+
+	s, ok := doc.resolve(pdfRef{num: num}).(pdfStream)
+	if !ok {
+		return nil, fmt.Errorf("object stream %d not found", num)
+	}
+	data, err := doc.decodeStream(s)
+	if err != nil {
+		return nil, fmt.Errorf("object stream %d: %v", num, err)
+	}
+	n, _ := s.dict["N"].(int64)
+	first, _ := s.dict["First"].(int64)
+	// every object takes at least a number and an offset in the header
+	if n < 0 || first < 0 || first > int64(len(data)) || n > int64(len(data)) {
+		return nil, fmt.Errorf("object stream %d: invalid /N or /First", num)
+	}
+
+	l := newPdfLexer(data)
+	offsets := make([]int, 0, n)
+	for i := 0; i < int(n); i++ {
+		l.token()
+		off, err := l.token()
+		o, ok := off.(int64)
+		if err != nil || !ok || o < 0 {
+			return nil, fmt.Errorf("object stream %d: invalid header", num)
+		}
+		offsets = append(offsets, int(first+o))
+	}
+	objs := make([]interface{}, len(offsets))
+	for i, off := range offsets {
+		if off >= len(data) {
+			continue
+		}
+		l.pos = off
+		objs[i], _ = l.object()
+	}
+	doc.objStreams[num] = objs
+	return objs, nil
+}
+
+// decodeStream applies the filters of a stream, FlateDecode with png
+// predictors and ASCIIHexDecode are supported
+func (doc *pdfDocument) decodeStream(s pdfStream) ([]byte, error) {
+	var filters, params pdfArray
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{f}
+	case pdfArray:
+		filters = f
+	}
+	switch p := doc.resolve(s.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = pdfArray{p}
+	case pdfArray:
+		params = p
+	}
+
+	data := s.data
+	for i, f := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = doc.dict(params[i])
+		}
+		var err error
+		switch doc.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = flateDecode(data, param)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = asciiHexDecode(data)
+		default:
+			err = fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func flateDecode(data []byte, param pdfDict) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+
+	predictor, _ := param["Predictor"].(int64)
+	if predictor < 10 {
+		return out, nil
+	}
+	columns := int64(1)
+	if c, ok := param["Columns"].(int64); ok {
+		columns = c
+	}
+	colors := int64(1)
+	if c, ok := param["Colors"].(int64); ok {
+		colors = c
+	}
+	bpc := int64(8)
+	if b, ok := param["BitsPerComponent"].(int64); ok {
+		bpc = b
+	}
+	return pngUnpredict(out, int((columns*colors*bpc+7)/8), int((colors*bpc+7)/8))
+}
+
+// undo png row filters, every row starts with its filter type byte
+func pngUnpredict(data []byte, rowSize, bpp int) ([]byte, error) {
+	if rowSize <= 0 {
+		return nil, fmt.Errorf("invalid predictor columns")
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowSize)
+	for len(data) > 0 {
+		if len(data) < rowSize+1 {
+			break
+		}
+		filter, row := data[0], append([]byte(nil), data[1:rowSize+1]...)
+		data = data[rowSize+1:]
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up = prev[i]
+			switch filter {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid png predictor %d", filter)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPdfWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+// catalog returns the document catalog
+func (doc *pdfDocument) catalog() pdfDict {
+	return doc.dict(doc.trailer["Root"])
+}
+
+// page attributes inherited from the page tree
+var inheritedPageKeys = []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// pdfPage is a page of the document, dict holds the inherited attributes
+type pdfPage struct {
+	ref  pdfRef
+	dict pdfDict
+}
+
+// pages returns the pages in document order
+func (doc *pdfDocument) pages() ([]pdfPage, error) {
+	root := doc.catalog()
+	var pages []pdfPage
+	seen := make(map[int]bool)
+	var walk func(v interface{}, inherited pdfDict) error
+	walk = func(v interface{}, inherited pdfDict) error {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return fmt.Errorf("page tree node is not a reference")
+		}
+		if seen[ref.num] {
+			return fmt.Errorf("page tree contains a cycle")
+		}
+		seen[ref.num] = true
+		node := doc.dict(ref)
+		if node == nil {
+			return fmt.Errorf("page tree node %d not found", ref.num)
+		}
+
+		attrs := make(pdfDict, len(inheritedPageKeys))
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range inheritedPageKeys {
+			if v, ok := node[k]; ok {
+				attrs[k] = v
+			}
+		}
+
+		kids, isTree := node["Kids"]
+		if node["Type"] == pdfName("Pages") || (isTree && node["Type"] != pdfName("Page")) {
+			for _, kid := range doc.array(kids) {
+				if err := walk(kid, attrs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		page := make(pdfDict, len(node)+len(attrs))
+		for k, v := range attrs {
+			page[k] = v
+		}
+		for k, v := range node {
+			page[k] = v
+		}
+		pages = append(pages, pdfPage{ref: ref, dict: page})
+		return nil
+	}
+	err := walk(root["Pages"], nil)
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// pdfField is a form field with its fully qualified name
+type pdfField struct {
+	ref  pdfRef
+	name string
+	dict pdfDict
+	// inherited /FT, /Ff, /V and /DA
+	attrs pdfDict
+}
+
+// fields walks the AcroForm field tree and returns the terminal fields,
+// those whose kids are widgets only
+func (doc *pdfDocument) fields() []pdfField {
+	form := doc.dict(doc.catalog()["AcroForm"])
+	var fields []pdfField
+	seen := make(map[int]bool)
+	var walk func(v interface{}, prefix string, inherited pdfDict)
+	walk = func(v interface{}, prefix string, inherited pdfDict) {
+		ref, isRef := v.(pdfRef)
+		if isRef {
+			if seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+		}
+		d := doc.dict(v)
+		if d == nil {
+			return
+		}
+		name := prefix
+		if t, ok := doc.resolve(d["T"]).(pdfString); ok {
+			name = joinFieldName(prefix, decodeTextString(t))
+		}
+		attrs := make(pdfDict, 4)
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range []pdfName{"FT", "Ff", "V", "DA"} {
+			if v, ok := d[k]; ok {
+				attrs[k] = doc.resolve(v)
+			}
+		}
+
+		// kids with a name are fields, kids without are widgets
+		terminal := true
+		for _, kid := range doc.array(d["Kids"]) {
+			if _, ok := doc.dict(kid)["T"]; ok {
+				terminal = false
+				break
+			}
+		}
+		if terminal {
+			fields = append(fields, pdfField{ref: ref, name: name, dict: d, attrs: attrs})
+			return
+		}
+		for _, kid := range doc.array(d["Kids"]) {
+			walk(kid, name, attrs)
+		}
+	}
+	for _, f := range doc.array(form["Fields"]) {
+		walk(f, "", nil)
+	}
+	return fields
+}
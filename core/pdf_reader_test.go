@@ -0,0 +1,33 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCraftedStreams(t *testing.T) {
+	for _, w := range []pdfArray{{int64(2), int64(-1), int64(3)}, {int64(1), int64(9), int64(1)}} {
+		doc := &pdfDocument{xref: make(map[int]xrefEntry)}
+		s := pdfStream{dict: pdfDict{"W": w, "Size": int64(1)}, data: []byte("abcdefghijk")}
+		if err := doc.readXrefStream(s); err == nil {
+			t.Errorf("readXrefStream accepted /W %v", w)
+		}
+	}
+
+	for _, header := range []struct {
+		n, first int
+		data     string
+	}{{-1, 0, ""}, {1 << 40, 0, "1 0"}, {1, -4, "1 0"}, {1, 100, "1 0"}, {1, 0, "1 -3 true"}} {
+		data := fmt.Sprintf("%%PDF-1.7\n1 0 obj\n<< /Type /ObjStm /N %d /First %d /Length %d >>\nstream\n%s\nendstream\nendobj\n"+
+			"2 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 2 0 R >>\n", header.n, header.first, len(header.data), header.data)
+		doc, err := parsePdf([]byte(data))
+		if err != nil {
+			t.Fatalf("parsePdf:%v", err)
+		}
+		// parsing indexed the stream already, read it again
+		delete(doc.objStreams, 1)
+		if _, err = doc.objStream(1); err == nil {
+			t.Errorf("objStream accepted /N %d /First %d %q", header.n, header.first, header.data)
+		}
+	}
+}
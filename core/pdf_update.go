@@ -0,0 +1,188 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// pdfUpdate collects changed and new objects of a document and writes them
+// as an incremental update appended to the original file, which keeps the
+// original bytes and with them any signatures intact
+type pdfUpdate struct {
+	doc     *pdfDocument
+	objects map[int]interface{}
+	size    int
+}
+
+func (doc *pdfDocument) update() *pdfUpdate {
+	size := 0
+	if n, ok := doc.trailer["Size"].(int64); ok {
+		size = int(n)
+	}
+	for num := range doc.xref {
+		if num >= size {
+			size = num + 1
+		}
+	}
+	return &pdfUpdate{doc: doc, objects: make(map[int]interface{}), size: size}
+}
+
+// set replaces the object num
+func (u *pdfUpdate) set(num int, v interface{}) {
+	u.objects[num] = v
+	u.doc.cache[num] = v
+}
+
+// add stores v as a new object
+func (u *pdfUpdate) add(v interface{}) pdfRef {
+	ref := pdfRef{num: u.size}
+	u.size++
+	u.set(ref.num, v)
+	return ref
+}
+
+// bytes returns the updated file. trailer entries replace the ones of the
+// original trailer, a nil value removes the entry. Documents whose
+// cross-reference table had to be rebuilt are rewritten completely.
+func (u *pdfUpdate) bytes(trailer pdfDict) []byte {
+	t := pdfDict{}
+	for _, k := range []pdfName{"Root", "Info", "ID", "Encrypt"} {
+		if v, ok := u.doc.trailer[k]; ok {
+			t[k] = v
+		}
+	}
+	for k, v := range trailer {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = v
+	}
+
+	if u.doc.startxref == 0 {
+		return u.rewrite(t)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(u.doc.data)
+	if !bytes.HasSuffix(u.doc.data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	offsets := make(map[int]int, len(nums))
+	w := &pdfWriter{}
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		w.buf.Reset()
+		w.offsets = make([]int, num+1)
+		w.writeObject(pdfRef{num: num}, u.objects[num])
+		buf.Write(w.buf.Bytes())
+	}
+
+	t["Size"] = int64(u.size)
+	t["Prev"] = int64(u.doc.startxref)
+	start := buf.Len()
+	if u.doc.xrefStream {
+		// an xref stream continues an xref stream
+		num := u.size
+		t["Size"] = int64(num + 1)
+		offsets[num] = start
+		nums = append(nums, num)
+		var index pdfArray
+		var data bytes.Buffer
+		for _, sub := range xrefSubsections(nums) {
+			index = append(index, int64(sub[0]), int64(len(sub)))
+			for _, n := range sub {
+				var row [7]byte
+				row[0] = 1
+				binary.BigEndian.PutUint32(row[1:5], uint32(offsets[n]))
+				data.Write(row[:])
+			}
+		}
+		t["Type"] = pdfName("XRef")
+		t["W"] = pdfArray{int64(1), int64(4), int64(2)}
+		t["Index"] = index
+		w.buf.Reset()
+		w.offsets = make([]int, num+1)
+		w.writeObject(pdfRef{num: num}, pdfStream{dict: t, data: data.Bytes()})
+		buf.Write(w.buf.Bytes())
+	} else {
+		buf.WriteString("xref\n")
+		for _, sub := range xrefSubsections(nums) {
+			fmt.Fprintf(&buf, "%d %d\n", sub[0], len(sub))
+			for _, n := range sub {
+				fmt.Fprintf(&buf, "%010d 00000 n\r\n", offsets[n])
+			}
+		}
+		buf.WriteString("trailer\n")
+		writePdfObject(&buf, t)
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", start)
+	return buf.Bytes()
+}
+
+// runs of consecutive object numbers
+func xrefSubsections(nums []int) [][]int {
+	var subs [][]int
+	for i, n := range nums {
+		if i > 0 && n == nums[i-1]+1 {
+			subs[len(subs)-1] = append(subs[len(subs)-1], n)
+			continue
+		}
+		subs = append(subs, []int{n})
+	}
+	return subs
+}
+
+// rewrite writes a new file with the changed objects, for documents
+// without a usable cross-reference table
+func (u *pdfUpdate) rewrite(trailer pdfDict) []byte {
+	w := newPdfWriter(u.doc.version)
+	c := newPdfCopier(u.doc, w)
+	t := pdfDict{}
+	for k, v := range trailer {
+		if k == "ID" || k == "Encrypt" {
+			continue
+		}
+		t[k] = c.value(v)
+	}
+	c.flush()
+	return w.finish(t)
+}
+
+// writeFile writes the updated document to destPath, which may be the
+// file the document was read from
+func (u *pdfUpdate) writeFile(destPath string, trailer pdfDict) error {
+	return writeFileAtomic(destPath, u.bytes(trailer))
+}
+
+// writeFileAtomic replaces destPath with data
+func writeFileAtomic(destPath string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(destPath), ".lipdf-*.pdf")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), destPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
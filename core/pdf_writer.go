@@ -0,0 +1,247 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// pdfWriter writes a new pdf file object by object. Object numbers are
+// allocated up front so objects can refer to each other in any order.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func newPdfWriter(version string) *pdfWriter {
+	w := &pdfWriter{offsets: []int{0}}
+	if len(version) == 0 {
+		version = "1.4"
+	}
+	// binary comment, so transfer programs treat the file as binary
+	fmt.Fprintf(&w.buf, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+	return w
+}
+
+// alloc reserves the next object number
+func (w *pdfWriter) alloc() pdfRef {
+	w.offsets = append(w.offsets, -1)
+	return pdfRef{num: len(w.offsets) - 1}
+}
+
+// writeObject writes the object ref, which must have been allocated
+func (w *pdfWriter) writeObject(ref pdfRef, v interface{}) {
+	w.offsets[ref.num] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", ref.num)
+	if s, ok := v.(pdfStream); ok {
+		dict := make(pdfDict, len(s.dict))
+		for k, v := range s.dict {
+			dict[k] = v
+		}
+		dict["Length"] = int64(len(s.data))
+		writePdfObject(&w.buf, dict)
+		w.buf.WriteString("\nstream\n")
+		w.buf.Write(s.data)
+		w.buf.WriteString("\nendstream")
+	} else {
+		writePdfObject(&w.buf, v)
+	}
+	w.buf.WriteString("\nendobj\n")
+}
+
+// add writes v as a new object
+func (w *pdfWriter) add(v interface{}) pdfRef {
+	ref := w.alloc()
+	w.writeObject(ref, v)
+	return ref
+}
+
+// finish writes the cross-reference table and the trailer, objects that
+// were allocated but never written are written as null
+func (w *pdfWriter) finish(trailer pdfDict) []byte {
+	for num, off := range w.offsets {
+		if num > 0 && off < 0 {
+			w.writeObject(pdfRef{num: num}, nil)
+		}
+	}
+
+	start := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n", len(w.offsets))
+	w.buf.WriteString("0000000000 65535 f\r\n")
+	for _, off := range w.offsets[1:] {
+		fmt.Fprintf(&w.buf, "%010d 00000 n\r\n", off)
+	}
+
+	t := make(pdfDict, len(trailer)+1)
+	for k, v := range trailer {
+		t[k] = v
+	}
+	t["Size"] = int64(len(w.offsets))
+	w.buf.WriteString("trailer\n")
+	writePdfObject(&w.buf, t)
+	fmt.Fprintf(&w.buf, "\nstartxref\n%d\n%%%%EOF\n", start)
+	return w.buf.Bytes()
+}
+
+// writeFile finishes the pdf and writes it to path
+func (w *pdfWriter) writeFile(path string, trailer pdfDict) error {
+	return ioutil.WriteFile(path, w.finish(trailer), 0644)
+}
+
+// writePdfObject serializes a direct object
+func writePdfObject(buf *bytes.Buffer, v interface{}) {
+	switch o := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(o))
+	case int64:
+		buf.WriteString(strconv.FormatInt(o, 10))
+	case int:
+		buf.WriteString(strconv.Itoa(o))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(o, 'f', -1, 64))
+	case pdfName:
+		writePdfName(buf, o)
+	case pdfString:
+		writePdfString(buf, o)
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", o.num, o.gen)
+	case pdfKeyword:
+		buf.WriteString(string(o))
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, e := range o {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePdfObject(buf, e)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writePdfName(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writePdfObject(buf, o[pdfName(k)])
+		}
+		buf.WriteString(">>")
+	default:
+		panic(fmt.Sprintf("cannot write %T to pdf", v))
+	}
+}
+
+func writePdfName(buf *bytes.Buffer, n pdfName) {
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < 0x21 || c > 0x7e || c == '#' || isPdfDelim(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// flateStream returns a stream of data compressed with FlateDecode
+func flateStream(dict pdfDict, data []byte) pdfStream {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	d := make(pdfDict, len(dict)+1)
+	for k, v := range dict {
+		d[k] = v
+	}
+	d["Filter"] = pdfName("FlateDecode")
+	return pdfStream{dict: d, data: buf.Bytes()}
+}
+
+// pdfCopier copies objects of a parsed document to a writer, renumbering
+// every object reachable from the copied values
+type pdfCopier struct {
+	src *pdfDocument
+	dst *pdfWriter
+	// new numbers of the source objects
+	refs map[int]pdfRef
+	// source objects waiting to be written
+	queue []int
+	// replacements of source objects, such as a renamed field
+	override map[int]interface{}
+	// entries set on copied dictionaries after their references were
+	// replaced, such as the /Parent of a page in the new page tree
+	fixed map[int]pdfDict
+}
+
+func newPdfCopier(src *pdfDocument, dst *pdfWriter) *pdfCopier {
+	return &pdfCopier{
+		src:      src,
+		dst:      dst,
+		refs:     make(map[int]pdfRef),
+		override: make(map[int]interface{}),
+		fixed:    make(map[int]pdfDict),
+	}
+}
+
+// ref returns the new reference of a source object and queues its copy
+func (c *pdfCopier) ref(r pdfRef) pdfRef {
+	if n, ok := c.refs[r.num]; ok {
+		return n
+	}
+	n := c.dst.alloc()
+	c.refs[r.num] = n
+	c.queue = append(c.queue, r.num)
+	return n
+}
+
+// value returns v with all references replaced by new ones
+func (c *pdfCopier) value(v interface{}) interface{} {
+	switch o := v.(type) {
+	case pdfRef:
+		return c.ref(o)
+	case pdfArray:
+		a := make(pdfArray, len(o))
+		for i, e := range o {
+			a[i] = c.value(e)
+		}
+		return a
+	case pdfDict:
+		d := make(pdfDict, len(o))
+		for k, e := range o {
+			d[k] = c.value(e)
+		}
+		return d
+	case pdfStream:
+		return pdfStream{dict: c.value(o.dict).(pdfDict), data: o.data}
+	}
+	return v
+}
+
+// flush writes all queued objects, including the ones they refer to
+func (c *pdfCopier) flush() {
+	for len(c.queue) > 0 {
+		num := c.queue[0]
+		c.queue = c.queue[1:]
+		obj, ok := c.override[num]
+		if !ok {
+			obj = c.src.resolve(pdfRef{num: num})
+		}
+		obj = c.value(obj)
+		if fixed, ok := c.fixed[num]; ok {
+			if d, ok := obj.(pdfDict); ok {
+				for k, v := range fixed {
+					d[k] = v
+				}
+			}
+		}
+		c.dst.writeObject(c.refs[num], obj)
+	}
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrNoRenderer is returned when the tool of a Renderer is not installed
+var ErrNoRenderer = errors.New("no pdf renderer installed")
+
+// Renderer rasterizes pdf pages for previews. Locally installed tools are
+// used by default, other implementations can be plugged in wherever a
+// Renderer is accepted.
+type Renderer interface {
+	// Render returns the page of the pdf at pdfPath, counted from 1, as
+	// PNG at dpi
+	Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error)
+}
+
+var (
+	// Pdftoppm is the Renderer running pdftoppm of poppler-utils
+	Pdftoppm Renderer = pdftoppmRenderer{}
+	// Ghostscript is the Renderer running gs
+	Ghostscript Renderer = ghostscriptRenderer{}
+	// DefaultRenderer runs pdftoppm, or ghostscript if pdftoppm is not
+	// installed
+	DefaultRenderer Renderer = toolRenderer{}
+)
+
+const (
+	// DefaultDPI is the resolution of previews if none is given
+	DefaultDPI = 96
+	// MaxDPI limits the resolution of previews, a page at 600 dpi is
+	// about 5000 x 7000 pixels
+	MaxDPI = 600
+)
+
+// timeout of rendering a single page
+const renderTimeout = time.Second * 60
+
+// RenderedPage is a page rasterized by RenderPages
+type RenderedPage struct {
+	// Page is counted from 1
+	Page int
+	PNG  []byte
+}
+
+// RenderPages rasterizes the pages of ranges, all pages when ranges is
+// empty, of the pdf at pdfPath to PNG at dpi, DefaultDPI if dpi is 0. A
+// nil r selects DefaultRenderer. Encrypted pdfs are not rendered, decrypt
+// them first with DecryptPDF. Pages of pdfs the native reader cannot count
+// are left to the renderer, an open range ends at the first page it fails
+// to render.
+func RenderPages(ctx context.Context, r Renderer, pdfPath string, ranges []PageRange, dpi int) ([]RenderedPage, error) {
+	if r == nil {
+		r = DefaultRenderer
+	}
+	if dpi == 0 {
+		dpi = DefaultDPI
+	}
+	if dpi < 0 || dpi > MaxDPI {
+		return nil, fmt.Errorf("dpi %d out of range 1 to %d", dpi, MaxDPI)
+	}
+	// -1 if unknown
+	count := -1
+	if doc, err := readPdfFile(pdfPath); err == nil {
+		if pages, err := doc.pages(); err == nil {
+			count = len(pages)
+		}
+	}
+	if len(ranges) == 0 {
+		ranges = []PageRange{{First: 1}}
+	}
+
+	var rendered []RenderedPage
+	for _, pr := range ranges {
+		last := pr.Last
+		// open range of an unknown number of pages
+		unbounded := last == 0 && count < 0
+		if last == 0 {
+			last = count
+		}
+		if count >= 0 && (pr.First < 1 || last > count || pr.First > last) {
+			return nil, fmt.Errorf("page range %v out of the %d pages", pr, count)
+		}
+		if count < 0 && (pr.First < 1 || (!unbounded && pr.First > last)) {
+			return nil, fmt.Errorf("invalid page range %v", pr)
+		}
+		for page := pr.First; unbounded || page <= last; page++ {
+			png, err := r.Render(ctx, pdfPath, page, dpi)
+			if err != nil {
+				if unbounded && page > pr.First {
+					// past the last page
+					break
+				}
+				return nil, fmt.Errorf("fail to render page %d: %w", page, err)
+			}
+			rendered = append(rendered, RenderedPage{Page: page, PNG: png})
+		}
+	}
+	return rendered, nil
+}
+
+// toolRenderer uses the first installed tool
+type toolRenderer struct{}
+
+func (toolRenderer) Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error) {
+	if _, err := exec.LookPath("pdftoppm"); err == nil {
+		return Pdftoppm.Render(ctx, pdfPath, page, dpi)
+	}
+	if _, err := exec.LookPath("gs"); err == nil {
+		return Ghostscript.Render(ctx, pdfPath, page, dpi)
+	}
+	return nil, fmt.Errorf("%w, install pdftoppm (poppler-utils) or ghostscript", ErrNoRenderer)
+}
+
+type pdftoppmRenderer struct{}
+
+func (pdftoppmRenderer) Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error) {
+	n := strconv.Itoa(page)
+	// pdftoppm -png -r 96 -f 1 -l 1 -singlefile in.pdf page
+	args := []string{"-png", "-r", strconv.Itoa(dpi), "-f", n, "-l", n, "-singlefile"}
+	return renderWith(ctx, "pdftoppm", pdfPath, func(pdfPath, dir string) []string {
+		return append(args, pdfPath, filepath.Join(dir, "page"))
+	})
+}
+
+type ghostscriptRenderer struct{}
+
+func (ghostscriptRenderer) Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error) {
+	n := strconv.Itoa(page)
+	args := []string{"-q", "-dSAFER", "-dBATCH", "-dNOPAUSE", "-sDEVICE=png16m", "-r" + strconv.Itoa(dpi),
+		"-dTextAlphaBits=4", "-dGraphicsAlphaBits=4", "-dFirstPage=" + n, "-dLastPage=" + n}
+	return renderWith(ctx, "gs", pdfPath, func(pdfPath, dir string) []string {
+		return append(args, "-sOutputFile="+filepath.Join(dir, "page.png"), pdfPath)
+	})
+}
+
+// renderWith runs the tool name with the args returned for the absolute
+// pdfPath and a temporary directory, the tool writes the page to page.png
+// in it
+func renderWith(ctx context.Context, name, pdfPath string, args func(pdfPath, dir string) []string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrNoRenderer, name)
+	}
+	pdfPath, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	tmpDir, err := ioutil.TempDir("", "render-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary directory fail: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+	_, err = execCmdInDir(ctx, tmpDir, name, args(pdfPath, tmpDir)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s exec fail: %w", name, err)
+	}
+	png, err := ioutil.ReadFile(filepath.Join(tmpDir, "page.png"))
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no page: %v", name, err)
+	}
+	return png, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pageRenderer returns the page number as image
+type pageRenderer struct{}
+
+func (pageRenderer) Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error) {
+	return []byte{byte(page), byte(dpi)}, nil
+}
+
+// twoPageRenderer renders a pdf of two pages it does not read
+type twoPageRenderer struct{}
+
+func (twoPageRenderer) Render(ctx context.Context, pdfPath string, page, dpi int) ([]byte, error) {
+	if page > 2 {
+		return nil, fmt.Errorf("wrong page range given")
+	}
+	return []byte{byte(page)}, nil
+}
+
+func TestRenderPages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "form.pdf")
+	w := newPdfWriter("1.7")
+	pages := w.alloc()
+	var kids pdfArray
+	for i := 0; i < 4; i++ {
+		kids = append(kids, w.add(pdfDict{"Type": pdfName("Page"), "Parent": pages}))
+	}
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": kids, "Count": int64(len(kids)),
+		"MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)}})
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages})
+	if err := w.writeFile(path, pdfDict{"Root": catalog}); err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := RenderPages(context.Background(), pageRenderer{}, path, []PageRange{{First: 3}, {First: 1, Last: 1}}, 0)
+	if err != nil {
+		t.Fatalf("RenderPages:%v", err)
+	}
+	want := []RenderedPage{{3, []byte{3, DefaultDPI}}, {4, []byte{4, DefaultDPI}}, {1, []byte{1, DefaultDPI}}}
+	if !reflect.DeepEqual(rendered, want) {
+		t.Errorf("RenderPages = %v, want %v", rendered, want)
+	}
+	if _, err = RenderPages(context.Background(), pageRenderer{}, path, []PageRange{{First: 2, Last: 5}}, 0); err == nil {
+		t.Errorf("RenderPages rendered a missing page")
+	}
+	if _, err = RenderPages(context.Background(), pageRenderer{}, path, nil, MaxDPI+1); err == nil {
+		t.Errorf("RenderPages accepted dpi %d", MaxDPI+1)
+	}
+
+	// pages of a pdf the native reader cannot parse are left to the renderer
+	unreadable := filepath.Join(dir, "unreadable.pdf")
+	if err = ioutil.WriteFile(unreadable, []byte("%PDF-1.6\nencrypted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err = RenderPages(context.Background(), twoPageRenderer{}, unreadable, []PageRange{{First: 2, Last: 2}, {First: 1}}, 0)
+	if err != nil {
+		t.Fatalf("RenderPages unreadable:%v", err)
+	}
+	want = []RenderedPage{{2, []byte{2}}, {1, []byte{1}}, {2, []byte{2}}}
+	if !reflect.DeepEqual(rendered, want) {
+		t.Errorf("RenderPages unreadable = %v, want %v", rendered, want)
+	}
+	if _, err = RenderPages(context.Background(), twoPageRenderer{}, unreadable, []PageRange{{First: 3}}, 0); err == nil {
+		t.Errorf("RenderPages unreadable rendered a missing page")
+	}
+
+	// without any tool in PATH
+	t.Setenv("PATH", t.TempDir())
+	_, err = RenderPages(context.Background(), nil, path, nil, 0)
+	if !errors.Is(err, ErrNoRenderer) {
+		t.Errorf("RenderPages without renderer = %v, want ErrNoRenderer", err)
+	}
+
+	// a pdftoppm writing its arguments as the page
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\necho \"$@\" > \"$last.png\"\n"
+	if err = ioutil.WriteFile(filepath.Join(bin, "pdftoppm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	ctx := context.Background()
+	rendered, err = RenderPages(ctx, nil, path, []PageRange{{First: 2, Last: 2}}, 150)
+	if err != nil {
+		t.Fatalf("RenderPages with pdftoppm:%v", err)
+	}
+	if args := string(rendered[0].PNG); !strings.HasPrefix(args, "-png -r 150 -f 2 -l 2 -singlefile "+path) {
+		t.Errorf("pdftoppm args = %s", args)
+	}
+	_, err = Ghostscript.Render(ctx, path, 1, 96)
+	if !errors.Is(err, ErrNoRenderer) {
+		t.Errorf("Ghostscript without gs = %v, want ErrNoRenderer", err)
+	}
+}
@@ -0,0 +1,411 @@
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Signer signs pdfs with a private key and its certificate
+type Signer struct {
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+	// Chain holds intermediate certificates, they are embedded in the
+	// signature so that verifiers can build the path to their roots
+	Chain []*x509.Certificate
+}
+
+// ErrWrongPassword is returned for a PKCS#12 file that does not open with
+// the given password
+var ErrWrongPassword = errors.New("wrong password")
+
+// LoadPKCS12 reads a signer from a PKCS#12 file (.p12, .pfx) protected
+// with password
+func LoadPKCS12(data []byte, password string) (*Signer, error) {
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, ErrWrongPassword
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to read pkcs12: %v", err)
+	}
+	return newSigner(key, append([]*x509.Certificate{cert}, chain...))
+}
+
+// LoadPEM reads a signer from PEM data holding an unencrypted private key
+// and the certificates, such as a key file and a certificate file
+// concatenated
+func LoadPEM(data []byte) (*Signer, error) {
+	var key crypto.PrivateKey
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			err = fmt.Errorf("encrypted pem keys are not supported, use a pkcs12 file")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newSigner(key, certs)
+}
+
+// newSigner pairs key with its certificate, the other certificates form
+// the chain
+func newSigner(key crypto.PrivateKey, certs []*x509.Certificate) (*Signer, error) {
+	if key == nil {
+		return nil, fmt.Errorf("no private key found")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	s := &Signer{Key: signer}
+	for _, c := range certs {
+		if s.Certificate == nil && pub.Equal(c.PublicKey) {
+			s.Certificate = c
+			continue
+		}
+		s.Chain = append(s.Chain, c)
+	}
+	if s.Certificate == nil {
+		return nil, fmt.Errorf("no certificate matches the private key")
+	}
+	return s, nil
+}
+
+// SignOptions controls how a pdf is signed
+type SignOptions struct {
+	// Field is the signature field to sign, it is created if the form
+	// has no field of that name. By default the first empty signature
+	// field is signed, or a new field Signature1 is created.
+	Field string
+	// Page and Rect place a created field, Page is counted from 1 and
+	// defaults to the first page. A zero Rect makes the signature
+	// invisible.
+	Page int
+	Rect [4]float64
+	// Name defaults to the common name of the certificate
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	// Time is the signing time shown in the signature dictionary and its
+	// appearance, default now. The CMS signature records the time it was
+	// made.
+	Time time.Time
+}
+
+// room for the signature besides the certificates, in bytes
+const signatureReserve = 4096
+
+// placeholder of the byte range, rewritten with the same width
+const byteRangePlaceholder = "[0 0000000000 0000000000 0000000000]"
+
+// SignPDF signs the pdf at pdfPath with a detached PKCS#7 signature
+// (adbe.pkcs7.detached) and writes the result to destPath. The signature
+// is appended as an incremental update, so earlier signatures stay valid.
+func SignPDF(pdfPath, destPath string, s *Signer, opts SignOptions) error {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	if opts.Time.IsZero() {
+		opts.Time = time.Now()
+	}
+	if len(opts.Name) == 0 {
+		opts.Name = s.Certificate.Subject.CommonName
+	}
+	certs := append([]*x509.Certificate{s.Certificate}, s.Chain...)
+	size := signatureReserve
+	for _, c := range certs {
+		size += len(c.Raw)
+	}
+
+	u := doc.update()
+	value := pdfDict{
+		"Type":      pdfName("Sig"),
+		"Filter":    pdfName("Adobe.PPKLite"),
+		"SubFilter": pdfName("adbe.pkcs7.detached"),
+		"ByteRange": pdfKeyword(byteRangePlaceholder),
+		"Contents":  pdfKeyword("<" + strings.Repeat("0", 2*size) + ">"),
+		"M":         pdfString(pdfDate(opts.Time)),
+	}
+	for k, v := range map[pdfName]string{"Name": opts.Name, "Reason": opts.Reason, "Location": opts.Location, "ContactInfo": opts.ContactInfo} {
+		if len(v) > 0 {
+			value[k] = encodeTextString(v)
+		}
+	}
+	err = doc.addSignatureField(u, u.add(value), opts)
+	if err != nil {
+		return err
+	}
+
+	data := u.bytes(nil)
+	contents := bytes.LastIndex(data, []byte("<"+strings.Repeat("0", 2*size)+">"))
+	byteRange := bytes.LastIndex(data, []byte(byteRangePlaceholder))
+	if contents < 0 || byteRange < 0 {
+		return fmt.Errorf("signature placeholder not found")
+	}
+	// everything but the contents string is signed
+	end := contents + 2*size + 2
+	copy(data[byteRange:], fmt.Sprintf("[0 %010d %010d %010d]", contents, end, len(data)-end))
+	signed := make([]byte, 0, len(data)-(end-contents))
+	signed = append(append(signed, data[:contents]...), data[end:]...)
+
+	sig, err := signCMS(signed, s.Key, certs)
+	if err != nil {
+		return err
+	}
+	if len(sig) > size {
+		return fmt.Errorf("signature of %d bytes exceeds the reserved %d bytes", len(sig), size)
+	}
+	hex.Encode(data[contents+1:], sig)
+	return writeFileAtomic(destPath, data)
+}
+
+// addSignatureField sets the signature value of the field named in opts,
+// creating the field if needed
+func (doc *pdfDocument) addSignatureField(u *pdfUpdate, value pdfRef, opts SignOptions) error {
+	name := opts.Field
+	var field *pdfField
+	fields := doc.fields()
+	names := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		names[f.name] = true
+		if field != nil {
+			continue
+		}
+		if (len(name) == 0 && f.attrs["FT"] == pdfName("Sig") && f.attrs["V"] == nil) || (len(name) > 0 && f.name == name) {
+			field = &fields[i]
+		}
+	}
+
+	acroForm := pdfDict{}
+	for k, v := range doc.dict(doc.catalog()["AcroForm"]) {
+		acroForm[k] = v
+	}
+	// signatures exist, the file is changed by incremental updates only
+	acroForm["SigFlags"] = int64(3)
+
+	if field != nil {
+		if field.attrs["FT"] != pdfName("Sig") {
+			return fmt.Errorf("field %s is not a signature field", field.name)
+		}
+		if field.attrs["V"] != nil {
+			return fmt.Errorf("field %s is already signed", field.name)
+		}
+		if field.ref.num == 0 {
+			return fmt.Errorf("field %s is not an indirect object", field.name)
+		}
+		d := pdfDict{}
+		for k, v := range field.dict {
+			d[k] = v
+		}
+		d["V"] = value
+		u.set(field.ref.num, d)
+		return doc.setAcroForm(u, acroForm)
+	}
+
+	if len(name) == 0 {
+		for i := 1; len(name) == 0 || names[name]; i++ {
+			name = fmt.Sprintf("Signature%d", i)
+		}
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return err
+	}
+	page := opts.Page
+	if page == 0 {
+		page = 1
+	}
+	if page < 0 || page > len(pages) {
+		return fmt.Errorf("no page %d", page)
+	}
+	p := pages[page-1]
+
+	r := opts.Rect
+	widget := pdfDict{
+		"Type":    pdfName("Annot"),
+		"Subtype": pdfName("Widget"),
+		"FT":      pdfName("Sig"),
+		"T":       encodeTextString(name),
+		"V":       value,
+		// printed and locked
+		"F":    int64(132),
+		"Rect": pdfArray{r[0], r[1], r[2], r[3]},
+		"P":    p.ref,
+	}
+	if w, h := r[2]-r[0], r[3]-r[1]; w > 0 && h > 0 {
+		widget["AP"] = pdfDict{"N": u.add(signatureAppearance(w, h, opts))}
+	}
+	ref := u.add(widget)
+
+	pageDict := pdfDict{}
+	for k, v := range doc.dict(p.ref) {
+		pageDict[k] = v
+	}
+	annots := append(pdfArray{}, doc.array(pageDict["Annots"])...)
+	pageDict["Annots"] = append(annots, ref)
+	u.set(p.ref.num, pageDict)
+
+	acroForm["Fields"] = append(append(pdfArray{}, doc.array(acroForm["Fields"])...), ref)
+	return doc.setAcroForm(u, acroForm)
+}
+
+// signatureAppearance draws the signer, date and reason in Helvetica
+func signatureAppearance(width, height float64, opts SignOptions) pdfStream {
+	lines := []string{"Digitally signed by " + opts.Name, "Date: " + opts.Time.Format("2006-01-02 15:04:05 -07:00")}
+	if len(opts.Reason) > 0 {
+		lines = append(lines, "Reason: "+opts.Reason)
+	}
+	size := height / float64(len(lines)) / 1.2
+	if size > 10 {
+		size = 10
+	}
+	var content bytes.Buffer
+	content.WriteString("q\n0 g\nBT\n")
+	fmt.Fprintf(&content, "/F1 %s Tf\n%s TL\n2 %s Td\n", pdfNumber(size), pdfNumber(size*1.2), pdfNumber(height-size-2))
+	for i, line := range lines {
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		writePdfString(&content, pdfString(winAnsiString(line)))
+		content.WriteString(" Tj\n")
+	}
+	content.WriteString("ET\nQ\n")
+	return pdfStream{dict: pdfDict{
+		"Type":    pdfName("XObject"),
+		"Subtype": pdfName("Form"),
+		"BBox":    pdfArray{int64(0), int64(0), width, height},
+		"Resources": pdfDict{"Font": pdfDict{"F1": pdfDict{
+			"Type":     pdfName("Font"),
+			"Subtype":  pdfName("Type1"),
+			"BaseFont": pdfName("Helvetica"),
+			"Encoding": pdfName("WinAnsiEncoding"),
+		}}},
+	}, data: content.Bytes()}
+}
+
+// SignatureStatus is a signature field with the result of its verification
+type SignatureStatus struct {
+	Signature
+	// Signer is the subject of the signing certificate
+	Signer string `json:"Signer,omitempty"`
+	// Intact is true if the signature matches the signed bytes
+	Intact bool `json:"Intact"`
+	// Trusted is true if the signing certificate chains to a root
+	Trusted bool `json:"Trusted"`
+	// Error tells why the signature is not intact or not trusted
+	Error string `json:"Error,omitempty"`
+}
+
+// VerifySignatures checks the signed signature fields of the pdf at
+// pdfPath. Certificates are checked against roots at the signing time,
+// nil roots use the roots of the system.
+func VerifySignatures(pdfPath string, roots *x509.CertPool) ([]SignatureStatus, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]pdfDict)
+	for _, f := range doc.fields() {
+		values[f.name] = doc.dict(f.attrs["V"])
+	}
+	var statuses []SignatureStatus
+	for _, sig := range doc.signatures() {
+		if !sig.Signed {
+			continue
+		}
+		st := SignatureStatus{Signature: sig}
+		err := doc.verifySignature(values[sig.Field], roots, &st)
+		if err != nil {
+			st.Error = err.Error()
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+func (doc *pdfDocument) verifySignature(v pdfDict, roots *x509.CertPool, st *SignatureStatus) error {
+	switch doc.resolve(v["SubFilter"]) {
+	case pdfName("adbe.pkcs7.detached"), pdfName("ETSI.CAdES.detached"):
+	default:
+		return fmt.Errorf("unsupported signature format %v", doc.resolve(v["SubFilter"]))
+	}
+	contents, _ := doc.resolve(v["Contents"]).(pdfString)
+	br := doc.array(v["ByteRange"])
+	if len(br) != 4 {
+		return fmt.Errorf("invalid byte range")
+	}
+	var r [4]int
+	for i, n := range br {
+		x, _ := doc.resolve(n).(int64)
+		r[i] = int(x)
+	}
+	// the range must leave out exactly the contents string
+	if r[0] != 0 || r[1] <= 0 || r[2] <= r[1] || r[1] >= len(doc.data) || r[3] < 0 || r[2]+r[3] > len(doc.data) ||
+		doc.data[r[1]] != '<' || doc.data[r[2]-1] != '>' {
+		return fmt.Errorf("invalid byte range")
+	}
+	signed := make([]byte, 0, r[1]+r[3])
+	signed = append(append(signed, doc.data[:r[1]]...), doc.data[r[2]:r[2]+r[3]]...)
+
+	cms, err := verifyCMS([]byte(contents), signed)
+	if cms != nil {
+		st.Signer = cms.signer.Subject.String()
+	}
+	if err != nil {
+		return err
+	}
+	st.Intact = true
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cms.certs {
+		intermediates.AddCert(c)
+	}
+	at := cms.time
+	if at.IsZero() {
+		at = st.Time
+	}
+	_, err = cms.signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return err
+	}
+	st.Trusted = true
+	return nil
+}
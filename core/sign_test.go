@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// selfSigned returns a key and its self-signed certificate
+func selfSigned(t *testing.T, key crypto.Signer, name string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"lipdf"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:         true,
+		// needed for a CA certificate
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, rsaKey, "Li Lei")
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	pemData := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	signer, err := LoadPEM(pemData)
+	if err != nil {
+		t.Fatalf("LoadPEM:%v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.pdf")
+	err = SignPDF("../file/1022.pdf", signed, signer, SignOptions{
+		Reason: "approved",
+		Rect:   [4]float64{36, 36, 236, 86},
+	})
+	if err != nil {
+		t.Fatalf("SignPDF:%v", err)
+	}
+	orig, _ := ioutil.ReadFile("../file/1022.pdf")
+	data, _ := ioutil.ReadFile(signed)
+	if !bytes.HasPrefix(data, orig) {
+		t.Errorf("SignPDF rewrote the pdf")
+	}
+	statuses, err := VerifySignatures(signed, roots)
+	if err != nil {
+		t.Fatalf("VerifySignatures:%v", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("VerifySignatures = %+v", statuses)
+	}
+	st := statuses[0]
+	if st.Field != "Signature1" || st.Name != "Li Lei" || st.Reason != "approved" || !st.Intact || !st.Trusted || !st.CoversDocument {
+		t.Errorf("status = %+v", st)
+	}
+
+	// a second signer in a new field keeps the first signature intact
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecCert := selfSigned(t, ecKey, "Han Meimei")
+	twice := filepath.Join(dir, "twice.pdf")
+	err = SignPDF(signed, twice, &Signer{Key: ecKey, Certificate: ecCert}, SignOptions{})
+	if err != nil {
+		t.Fatalf("SignPDF:%v", err)
+	}
+	statuses, err = VerifySignatures(twice, roots)
+	if err != nil {
+		t.Fatalf("VerifySignatures:%v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("VerifySignatures = %+v", statuses)
+	}
+	if st := statuses[0]; !st.Intact || !st.Trusted || st.CoversDocument {
+		t.Errorf("first signature = %+v", st)
+	}
+	if st := statuses[1]; st.Field != "Signature2" || !st.Intact || st.Trusted || len(st.Error) == 0 {
+		t.Errorf("untrusted signature = %+v", st)
+	}
+	err = SignPDF(twice, filepath.Join(dir, "again.pdf"), signer, SignOptions{Field: "Signature1"})
+	if err == nil {
+		t.Errorf("SignPDF signed a signed field")
+	}
+
+	// a changed byte breaks the signature
+	i := bytes.Index(data, []byte("/Reason"))
+	data[i+len("/Reason (")] ^= 1
+	tampered := filepath.Join(dir, "tampered.pdf")
+	if err = ioutil.WriteFile(tampered, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = VerifySignatures(tampered, roots)
+	if err != nil {
+		t.Fatalf("VerifySignatures:%v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Intact || len(statuses[0].Error) == 0 {
+		t.Errorf("tampered = %+v", statuses)
+	}
+
+	// a crafted byte range ending at the end of the file is rejected
+	data, _ = ioutil.ReadFile(signed)
+	i = bytes.Index(data, []byte("/ByteRange ["))
+	j := i + bytes.IndexByte(data[i:], ']') + 1
+	crafted := fmt.Sprintf("/ByteRange [0 %d %d 0]", len(data), len(data))
+	copy(data[i:j], crafted+strings.Repeat(" ", j-i-len(crafted)))
+	if err = ioutil.WriteFile(tampered, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = VerifySignatures(tampered, roots)
+	if err != nil {
+		t.Fatalf("VerifySignatures:%v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Intact || statuses[0].Error != "invalid byte range" {
+		t.Errorf("crafted byte range = %+v", statuses)
+	}
+}
+
+func TestLoadPKCS12(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, key, "Li Lei")
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := selfSigned(t, caKey, "lipdf CA")
+	encoders := map[string]*pkcs12.Encoder{"modern": pkcs12.Modern, "des": pkcs12.LegacyDES, "rc2": pkcs12.LegacyRC2}
+	for name, enc := range encoders {
+		p12, err := enc.Encode(key, cert, []*x509.Certificate{ca}, "sécret")
+		if err != nil {
+			t.Fatalf("Encode %s:%v", name, err)
+		}
+		s, err := LoadPKCS12(p12, "sécret")
+		if err != nil {
+			t.Errorf("LoadPKCS12 %s:%v", name, err)
+			continue
+		}
+		if !s.Certificate.Equal(cert) || !key.Equal(s.Key) || len(s.Chain) != 1 || !s.Chain[0].Equal(ca) {
+			t.Errorf("LoadPKCS12 %s returned another key or certificates", name)
+		}
+		if _, err = LoadPKCS12(p12, "wrong"); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("LoadPKCS12 %s with a wrong password = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSigned is returned when a fill would rewrite a signed pdf and so
+// invalidate its signatures, see FillOptions.BreakSignatures
+var ErrSigned = errors.New("pdf is signed, rewriting it invalidates the signatures")
+
+// Signature is a signature field of a pdf
+type Signature struct {
+	Field string `json:"Field"`
+	// Signed is false for empty fields waiting for a signature
+	Signed bool `json:"Signed"`
+	// Name, Reason, Location and Time are given by the signer
+	Name     string    `json:"Name,omitempty"`
+	Reason   string    `json:"Reason,omitempty"`
+	Location string    `json:"Location,omitempty"`
+	Time     time.Time `json:"Time,omitzero"`
+	// CoversDocument is true if the signed bytes reach the end of the
+	// file, false if the file was updated after signing
+	CoversDocument bool `json:"CoversDocument,omitempty"`
+}
+
+// ReadSignatures returns the signature fields of the pdf at pdfPath
+func ReadSignatures(pdfPath string) ([]Signature, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	return doc.signatures(), nil
+}
+
+func (doc *pdfDocument) signatures() []Signature {
+	var sigs []Signature
+	for _, f := range doc.fields() {
+		if f.attrs["FT"] != pdfName("Sig") {
+			continue
+		}
+		sig := Signature{Field: f.name}
+		v := doc.dict(f.attrs["V"])
+		if v == nil {
+			sigs = append(sigs, sig)
+			continue
+		}
+		sig.Signed = true
+		for k, s := range map[pdfName]*string{"Name": &sig.Name, "Reason": &sig.Reason, "Location": &sig.Location} {
+			if t, ok := doc.resolve(v[k]).(pdfString); ok {
+				*s = decodeTextString(t)
+			}
+		}
+		if m, ok := doc.resolve(v["M"]).(pdfString); ok {
+			sig.Time, _ = parsePdfDate(string(m))
+		}
+		// [offset1 length1 offset2 length2] around the signature contents
+		br := doc.array(v["ByteRange"])
+		if len(br) == 4 {
+			off, _ := doc.resolve(br[2]).(int64)
+			n, _ := doc.resolve(br[3]).(int64)
+			sig.CoversDocument = int(off+n) == len(doc.data)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+// signedFields returns the names of the signed signature fields of the pdf
+// at pdfPath, nil if it cannot be read natively
+func signedFields(pdfPath string) map[string]bool {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil
+	}
+	var signed map[string]bool
+	for _, sig := range doc.signatures() {
+		if !sig.Signed {
+			continue
+		}
+		if signed == nil {
+			signed = make(map[string]bool)
+		}
+		signed[sig.Field] = true
+	}
+	return signed
+}
+
+// checkSignatures is called before the pdf at pdfPath is rewritten, it
+// returns ErrSigned for signed pdfs unless BreakSignatures is set
+func (opts *FillOptions) checkSignatures(ctx context.Context, pdfPath string) error {
+	signed, err := isSigned(ctx, pdfPath, opts.Password)
+	if err != nil {
+		return err
+	}
+	if !signed {
+		return nil
+	}
+	if !opts.BreakSignatures {
+		return ErrSigned
+	}
+	log.Printf("fillpdf: rewriting signed pdf '%s', its signatures become invalid", pdfPath)
+	return nil
+}
+
+// isSigned reports whether the pdf at pdfPath has a signed signature field.
+// Pdfs that cannot be read natively, such as encrypted ones, are checked
+// with the pdftk field dump, opened with password.
+func isSigned(ctx context.Context, pdfPath, password string) (bool, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err == nil {
+		for _, sig := range doc.signatures() {
+			if sig.Signed {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "signatures-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+	dumpPath := filepath.Join(tmpDir, "fields.dump")
+	err = dumpFields(ctx, pdfPath, dumpPath, password)
+	if err != nil {
+		return false, fmt.Errorf("fail to check signatures: %w", err)
+	}
+	fields, err := readDumpFields(dumpPath)
+	if err != nil {
+		return false, fmt.Errorf("fail to check signatures: %w", err)
+	}
+	for _, fd := range fields {
+		if fd.FieldType == "Signature" && len(fd.FieldValue) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parsePdfDate parses dates such as D:20190102150405+08'00', all parts after
+// the year are optional
+func parsePdfDate(s string) (time.Time, error) {
+	s = strings.TrimPrefix(s, "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 || digits%2 != 0 {
+		return time.Time{}, fmt.Errorf("invalid pdf date %q", s)
+	}
+	// month and day default to 1
+	parts := []int{0, 1, 1, 0, 0, 0}
+	for i := 0; i*2+4 <= digits; i++ {
+		if i == 0 {
+			parts[0], _ = strconv.Atoi(s[:4])
+			continue
+		}
+		parts[i], _ = strconv.Atoi(s[i*2+2 : i*2+4])
+	}
+
+	loc := time.UTC
+	if rest := s[digits:]; len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		tz := strings.Split(strings.TrimSuffix(rest[1:], "'"), "'")
+		h, _ := strconv.Atoi(tz[0])
+		m := 0
+		if len(tz) > 1 {
+			m, _ = strconv.Atoi(tz[1])
+		}
+		offset := h*3600 + m*60
+		if rest[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, loc), nil
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSignedPdf writes a form with a text field, a checkbox and a signed
+// signature field whose byte range covers the whole file
+func writeSignedPdf(t *testing.T, path string) {
+	w := newPdfWriter("1.7")
+	pages := w.alloc()
+	text := w.add(pdfDict{"FT": pdfName("Tx"), "T": pdfString("Name"), "Type": pdfName("Annot"), "Subtype": pdfName("Widget"),
+		"AP": pdfDict{"N": w.add(pdfStream{dict: pdfDict{}, data: []byte("")})}})
+	box := w.add(pdfDict{"FT": pdfName("Btn"), "T": pdfString("Agree"), "V": pdfName("Off"), "AS": pdfName("Off"),
+		"Type": pdfName("Annot"), "Subtype": pdfName("Widget"),
+		"AP": pdfDict{"N": pdfDict{"Yes": pdfDict{}, "Off": pdfDict{}}}})
+	sigValue := w.add(pdfDict{"Type": pdfName("Sig"), "Filter": pdfName("Adobe.PPKLite"), "Name": pdfString("Li Lei"),
+		"Reason": pdfString("approved"), "M": pdfString("D:20190102150405+08'00'"),
+		"ByteRange": pdfArray{int64(0), int64(10), int64(20), int64(9999999)}})
+	sig := w.add(pdfDict{"FT": pdfName("Sig"), "T": pdfString("Signature1"), "V": sigValue,
+		"Type": pdfName("Annot"), "Subtype": pdfName("Widget")})
+	empty := w.add(pdfDict{"FT": pdfName("Sig"), "T": pdfString("Signature2"), "Type": pdfName("Annot"), "Subtype": pdfName("Widget")})
+	page := w.add(pdfDict{"Type": pdfName("Page"), "Parent": pages, "MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)},
+		"Annots": pdfArray{text, box, sig, empty}})
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": pdfArray{page}, "Count": int64(1)})
+	form := w.add(pdfDict{"Fields": pdfArray{text, box, sig, empty}, "SigFlags": int64(3)})
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages, "AcroForm": form})
+	err := w.writeFile(path, pdfDict{"Root": catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// let the byte range end at the end of the file, keeping the offsets
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("9999999"), []byte(fmt.Sprintf("%07d", len(data)-20)), 1)
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signed.pdf")
+	writeSignedPdf(t, path)
+
+	sigs, err := ReadSignatures(path)
+	if err != nil {
+		t.Fatalf("ReadSignatures:%v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("ReadSignatures = %+v", sigs)
+	}
+	s := sigs[0]
+	want := time.Date(2019, 1, 2, 7, 4, 5, 0, time.UTC)
+	if s.Field != "Signature1" || !s.Signed || s.Name != "Li Lei" || s.Reason != "approved" || !s.Time.Equal(want) || !s.CoversDocument {
+		t.Errorf("signature = %+v", s)
+	}
+	if sigs[1].Field != "Signature2" || sigs[1].Signed {
+		t.Errorf("empty signature = %+v", sigs[1])
+	}
+	if signed := signedFields(path); len(signed) != 1 || !signed["Signature1"] {
+		t.Errorf("signedFields = %v", signed)
+	}
+}
+
+func TestFillSignedUnreadable(t *testing.T) {
+	// not readable natively, the signatures are taken from the pdftk dump
+	fakePdftk(t, `out=""; dump=""
+while [ $# -gt 0 ]; do
+	[ "$1" = dump_data_fields_utf8 ] && dump=1
+	[ "$1" = output ] && out="$2"
+	shift
+done
+if [ -n "$dump" ]; then
+	printf -- '---\nFieldType: Signature\nFieldName: Signature1\nFieldValue: %s\n' "$SIG_VALUE" > "$out"
+else
+	printf filled > "$out"
+fi`)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "encrypted.pdf")
+	if err := ioutil.WriteFile(path, []byte("%PDF-1.6\nencrypted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	form := map[string]interface{}{"Name": "Han Meimei"}
+
+	t.Setenv("SIG_VALUE", "Li Lei")
+	err := FillFormFile(form, path, filepath.Join(dir, "out.pdf"), FillOptions{Password: "secret"})
+	if !errors.Is(err, ErrSigned) {
+		t.Errorf("FillFormFile = %v, want ErrSigned", err)
+	}
+	err = FillFormFile(form, path, filepath.Join(dir, "out.pdf"), FillOptions{Password: "secret", BreakSignatures: true})
+	if err != nil {
+		t.Errorf("FillFormFile with BreakSignatures:%v", err)
+	}
+
+	t.Setenv("SIG_VALUE", "")
+	err = FillFormFile(form, path, filepath.Join(dir, "out.pdf"), FillOptions{Password: "secret"})
+	if err != nil {
+		t.Errorf("FillFormFile with an empty signature field:%v", err)
+	}
+}
+
+func TestFillSigned(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "signed.pdf")
+	writeSignedPdf(t, path)
+	form := map[string]interface{}{"Name": "Han Meimei", "Agree": "Yes", "Unknown": "x"}
+
+	err := FillFormFile(form, path, filepath.Join(dir, "pdftk.pdf"), FillOptions{})
+	if !errors.Is(err, ErrSigned) {
+		t.Errorf("FillFormFile = %v, want ErrSigned", err)
+	}
+	err = FillFormNative(context.Background(), form, path, filepath.Join(dir, "enc.pdf"),
+		FillOptions{Encryption: &Encryption{OwnerPassword: "secret"}})
+	if !errors.Is(err, ErrSigned) {
+		t.Errorf("FillFormNative with encryption = %v, want ErrSigned", err)
+	}
+
+	dest := filepath.Join(dir, "filled.pdf")
+	err = Native.FillForm(context.Background(), form, path, dest, FillOptions{Info: map[string]string{"CaseID": "A1"}})
+	if err != nil {
+		t.Fatalf("FillForm:%v", err)
+	}
+	orig, _ := ioutil.ReadFile(path)
+	filled, _ := ioutil.ReadFile(dest)
+	if !bytes.HasPrefix(filled, orig) {
+		t.Errorf("the fill rewrote the signed bytes")
+	}
+
+	doc, err := readPdfFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]pdfDict)
+	for _, f := range doc.fields() {
+		values[f.name] = f.dict
+	}
+	if v := values["Name"]; decodeTextString(v["V"].(pdfString)) != "Han Meimei" || v["AP"] != nil {
+		t.Errorf("Name = %v", v)
+	}
+	if v := values["Agree"]; v["V"] != pdfName("Yes") || v["AS"] != pdfName("Yes") {
+		t.Errorf("Agree = %v", v)
+	}
+	if doc.dict(doc.catalog()["AcroForm"])["NeedAppearances"] != true {
+		t.Errorf("NeedAppearances is not set")
+	}
+	sigs := doc.signatures()
+	if !sigs[0].Signed || sigs[0].CoversDocument {
+		t.Errorf("signature after fill = %+v", sigs[0])
+	}
+
+	// empty lists clear the fields
+	err = FillFormNative(context.Background(), map[string]interface{}{"Name": []interface{}{}, "Agree": []string{}}, dest, dest, FillOptions{})
+	if err != nil {
+		t.Fatalf("FillFormNative with empty lists:%v", err)
+	}
+	if doc, err = readPdfFile(dest); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range doc.fields() {
+		values[f.name] = f.dict
+	}
+	if v := values["Name"]; v["V"] != pdfString("") {
+		t.Errorf("Name = %v", v)
+	}
+	if v := values["Agree"]; v["V"] != pdfName("Off") || v["AS"] != pdfName("Off") {
+		t.Errorf("Agree = %v", v)
+	}
+
+	err = FillFormNative(context.Background(), map[string]interface{}{"Signature2": "x"}, path, dest, FillOptions{})
+	if err == nil {
+		t.Errorf("FillFormNative filled a signature field")
+	}
+	err = FillFormNative(context.Background(), form, path, dest, FillOptions{Flatten: true})
+	if err == nil {
+		t.Errorf("FillFormNative accepted Flatten")
+	}
+}
+
+func TestParsePdfDate(t *testing.T) {
+	for s, want := range map[string]time.Time{
+		"D:2019":                time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		"D:20190102150405Z":     time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC),
+		"20190102150405-05'30'": time.Date(2019, 1, 2, 20, 34, 5, 0, time.UTC),
+		"D:201901021504+08'00":  time.Date(2019, 1, 2, 7, 4, 0, 0, time.UTC),
+	} {
+		got, err := parsePdfDate(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parsePdfDate(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := parsePdfDate("D:19x"); err == nil {
+		t.Errorf("parsePdfDate accepted an invalid date")
+	}
+}
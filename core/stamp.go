@@ -0,0 +1,301 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Overlay places the pages of one pdf over or under the pages of another
+type Overlay int
+
+const (
+	// Stamp puts the first page of the overlay over every page
+	Stamp Overlay = iota
+	// MultiStamp puts page n of the overlay over page n
+	MultiStamp
+	// Background puts the first page of the overlay under every page,
+	// such as a letterhead
+	Background
+	// MultiBackground puts page n of the overlay under page n
+	MultiBackground
+)
+
+// pdftk operation of the overlay
+func (o Overlay) operation() (string, error) {
+	switch o {
+	case Stamp:
+		return "stamp", nil
+	case MultiStamp:
+		return "multistamp", nil
+	case Background:
+		return "background", nil
+	case MultiBackground:
+		return "multibackground", nil
+	}
+	return "", fmt.Errorf("invalid overlay %d", int(o))
+}
+
+// OverlayPDF applies the pdf at overlayPath to the pdf at pdfPath and writes
+// the result to destPath. Backgrounds only show through transparent areas
+// of the page, stamps cover the page content but not the form fields.
+func OverlayPDF(ctx context.Context, pdfPath, overlayPath, destPath string, overlay Overlay) error {
+	op, err := overlay.operation()
+	if err != nil {
+		return err
+	}
+	overlayPath, err = filepath.Abs(overlayPath)
+	if err != nil {
+		return fmt.Errorf("filepath abs fail|%v|%s", err, overlayPath)
+	}
+	e, err := Exists(overlayPath)
+	if err != nil {
+		return fmt.Errorf("check pdf file Exists fail: %v", err)
+	} else if !e {
+		return fmt.Errorf("pdf file does not Exists: '%s'", overlayPath)
+	}
+
+	// pdftk form.pdf stamp draft.pdf output form.draft.pdf
+	return generateCore(ctx, pdfPath, destPath, []string{op, overlayPath}, nil)
+}
+
+// Watermark is a line of text drawn across a page, such as
+// "DRAFT – NOT FOR LODGEMENT"
+type Watermark struct {
+	// Text is drawn centered on the page, "\n" starts a new line. It is
+	// set in Helvetica, characters outside of Windows-1252 are written
+	// as '?'.
+	Text string
+	// FontSize in points, default 48
+	FontSize float64
+	// Opacity from 0 to 1, default 0.3
+	Opacity float64
+	// Angle turns the text counterclockwise in degrees, such as 45 for a
+	// diagonal from the lower left to the upper right corner
+	Angle float64
+	// Color of the text as red, green and blue from 0 to 1, default black
+	Color [3]float64
+	// Width and Height of the page in points, default A4. AddWatermark
+	// uses the size of the first page.
+	Width  float64
+	Height float64
+}
+
+// page size of A4 in points
+const (
+	a4Width  = 595.276
+	a4Height = 841.89
+)
+
+// WritePDF writes a one page pdf with the watermark to destPath, to be used
+// with OverlayPDF
+func (w Watermark) WritePDF(destPath string) error {
+	data, err := w.pdf()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(destPath, data, 0644)
+}
+
+func (w Watermark) pdf() ([]byte, error) {
+	if len(strings.TrimSpace(w.Text)) == 0 {
+		return nil, fmt.Errorf("watermark without text")
+	}
+	if w.FontSize <= 0 {
+		w.FontSize = 48
+	}
+	if w.Opacity <= 0 || w.Opacity > 1 {
+		w.Opacity = 0.3
+	}
+	if w.Width <= 0 || w.Height <= 0 {
+		w.Width, w.Height = a4Width, a4Height
+	}
+
+	var content bytes.Buffer
+	rad := w.Angle * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	fmt.Fprintf(&content, "q\n/GS0 gs\n%s %s %s rg\n", pdfNumber(w.Color[0]), pdfNumber(w.Color[1]), pdfNumber(w.Color[2]))
+	// origin at the page center, turned by the angle
+	fmt.Fprintf(&content, "%s %s %s %s %s %s cm\n",
+		pdfNumber(cos), pdfNumber(sin), pdfNumber(-sin), pdfNumber(cos), pdfNumber(w.Width/2), pdfNumber(w.Height/2))
+
+	lines := strings.Split(w.Text, "\n")
+	leading := w.FontSize * 1.2
+	for i, line := range lines {
+		text := winAnsiString(line)
+		width := helveticaWidth(text) * w.FontSize / 1000
+		// lines centered around the origin, cap height of Helvetica is 0.718
+		y := (float64(len(lines)-1)/2-float64(i))*leading - w.FontSize*0.718/2
+		fmt.Fprintf(&content, "BT\n/F1 %s Tf\n1 0 0 1 %s %s Tm\n", pdfNumber(w.FontSize), pdfNumber(-width/2), pdfNumber(y))
+		writePdfString(&content, pdfString(text))
+		content.WriteString(" Tj\nET\n")
+	}
+	content.WriteString("Q\n")
+
+	pw := newPdfWriter("1.4")
+	pagesRef := pw.alloc()
+	font := pw.add(pdfDict{
+		"Type":     pdfName("Font"),
+		"Subtype":  pdfName("Type1"),
+		"BaseFont": pdfName("Helvetica"),
+		"Encoding": pdfName("WinAnsiEncoding"),
+	})
+	gs := pw.add(pdfDict{
+		"Type": pdfName("ExtGState"),
+		"ca":   w.Opacity,
+		"CA":   w.Opacity,
+	})
+	contents := pw.add(pdfStream{dict: pdfDict{}, data: content.Bytes()})
+	page := pw.add(pdfDict{
+		"Type":     pdfName("Page"),
+		"Parent":   pagesRef,
+		"MediaBox": pdfArray{int64(0), int64(0), w.Width, w.Height},
+		"Contents": contents,
+		"Resources": pdfDict{
+			"Font":      pdfDict{"F1": font},
+			"ExtGState": pdfDict{"GS0": gs},
+			"ProcSet":   pdfArray{pdfName("PDF"), pdfName("Text")},
+		},
+	})
+	pw.writeObject(pagesRef, pdfDict{
+		"Type":  pdfName("Pages"),
+		"Kids":  pdfArray{page},
+		"Count": int64(1),
+	})
+	catalog := pw.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pagesRef})
+	return pw.finish(pdfDict{"Root": catalog}), nil
+}
+
+// AddWatermark stamps the watermark over every page of the pdf at pdfPath
+// and writes the result to destPath
+func AddWatermark(ctx context.Context, pdfPath, destPath string, w Watermark) error {
+	tmpDir, err := ioutil.TempDir("", "watermark-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer removeTempDir(tmpDir)
+
+	if w.Width <= 0 || w.Height <= 0 {
+		w.Width, w.Height = firstPageSize(pdfPath)
+	}
+	stampPath := filepath.Join(tmpDir, "watermark.pdf")
+	err = w.WritePDF(stampPath)
+	if err != nil {
+		return err
+	}
+	return OverlayPDF(ctx, pdfPath, stampPath, destPath, Stamp)
+}
+
+// size of the first page, zero if the pdf cannot be read natively
+func firstPageSize(pdfPath string) (width, height float64) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return 0, 0
+	}
+	pages, err := doc.pages()
+	if err != nil || len(pages) == 0 {
+		return 0, 0
+	}
+	box := doc.array(pages[0].dict["MediaBox"])
+	if len(box) != 4 {
+		return 0, 0
+	}
+	var r [4]float64
+	for i, v := range box {
+		r[i] = pdfFloat(doc.resolve(v))
+	}
+	width, height = r[2]-r[0], r[3]-r[1]
+	if rotate, _ := pages[0].dict["Rotate"].(int64); rotate%180 != 0 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// pdfFloat converts a pdf number
+func pdfFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// number in content streams, without exponent and trailing zeros
+func pdfNumber(f float64) string {
+	f = math.Round(f*1000) / 1000
+	if f == 0 {
+		// no "-0"
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Windows-1252 codes of the characters outside of Latin-1
+var winAnsiSpecial = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// winAnsiString encodes s for a font with WinAnsiEncoding
+func winAnsiString(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		case winAnsiSpecial[r] != 0:
+			b = append(b, winAnsiSpecial[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
+
+// advance widths of Helvetica for the codes 32 to 126, in 1/1000 em
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// widths of the Windows-1252 symbols above 126, other characters such as
+// accented letters are approximated with 556
+var helveticaHighWidths = map[byte]int{
+	0x82: 222, 0x84: 333, 0x85: 1000, 0x88: 333, 0x89: 1000, 0x8b: 333, 0x8c: 1000,
+	0x91: 222, 0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x97: 1000, 0x98: 333,
+	0x99: 1000, 0x9b: 333, 0x9c: 944, 0xa0: 278, 0xa1: 333, 0xa6: 260, 0xa8: 333,
+	0xa9: 737, 0xaa: 370, 0xab: 556, 0xad: 333, 0xae: 737, 0xaf: 333, 0xb0: 400,
+	0xb1: 584, 0xb2: 333, 0xb3: 333, 0xb4: 333, 0xb6: 537, 0xb7: 278, 0xb8: 333,
+	0xb9: 333, 0xba: 365, 0xbc: 834, 0xbd: 834, 0xbe: 834, 0xbf: 611,
+	0xc6: 1000, 0xd7: 584, 0xe6: 889, 0xf7: 584,
+}
+
+// helveticaWidth returns the width of WinAnsi encoded text in 1/1000 em
+func helveticaWidth(s string) float64 {
+	var width int
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 32 && c <= 126:
+			width += helveticaWidths[c-32]
+		case helveticaHighWidths[c] != 0:
+			width += helveticaHighWidths[c]
+		default:
+			width += 556
+		}
+	}
+	return float64(width)
+}
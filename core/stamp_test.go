@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWatermarkPDF(t *testing.T) {
+	w := Watermark{
+		Text:    "DRAFT – NOT FOR LODGEMENT",
+		Angle:   45,
+		Opacity: 0.25,
+		Color:   [3]float64{1, 0, 0},
+	}
+	data, err := w.pdf()
+	if err != nil {
+		t.Fatalf("pdf:%v", err)
+	}
+	doc, err := parsePdf(data)
+	if err != nil {
+		t.Fatalf("parsePdf:%v", err)
+	}
+	pages, err := doc.pages()
+	if err != nil || len(pages) != 1 {
+		t.Fatalf("pages = %d, %v", len(pages), err)
+	}
+
+	page := pages[0].dict
+	box := doc.array(page["MediaBox"])
+	if len(box) != 4 || box[2] != a4Width || box[3] != a4Height {
+		t.Errorf("MediaBox = %v", box)
+	}
+	res := doc.dict(page["Resources"])
+	gs := doc.dict(doc.dict(res["ExtGState"])["GS0"])
+	if gs["ca"] != 0.25 {
+		t.Errorf("opacity = %v", gs["ca"])
+	}
+	content, ok := doc.resolve(page["Contents"]).(pdfStream)
+	if !ok {
+		t.Fatalf("Contents = %v", page["Contents"])
+	}
+	// en dash in WinAnsiEncoding
+	if !bytes.Contains(content.data, []byte("(DRAFT \x96 NOT FOR LODGEMENT) Tj")) {
+		t.Errorf("text not found in %q", content.data)
+	}
+	if !bytes.Contains(content.data, []byte("1 0 0 rg")) || !bytes.Contains(content.data, []byte("0.707 0.707 -0.707 0.707")) {
+		t.Errorf("color or rotation not found in %q", content.data)
+	}
+
+	if _, err := (Watermark{}).pdf(); err == nil {
+		t.Errorf("watermark without text should fail")
+	}
+}
+
+func TestHelveticaWidth(t *testing.T) {
+	if w := helveticaWidth("Hello"); w != 722+556+222+222+556 {
+		t.Errorf("helveticaWidth = %v", w)
+	}
+	if s := winAnsiString("a–€中"); s != "a\x96\x80?" {
+		t.Errorf("winAnsiString = %q", s)
+	}
+}
+
+func TestFirstPageSize(t *testing.T) {
+	w, h := firstPageSize("../file/1022.pdf")
+	if w != a4Width || h != a4Height {
+		t.Errorf("firstPageSize = %v x %v", w, h)
+	}
+}
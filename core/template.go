@@ -0,0 +1,582 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Template is a form pdf loaded once and reused for many fills. It keeps a
+// private copy of the pdf for pdftk together with the parsed fields and the
+// sha256 checksum of the content, and reloads both when the source file
+// changes. A Template is safe for concurrent use.
+type Template struct {
+	Name    string
+	Version string
+
+	// source of the pdf
+	fsys fs.FS
+	file string
+	// password of an encrypted source, the private copy is decrypted
+	password string
+
+	mu      sync.RWMutex
+	tmpDir  string
+	path    string
+	sum     string
+	size    int64
+	modTime time.Time
+	fields  map[string]Field
+	info    *FieldInfo
+
+	// checksum of the content each mapping was last checked against
+	checked sync.Map
+}
+
+// LoadTemplate loads the pdf at pdfPath, the template is named after the file
+func LoadTemplate(pdfPath string) (*Template, error) {
+	abs, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	name := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+	return loadTemplate(context.Background(), os.DirFS(filepath.Dir(abs)), filepath.Base(abs), name, "", "")
+}
+
+// LoadTemplateContext is LoadTemplate, pdftk is killed when ctx is done. An
+// encrypted pdf is opened with password, which is kept for refreshes, an
+// empty password loads unencrypted pdfs only.
+func LoadTemplateContext(ctx context.Context, pdfPath, password string) (*Template, error) {
+	abs, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	name := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+	return loadTemplate(ctx, os.DirFS(filepath.Dir(abs)), filepath.Base(abs), name, "", password)
+}
+
+// LoadTemplateFS loads the pdf named file from fsys, such as an embed.FS
+func LoadTemplateFS(fsys fs.FS, file, name, version string) (*Template, error) {
+	return loadTemplate(context.Background(), fsys, file, name, version, "")
+}
+
+func loadTemplate(ctx context.Context, fsys fs.FS, file, name, version, password string) (*Template, error) {
+	t := &Template{
+		Name:     name,
+		Version:  version,
+		fsys:     fsys,
+		file:     file,
+		password: password,
+	}
+	_, err := t.refresh(ctx, true)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Checksum returns the hex sha256 of the pdf content
+func (t *Template) Checksum() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sum
+}
+
+// Fields returns the cached form fields keyed by full name
+func (t *Template) Fields() map[string]Field {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	fields := make(map[string]Field, len(t.fields))
+	for k, v := range t.fields {
+		fields[k] = v
+	}
+	return fields
+}
+
+// FieldInfo returns the cached result of PdfFieldsToJSON for the template
+func (t *Template) FieldInfo() *FieldInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	info := *t.info
+	return &info
+}
+
+// Validate checks form data against the cached fields, see ValidateForm
+func (t *Template) Validate(form map[string]interface{}) []ValidationError {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return validateFields(form, t.fields)
+}
+
+// Fill fills form into the template and writes the result to destPath
+func (t *Template) Fill(ctx context.Context, form map[string]interface{}, destPath string, opts FillOptions) error {
+	return t.fillWith(ctx, Pdftk, form, destPath, opts)
+}
+
+func (t *Template) fillWith(ctx context.Context, b Backend, form map[string]interface{}, destPath string, opts FillOptions) error {
+	form, err := t.prepareForm(form, &opts)
+	if err != nil {
+		return err
+	}
+	// the document info, attachments, images and XFA data are set here for
+	// every backend, encryption follows them. DropXFA and Flatten stay
+	// with the backend and are copied for validation only.
+	post := FillOptions{
+		Info:       t.fillInfo(opts.Info),
+		AttachData: opts.AttachData,
+		Images:     opts.Images,
+		FillXFA:    opts.FillXFA,
+		DropXFA:    opts.DropXFA,
+		Flatten:    opts.Flatten,
+		Encryption: opts.Encryption,
+	}
+	err = post.validate()
+	if err != nil {
+		return err
+	}
+	opts.Info, opts.AttachData, opts.FillXFA, opts.Images = nil, "", false, nil
+	if post.updatesOutput() {
+		opts.Encryption = nil
+	} else {
+		post.Encryption = nil
+	}
+
+	t.mu.RLock()
+	if len(t.path) == 0 {
+		t.mu.RUnlock()
+		return fmt.Errorf("template %s is closed", t.Name)
+	}
+	err = b.FillForm(ctx, form, t.path, destPath, opts)
+	t.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	err = post.updateOutput(destPath, form)
+	if err != nil {
+		return err
+	}
+	if post.Encryption != nil {
+		// the output of the Native backend is still signed
+		post.BreakSignatures = opts.BreakSignatures
+		err = post.checkSignatures(ctx, destPath)
+		if err != nil {
+			return err
+		}
+	}
+	return encryptFile(ctx, destPath, post.Encryption)
+}
+
+// fillInfo adds the template name, version and checksum to the document
+// info of a fill, so that outputs can be traced to their template. Fills
+// without info are left untagged.
+func (t *Template) fillInfo(info map[string]string) map[string]string {
+	if info == nil {
+		return nil
+	}
+	tagged := map[string]string{"Template": t.Name, "TemplateChecksum": t.Checksum()}
+	if len(t.Version) > 0 {
+		tagged["TemplateVersion"] = t.Version
+	}
+	for k, v := range info {
+		tagged[k] = v
+	}
+	return tagged
+}
+
+// prepareForm applies the mapping and formats of opts, mapping entries that
+// match no field are logged the first time a mapping is used with this
+// template content
+func (t *Template) prepareForm(form map[string]interface{}, opts *FillOptions) (map[string]interface{}, error) {
+	if m := opts.Mapping; m != nil {
+		t.mu.RLock()
+		last, ok := t.checked.Load(m)
+		if !ok || last.(string) != t.sum {
+			t.checked.Store(m, t.sum)
+			for _, w := range m.Check(t.fields) {
+				log.Printf("template %s: %v", t.Name, w)
+			}
+		}
+		t.mu.RUnlock()
+	}
+	return opts.prepareForm(form)
+}
+
+// CheckMapping lists the entries of m whose target is not a field of the
+// template, fills with m do not log them again
+func (t *Template) CheckMapping(m *FieldMapping) []MappingWarning {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.checked.Store(m, t.sum)
+	return m.Check(t.fields)
+}
+
+// Refresh reloads the template when the content of the source file changed,
+// changed reports whether the cached fields were replaced. Files are only
+// hashed again when their size or modification time differs.
+func (t *Template) Refresh(ctx context.Context) (changed bool, err error) {
+	return t.refresh(ctx, false)
+}
+
+func (t *Template) refresh(ctx context.Context, force bool) (bool, error) {
+	fi, err := fs.Stat(t.fsys, t.file)
+	if err != nil {
+		return false, fmt.Errorf("fail to stat template %s: %v", t.file, err)
+	}
+
+	t.mu.RLock()
+	same := !force && fi.Size() == t.size && fi.ModTime().Equal(t.modTime)
+	t.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	data, err := fs.ReadFile(t.fsys, t.file)
+	if err != nil {
+		return false, fmt.Errorf("fail to read template %s: %v", t.file, err)
+	}
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+
+	t.mu.RLock()
+	same = !force && sum == t.sum
+	t.mu.RUnlock()
+	if same {
+		// touched but identical
+		t.mu.Lock()
+		t.size, t.modTime = fi.Size(), fi.ModTime()
+		t.mu.Unlock()
+		return false, nil
+	}
+
+	// private copy, so pdftk reads exactly the hashed content
+	tmpDir, err := ioutil.TempDir("", "template-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	pdfPath := filepath.Join(tmpDir, "template.pdf")
+	copyPath := pdfPath
+	if len(t.password) > 0 {
+		copyPath = filepath.Join(tmpDir, "encrypted.pdf")
+	}
+	err = ioutil.WriteFile(copyPath, data, 0600)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return false, fmt.Errorf("fail to copy template: %v", err)
+	}
+	if len(t.password) > 0 {
+		// decrypted once, fills need no password
+		err = DecryptPDF(ctx, copyPath, pdfPath, t.password)
+		os.Remove(copyPath)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return false, fmt.Errorf("fail to decrypt template %s: %w", t.file, err)
+		}
+	}
+	fields, err := pdfFormFields(ctx, pdfPath, "")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return false, fmt.Errorf("fail to read fields of template %s: %w", t.file, err)
+	}
+	info := buildFieldInfo(t.file, fields)
+	info.XFA = hasXFA(pdfPath)
+	info.Pages = fieldGeometry(pdfPath).Pages
+
+	t.mu.Lock()
+	oldDir := t.tmpDir
+	t.tmpDir, t.path = tmpDir, pdfPath
+	t.sum, t.size, t.modTime = sum, fi.Size(), fi.ModTime()
+	t.fields, t.info = fields, info
+	t.mu.Unlock()
+
+	removeTempDir(oldDir)
+	return true, nil
+}
+
+// Close removes the private copy of the pdf
+func (t *Template) Close() error {
+	t.mu.Lock()
+	dir := t.tmpDir
+	t.tmpDir, t.path = "", ""
+	t.mu.Unlock()
+	removeTempDir(dir)
+	return nil
+}
+
+func removeTempDir(dir string) {
+	if len(dir) == 0 {
+		return
+	}
+	errD := os.RemoveAll(dir)
+	// Log the error only.
+	if errD != nil {
+		log.Printf("fillpdf: failed to remove temporary directory '%s' again: %v", dir, errD)
+	}
+}
+
+// TemplateInfo describes a registered template
+type TemplateInfo struct {
+	Name     string `json:"Name"`
+	Version  string `json:"Version,omitempty"`
+	Checksum string `json:"Checksum"`
+	Size     int64  `json:"Size"`
+}
+
+// Info returns the name, version and checksum of the template
+func (t *Template) Info() TemplateInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return TemplateInfo{Name: t.Name, Version: t.Version, Checksum: t.sum, Size: t.size}
+}
+
+// Registry holds templates keyed by name and version. Templates are checked
+// for changes on every Get, so a file replaced on disk is picked up without
+// a restart. A Registry is safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]*Template
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{templates: make(map[string]map[string]*Template)}
+}
+
+// Register loads the pdf at pdfPath as version of the template name,
+// replacing a template registered before under the same key
+func (r *Registry) Register(name, version, pdfPath string) (*Template, error) {
+	abs, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	return r.register(context.Background(), os.DirFS(filepath.Dir(abs)), filepath.Base(abs), name, version, "")
+}
+
+// RegisterContext is Register, pdftk is killed when ctx is done. An
+// encrypted pdf is opened with password, see LoadTemplateContext.
+func (r *Registry) RegisterContext(ctx context.Context, name, version, pdfPath, password string) (*Template, error) {
+	abs, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	return r.register(ctx, os.DirFS(filepath.Dir(abs)), filepath.Base(abs), name, version, password)
+}
+
+func (r *Registry) register(ctx context.Context, fsys fs.FS, file, name, version, password string) (*Template, error) {
+	t, err := loadTemplate(ctx, fsys, file, name, version, password)
+	if err != nil {
+		return nil, err
+	}
+	r.add(name, version, t)
+	return t, nil
+}
+
+// Add registers t, loaded with LoadTemplateContext from a file that was
+// moved to pdfPath since, as version of the template name. The parsed
+// fields are kept, so an upload can be loaded before it replaces the stored
+// template. t must not be in use yet.
+func (r *Registry) Add(name, version, pdfPath string, t *Template) error {
+	abs, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return fmt.Errorf("filepath abs fail|%v|%s", err, pdfPath)
+	}
+	t.mu.Lock()
+	t.Name, t.Version = name, version
+	t.fsys, t.file = os.DirFS(filepath.Dir(abs)), filepath.Base(abs)
+	if t.info != nil {
+		info := *t.info
+		info.PdfPath = t.file
+		t.info = &info
+	}
+	t.mu.Unlock()
+	r.add(name, version, t)
+	return nil
+}
+
+// add replaces the template of name and version with t
+func (r *Registry) add(name, version string, t *Template) {
+	r.mu.Lock()
+	versions, ok := r.templates[name]
+	if !ok {
+		versions = make(map[string]*Template)
+		r.templates[name] = versions
+	}
+	old := versions[version]
+	versions[version] = t
+	r.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// LoadDir registers every pdf below dir, see LoadFS for the layout
+func (r *Registry) LoadDir(dir string) error {
+	return r.LoadFS(os.DirFS(dir))
+}
+
+// LoadFS registers every pdf of fsys, such as an embed.FS. A file
+// "name.pdf" is registered as template name without version, a file
+// "name/version.pdf" as the given version of name.
+func (r *Registry) LoadFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.ToLower(path.Ext(file)) != ".pdf" {
+			return nil
+		}
+		name, version := templateKey(file)
+		_, err = r.register(context.Background(), fsys, file, name, version, "")
+		return err
+	})
+}
+
+// name and version of a template file
+func templateKey(file string) (name, version string) {
+	base := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	dir := path.Dir(file)
+	if dir == "." {
+		return base, ""
+	}
+	return dir, base
+}
+
+// Get returns version of the template name, the highest version when
+// version is empty. The template is refreshed if its file changed.
+func (r *Registry) Get(name, version string) (*Template, error) {
+	return r.GetContext(context.Background(), name, version)
+}
+
+// GetContext is Get, pdftk refreshing a changed template is killed when ctx
+// is done
+func (r *Registry) GetContext(ctx context.Context, name, version string) (*Template, error) {
+	r.mu.RLock()
+	versions := r.templates[name]
+	if len(version) == 0 {
+		version = latestVersion(versions)
+	}
+	t, ok := versions[version]
+	r.mu.RUnlock()
+	if !ok {
+		if len(version) > 0 {
+			return nil, fmt.Errorf("template %s version %s not found", name, version)
+		}
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	_, err := t.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Remove drops a template version, or all versions when version is empty
+func (r *Registry) Remove(name, version string) bool {
+	r.mu.Lock()
+	var removed []*Template
+	if len(version) == 0 {
+		for _, t := range r.templates[name] {
+			removed = append(removed, t)
+		}
+		delete(r.templates, name)
+	} else if t, ok := r.templates[name][version]; ok {
+		removed = append(removed, t)
+		delete(r.templates[name], version)
+		if len(r.templates[name]) == 0 {
+			delete(r.templates, name)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, t := range removed {
+		t.Close()
+	}
+	return len(removed) > 0
+}
+
+// List describes all registered templates ordered by name and version
+func (r *Registry) List() []TemplateInfo {
+	r.mu.RLock()
+	list := make([]TemplateInfo, 0, len(r.templates))
+	for _, versions := range r.templates {
+		for _, t := range versions {
+			list = append(list, t.Info())
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return versionLess(list[i].Version, list[j].Version)
+	})
+	return list
+}
+
+// Close releases all templates
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	templates := r.templates
+	r.templates = make(map[string]map[string]*Template)
+	r.mu.Unlock()
+
+	for _, versions := range templates {
+		for _, t := range versions {
+			t.Close()
+		}
+	}
+	return nil
+}
+
+func latestVersion(versions map[string]*Template) string {
+	latest := ""
+	first := true
+	for v := range versions {
+		if first || versionLess(latest, v) {
+			latest = v
+			first = false
+		}
+	}
+	return latest
+}
+
+// versionLess orders versions such as "2019-01" < "2019-10" or "1.2" < "1.10"
+// by comparing their numeric parts as numbers
+func versionLess(a, b string) bool {
+	as := strings.FieldsFunc(a, isVersionSep)
+	bs := strings.FieldsFunc(b, isVersionSep)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return an < bn
+		}
+		return as[i] < bs[i]
+	}
+	if len(as) != len(bs) {
+		return len(as) < len(bs)
+	}
+	return a < b
+}
+
+func isVersionSep(r rune) bool {
+	return r == '.' || r == '-' || r == '_'
+}
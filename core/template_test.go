@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+
+	_, err := r.Register("1022", "2019-01", "../file/1022.pdf")
+	skipNoPdftk(t, err)
+	if err != nil {
+		t.Fatalf("Register:%v", err)
+	}
+	err = r.LoadFS(os.DirFS("../file"))
+	if err != nil {
+		t.Fatalf("LoadFS:%v", err)
+	}
+
+	tmpl, err := r.Get("1022", "")
+	if err != nil {
+		t.Fatalf("Get:%v", err)
+	}
+	if tmpl.Version != "2019-01" {
+		t.Fatalf("Get: latest version %q", tmpl.Version)
+	}
+	if len(tmpl.Fields()) == 0 || len(tmpl.Checksum()) != 64 {
+		t.Fatalf("Get: template not loaded %+v", tmpl.Info())
+	}
+	if len(r.List()) != 2 {
+		t.Fatalf("List: %+v", r.List())
+	}
+}
+
+func TestTemplateKey(t *testing.T) {
+	tests := []struct {
+		file, name, version string
+	}{
+		{"1022.pdf", "1022", ""},
+		{"1022/2019-01.pdf", "1022", "2019-01"},
+	}
+	for _, tt := range tests {
+		name, version := templateKey(tt.file)
+		if name != tt.name || version != tt.version {
+			t.Fatalf("templateKey(%s) = %s, %s", tt.file, name, version)
+		}
+	}
+
+	ordered := []string{"", "1", "1.2", "1.10", "2019-01", "2019-10", "v2"}
+	for i := 1; i < len(ordered); i++ {
+		if !versionLess(ordered[i-1], ordered[i]) || versionLess(ordered[i], ordered[i-1]) {
+			t.Fatalf("versionLess(%q, %q)", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestRegistryAdd(t *testing.T) {
+	// fields are parsed from an empty dump
+	fakePdftk(t, `while [ $# -gt 0 ]; do [ "$1" = output ] && : > "$2"; shift; done`)
+	dir := t.TempDir()
+	upload := filepath.Join(dir, ".upload")
+	data, err := ioutil.ReadFile("../file/1022.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(upload, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := LoadTemplateContext(context.Background(), upload, "")
+	if err != nil {
+		t.Fatalf("LoadTemplateContext:%v", err)
+	}
+	dest := filepath.Join(dir, "1022.pdf")
+	if err = os.Rename(upload, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	defer r.Close()
+	if err = r.Add("1022", "2019-01", dest, tmpl); err != nil {
+		t.Fatalf("Add:%v", err)
+	}
+	// the moved file is not parsed again
+	fakePdftk(t, "exit 1")
+	got, err := r.GetContext(context.Background(), "1022", "")
+	if err != nil {
+		t.Fatalf("GetContext:%v", err)
+	}
+	if got != tmpl || got.Name != "1022" || got.Version != "2019-01" || got.FieldInfo().PdfPath != "1022.pdf" {
+		t.Errorf("GetContext = %+v, %s", got.Info(), got.FieldInfo().PdfPath)
+	}
+}
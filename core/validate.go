@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// field flags of the pdf specification, as reported in FieldFlags
+const (
+	flagReadOnly   = 1 << 0
+	flagPushButton = 1 << 16
+	flagEdit       = 1 << 18
+)
+
+// ValidationError describes form data that does not fit the pdf form
+type ValidationError struct {
+	Field   string `json:"Field"`
+	Value   string `json:"Value,omitempty"`
+	Message string `json:"Message"`
+}
+
+func (e ValidationError) Error() string {
+	if len(e.Value) > 0 {
+		return fmt.Sprintf("%s: %s (value %q)", e.Field, e.Message, e.Value)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidateForm checks form data against the fields of the pdf before a fill:
+// unknown field names, values that are not an option of a checkbox, radio or
+// choice field, text longer than the field allows and writes to read only
+// fields. An empty result means the data fits the form.
+func ValidateForm(form map[string]interface{}, pdfPath string) ([]ValidationError, error) {
+	return ValidateFormContext(context.Background(), form, pdfPath, "")
+}
+
+// ValidateFormContext is ValidateForm for a pdf opened with password, which
+// may be empty, pdftk is killed when ctx is done
+func ValidateFormContext(ctx context.Context, form map[string]interface{}, pdfPath string, password string) ([]ValidationError, error) {
+	fields, err := pdfFormFields(ctx, pdfPath, password)
+	if err != nil {
+		return nil, err
+	}
+	return validateFields(form, fields), nil
+}
+
+func validateFields(form map[string]interface{}, fields map[string]Field) []ValidationError {
+	var errs []ValidationError
+	for _, key := range sortedKeys(form) {
+		fd, ok := fields[key]
+		if !ok {
+			errs = append(errs, ValidationError{Field: key, Message: "no such field"})
+			continue
+		}
+		values, multi := formValueList(form[key])
+
+		if fd.FieldFlags&flagReadOnly != 0 {
+			errs = append(errs, ValidationError{Field: key, Message: "field is read only"})
+		}
+
+		switch fd.FieldType {
+		case "Button":
+			if fd.FieldFlags&flagPushButton != 0 || len(fd.FieldOptions) == 0 {
+				errs = append(errs, ValidationError{Field: key, Message: "push button holds no value"})
+				continue
+			}
+			if multi {
+				errs = append(errs, ValidationError{Field: key, Value: formValueString(form[key]), Message: "button takes a single value"})
+				continue
+			}
+			if len(values[0]) > 0 && !hasOption(fd, values[0]) {
+				errs = append(errs, ValidationError{Field: key, Value: values[0], Message: fmt.Sprintf("not one of %q", fd.FieldOptions)})
+			}
+		case "Choice":
+			if fd.FieldFlags&flagEdit != 0 || len(fd.FieldOptions) == 0 {
+				continue
+			}
+			for _, v := range values {
+				if len(v) > 0 && !hasOption(fd, v) {
+					errs = append(errs, ValidationError{Field: key, Value: v, Message: fmt.Sprintf("not one of %q", fd.FieldOptions)})
+				}
+			}
+		case "Text":
+			if multi {
+				errs = append(errs, ValidationError{Field: key, Value: formValueString(form[key]), Message: "text field takes a single value"})
+				continue
+			}
+			if fd.FieldMaxLength > 0 && utf8.RuneCountInString(values[0]) > fd.FieldMaxLength {
+				errs = append(errs, ValidationError{Field: key, Value: values[0], Message: fmt.Sprintf("longer than %d characters", fd.FieldMaxLength)})
+			}
+		case "Signature":
+			errs = append(errs, ValidationError{Field: key, Message: "signature fields cannot be filled"})
+		}
+	}
+	return errs
+}
+
+func hasOption(fd Field, value string) bool {
+	for _, o := range fd.FieldOptions {
+		if o == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package core
+
+import "context"
+
+// FormValues reads the current value of every form field of the pdf,
+// keyed by full field name. The result can be passed to Unmarshal or
+// back to FillForm.
+func FormValues(pdfPath string) (map[string]interface{}, error) {
+	return FormValuesContext(context.Background(), pdfPath, "")
+}
+
+// FormValuesContext is FormValues for a pdf opened with password, which may
+// be empty, pdftk is killed when ctx is done
+func FormValuesContext(ctx context.Context, pdfPath string, password string) (map[string]interface{}, error) {
+	fields, err := pdfFormFields(ctx, pdfPath, password)
+	if err != nil {
+		return nil, err
+	}
+	return fieldValues(fields), nil
+}
+
+// current values of dumped fields
+func fieldValues(fields map[string]Field) map[string]interface{} {
+	form := make(map[string]interface{}, len(fields))
+	for k, fd := range fields {
+		form[k] = fd.FieldValue
+	}
+	return form
+}
+
+// FormValuesNative is FormValues without pdftk. Values of multi-select
+// fields are returned as []string.
+func FormValuesNative(pdfPath string) (map[string]interface{}, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	return doc.values(), nil
+}
+
+func (doc *pdfDocument) values() map[string]interface{} {
+	form := make(map[string]interface{})
+	for _, f := range doc.fields() {
+		switch v := f.attrs["V"].(type) {
+		case pdfName:
+			form[f.name] = string(v)
+		case pdfString:
+			form[f.name] = decodeTextString(v)
+		case pdfArray:
+			values := make([]string, 0, len(v))
+			for _, e := range v {
+				if s, ok := doc.resolve(e).(pdfString); ok {
+					values = append(values, decodeTextString(s))
+				}
+			}
+			form[f.name] = values
+		default:
+			// unset fields and signatures, like pdftk
+			form[f.name] = ""
+		}
+	}
+	return form
+}
@@ -0,0 +1,556 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XFAForm is the XFA part of a pdf form. Hybrid forms carry an AcroForm
+// beside it, which pdftk fills while XFA viewers such as Adobe Reader show
+// the XFA data, so a fill appears empty unless the XFA is dropped or its
+// datasets are filled as well.
+type XFAForm struct {
+	// Fields of the XFA template in document order
+	Fields []XFAField `json:"Fields"`
+	// Data holds the values of the XFA datasets keyed by the dotted path
+	// of their data node, such as "form1.Page1.LastName". Repeated nodes
+	// after the first carry their index, "form1.Row[1].Name".
+	Data map[string]string `json:"Data"`
+}
+
+// XFAField is a field of an XFA template
+type XFAField struct {
+	// Name is the dotted path of named subforms and the field, such as
+	// "form1.Page1.LastName", the path of its data node with the default
+	// data binding
+	Name string `json:"Name"`
+	// Type is text, checkbox, radio, choice, date, numeric, signature,
+	// button, image, password or barcode
+	Type    string   `json:"Type"`
+	Options []string `json:"Options,omitempty"`
+}
+
+// xfaPacket is a part of the XFA stream array, such as the template or
+// the datasets
+type xfaPacket struct {
+	name string
+	ref  pdfRef
+	data []byte
+}
+
+// xfaPackets returns the XFA packets of the form, nil without XFA. A form
+// holding the whole XDP in one stream has a single packet named "xdp".
+func (doc *pdfDocument) xfaPackets() ([]xfaPacket, error) {
+	form := doc.dict(doc.catalog()["AcroForm"])
+	xfa, ok := form["XFA"]
+	if !ok {
+		return nil, nil
+	}
+	var packets []xfaPacket
+	switch v := doc.resolve(xfa).(type) {
+	case pdfStream:
+		ref, _ := xfa.(pdfRef)
+		packets = append(packets, xfaPacket{name: "xdp", ref: ref})
+	case pdfArray:
+		for i := 0; i+1 < len(v); i += 2 {
+			name, _ := doc.resolve(v[i]).(pdfString)
+			ref, _ := v[i+1].(pdfRef)
+			packets = append(packets, xfaPacket{name: string(name), ref: ref})
+		}
+	default:
+		return nil, fmt.Errorf("invalid XFA entry")
+	}
+	for i, p := range packets {
+		s, ok := doc.resolve(p.ref).(pdfStream)
+		if !ok {
+			return nil, fmt.Errorf("XFA packet %s not found", p.name)
+		}
+		data, err := doc.decodeStream(s)
+		if err != nil {
+			return nil, fmt.Errorf("XFA packet %s: %v", p.name, err)
+		}
+		packets[i].data = data
+	}
+	return packets, nil
+}
+
+// hasXFA reports whether the pdf at pdfPath has an XFA form, false if it
+// cannot be read natively
+func hasXFA(pdfPath string) bool {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return false
+	}
+	_, ok := doc.dict(doc.catalog()["AcroForm"])["XFA"]
+	return ok
+}
+
+// DropXFA writes the pdf at pdfPath without its XFA form to destPath, so
+// that viewers show the AcroForm
+func DropXFA(ctx context.Context, pdfPath, destPath string) error {
+	// pdftk form.pdf output form.acro.pdf drop_xfa
+	return generateCore(ctx, pdfPath, destPath, nil, []string{"drop_xfa"})
+}
+
+// ReadXFA parses the XFA template and datasets of the pdf at pdfPath, it
+// fails if the pdf has no XFA form
+func ReadXFA(pdfPath string) (*XFAForm, error) {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := doc.xfaPackets()
+	if err != nil {
+		return nil, err
+	}
+	if packets == nil {
+		return nil, fmt.Errorf("pdf has no XFA form")
+	}
+
+	xfa := &XFAForm{Data: make(map[string]string)}
+	template, err := xfaNode(packets, "template")
+	if err != nil {
+		return nil, err
+	}
+	if template != nil {
+		seen := make(map[string]bool)
+		for _, c := range template.elements() {
+			xfa.Fields = readXFAFields(xfa.Fields, c, nil, seen)
+		}
+	}
+	datasets, err := xfaNode(packets, "datasets")
+	if err != nil {
+		return nil, err
+	}
+	if data := datasets.child("data"); data != nil {
+		readXFAData(xfa.Data, data, "")
+	}
+	return xfa, nil
+}
+
+// xfaNode parses the packet name, which is either a packet of its own or
+// a child of the XDP
+func xfaNode(packets []xfaPacket, name string) (*xmlNode, error) {
+	for _, p := range packets {
+		if p.name != name && p.name != "xdp" {
+			continue
+		}
+		root, err := parseXMLNode(p.data)
+		if err != nil {
+			return nil, fmt.Errorf("XFA %s: %v", p.name, err)
+		}
+		if p.name == "xdp" {
+			root = root.child("xdp")
+		}
+		return root.child(name), nil
+	}
+	return nil, nil
+}
+
+// ui elements of XFA fields
+var xfaFieldTypes = map[string]string{
+	"textEdit":     "text",
+	"checkButton":  "checkbox",
+	"choiceList":   "choice",
+	"dateTimeEdit": "date",
+	"numericEdit":  "numeric",
+	"signature":    "signature",
+	"button":       "button",
+	"imageEdit":    "image",
+	"passwordEdit": "password",
+	"barcode":      "barcode",
+}
+
+// readXFAFields collects the fields below the template node n, path holds
+// the names of the enclosing subforms
+func readXFAFields(fields []XFAField, n *xmlNode, path []string, seen map[string]bool) []XFAField {
+	name := n.attr("name")
+	switch n.name.Local {
+	case "subform", "subformSet", "area":
+		// unnamed subforms and areas do not add to the data path
+		if len(name) > 0 && n.name.Local == "subform" {
+			path = append(path[:len(path):len(path)], name)
+		}
+		for _, c := range n.elements() {
+			fields = readXFAFields(fields, c, path, seen)
+		}
+	case "field", "exclGroup":
+		if len(name) == 0 {
+			return fields
+		}
+		f := XFAField{Name: strings.Join(append(path[:len(path):len(path)], name), "."), Type: "text"}
+		if seen[f.Name] {
+			return fields
+		}
+		seen[f.Name] = true
+		if n.name.Local == "exclGroup" {
+			// the on values of the buttons are the options of the group
+			f.Type = "radio"
+			for _, c := range n.elements() {
+				if c.name.Local == "field" {
+					f.Options = append(f.Options, c.child("items").texts()...)
+				}
+			}
+		} else {
+			for _, c := range n.child("ui").elements() {
+				if t, ok := xfaFieldTypes[c.name.Local]; ok {
+					f.Type = t
+				}
+			}
+			if f.Type == "choice" {
+				f.Options = n.child("items").texts()
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// readXFAData collects the values of the leaves below the data node n
+func readXFAData(data map[string]string, n *xmlNode, prefix string) {
+	count := make(map[string]int)
+	for _, c := range n.elements() {
+		key := c.name.Local
+		if i := count[key]; i > 0 {
+			key += "[" + strconv.Itoa(i) + "]"
+		}
+		count[c.name.Local]++
+		if len(prefix) > 0 {
+			key = prefix + "." + key
+		}
+		if len(c.elements()) == 0 {
+			data[key] = c.text()
+			continue
+		}
+		readXFAData(data, c, key)
+	}
+}
+
+// FillXFANative writes form into the XFA datasets of the pdf at pdfPath and
+// writes the result to destPath as an incremental update. Keys are data
+// paths such as "form1.Page1.LastName", the AcroForm names of hybrid forms
+// such as "form1[0].Page1[0].LastName[0]" are accepted as well. The
+// AcroForm fields are not changed.
+func FillXFANative(form map[string]interface{}, pdfPath, destPath string) error {
+	doc, err := readPdfFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	u := doc.update()
+	err = doc.fillXFA(u, form)
+	if err != nil {
+		return err
+	}
+	return u.writeFile(destPath, nil)
+}
+
+// namespace of XFA datasets
+const xfaDataNamespace = "http://www.xfa.org/schema/xfa-data/1.0/"
+
+// fillXFA adds the datasets filled with form to the update
+func (doc *pdfDocument) fillXFA(u *pdfUpdate, form map[string]interface{}) error {
+	packets, err := doc.xfaPackets()
+	if err != nil {
+		return err
+	}
+	if packets == nil {
+		return fmt.Errorf("pdf has no XFA form")
+	}
+
+	// the parsed packet holding the datasets and the stream it is
+	// written to
+	var root, parent, datasets *xmlNode
+	var ref pdfRef
+	for _, p := range packets {
+		if p.name != "datasets" && p.name != "xdp" {
+			continue
+		}
+		root, err = parseXMLNode(p.data)
+		if err != nil {
+			return fmt.Errorf("XFA %s: %v", p.name, err)
+		}
+		parent, ref = root, p.ref
+		if p.name == "xdp" {
+			parent = root.child("xdp")
+			if parent == nil {
+				return fmt.Errorf("XFA xdp element not found")
+			}
+		}
+		datasets = parent.child("datasets")
+		break
+	}
+	if datasets == nil {
+		datasets = &xmlNode{
+			name:  xml.Name{Space: "xfa", Local: "datasets"},
+			attrs: []xml.Attr{{Name: xml.Name{Space: "xmlns", Local: "xfa"}, Value: xfaDataNamespace}},
+		}
+		if parent == nil {
+			root = &xmlNode{}
+			parent = root
+		}
+		parent.children = append(parent.children, datasets)
+	}
+	data := datasets.child("data")
+	if data == nil {
+		data = &xmlNode{name: xml.Name{Space: datasets.name.Space, Local: "data"}}
+		datasets.children = append(datasets.children, data)
+	}
+
+	for _, key := range sortedKeys(form) {
+		n := data
+		for _, seg := range strings.Split(key, ".") {
+			name, index := xfaSegment(seg)
+			n = n.elementAt(name, index)
+		}
+		n.setText(formValueString(form[key]))
+	}
+
+	var buf bytes.Buffer
+	root.write(&buf)
+	stream := flateStream(pdfDict{}, buf.Bytes())
+	if ref.num > 0 {
+		u.set(ref.num, stream)
+		return nil
+	}
+
+	// a new datasets packet, placed before the postamble
+	acroForm := pdfDict{}
+	for k, v := range doc.dict(doc.catalog()["AcroForm"]) {
+		acroForm[k] = v
+	}
+	var xfa pdfArray
+	added := false
+	for _, v := range doc.array(acroForm["XFA"]) {
+		if s, ok := doc.resolve(v).(pdfString); ok && s == "postamble" && !added {
+			xfa = append(xfa, pdfString("datasets"), u.add(stream))
+			added = true
+		}
+		xfa = append(xfa, v)
+	}
+	if !added {
+		xfa = append(xfa, pdfString("datasets"), u.add(stream))
+	}
+	acroForm["XFA"] = xfa
+	return doc.setAcroForm(u, acroForm)
+}
+
+// setAcroForm replaces the interactive form dictionary
+func (doc *pdfDocument) setAcroForm(u *pdfUpdate, form pdfDict) error {
+	catalog := doc.catalog()
+	if ref, ok := catalog["AcroForm"].(pdfRef); ok {
+		u.set(ref.num, form)
+		return nil
+	}
+	root, ok := doc.trailer["Root"].(pdfRef)
+	if !ok {
+		return fmt.Errorf("document catalog is not a reference")
+	}
+	updated := pdfDict{}
+	for k, v := range catalog {
+		updated[k] = v
+	}
+	updated["AcroForm"] = form
+	u.set(root.num, updated)
+	return nil
+}
+
+// xfaSegment splits "Row[2]" into the name and the index
+func xfaSegment(seg string) (string, int) {
+	i := strings.IndexByte(seg, '[')
+	if i < 0 || !strings.HasSuffix(seg, "]") {
+		return seg, 0
+	}
+	index, err := strconv.Atoi(seg[i+1 : len(seg)-1])
+	if err != nil || index < 0 {
+		return seg, 0
+	}
+	return seg[:i], index
+}
+
+// xmlNode is an element, text or other markup of an XML document kept with
+// its namespace prefixes, so that it can be written back unchanged
+type xmlNode struct {
+	// name of an element, empty for other nodes
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	// character data, or the raw markup of comments and instructions
+	content string
+	raw     bool
+}
+
+// parseXMLNode parses data into a document node holding the top level nodes
+func parseXMLNode(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: append([]xml.Attr(nil), t.Attr...)}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.children = append(parent.children, &xmlNode{content: string(t)})
+		case xml.Comment:
+			parent.children = append(parent.children, &xmlNode{content: "<!--" + string(t) + "-->", raw: true})
+		case xml.ProcInst:
+			parent.children = append(parent.children, &xmlNode{content: "<?" + t.Target + " " + string(t.Inst) + "?>", raw: true})
+		case xml.Directive:
+			parent.children = append(parent.children, &xmlNode{content: "<!" + string(t) + ">", raw: true})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unclosed element %s", stack[len(stack)-1].name.Local)
+	}
+	return doc, nil
+}
+
+// elements returns the child elements, n may be nil
+func (n *xmlNode) elements() []*xmlNode {
+	if n == nil {
+		return nil
+	}
+	var elems []*xmlNode
+	for _, c := range n.children {
+		if len(c.name.Local) > 0 {
+			elems = append(elems, c)
+		}
+	}
+	return elems
+}
+
+// child returns the first child element with the local name, the prefix is
+// ignored
+func (n *xmlNode) child(local string) *xmlNode {
+	for _, c := range n.elements() {
+		if c.name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// elementAt returns the child element local with the given index among its
+// namesakes, missing elements are appended
+func (n *xmlNode) elementAt(local string, index int) *xmlNode {
+	var same []*xmlNode
+	for _, e := range n.elements() {
+		if e.name.Local == local {
+			same = append(same, e)
+		}
+	}
+	for len(same) <= index {
+		c := &xmlNode{name: xml.Name{Local: local}}
+		n.children = append(n.children, c)
+		same = append(same, c)
+	}
+	return same[index]
+}
+
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == local && len(a.Name.Space) == 0 {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// text returns the character data of the element
+func (n *xmlNode) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if len(c.name.Local) == 0 && !c.raw {
+			b.WriteString(c.content)
+		}
+	}
+	return b.String()
+}
+
+// texts returns the text of the child elements, such as the options of
+// <items>
+func (n *xmlNode) texts() []string {
+	var texts []string
+	for _, c := range n.elements() {
+		texts = append(texts, c.text())
+	}
+	return texts
+}
+
+// setText replaces the content of the element with s
+func (n *xmlNode) setText(s string) {
+	n.children = []*xmlNode{{content: s}}
+	// an xsi:nil="true" would hide the value
+	attrs := n.attrs[:0]
+	for _, a := range n.attrs {
+		if a.Name.Local != "nil" {
+			attrs = append(attrs, a)
+		}
+	}
+	n.attrs = attrs
+}
+
+func xmlQName(name xml.Name) string {
+	if len(name.Space) > 0 {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// write serializes the node, the document node writes its children
+func (n *xmlNode) write(buf *bytes.Buffer) {
+	switch {
+	case n.raw:
+		buf.WriteString(n.content)
+		return
+	case len(n.name.Local) == 0 && n.children == nil:
+		xml.EscapeText(buf, []byte(n.content))
+		return
+	case len(n.name.Local) == 0:
+		for _, c := range n.children {
+			c.write(buf)
+		}
+		return
+	}
+
+	buf.WriteByte('<')
+	buf.WriteString(xmlQName(n.name))
+	for _, a := range n.attrs {
+		buf.WriteByte(' ')
+		buf.WriteString(xmlQName(a.Name))
+		buf.WriteString(`="`)
+		xml.EscapeText(buf, []byte(a.Value))
+		buf.WriteByte('"')
+	}
+	if len(n.children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+	buf.WriteByte('>')
+	for _, c := range n.children {
+		c.write(buf)
+	}
+	buf.WriteString("</")
+	buf.WriteString(xmlQName(n.name))
+	buf.WriteByte('>')
+}
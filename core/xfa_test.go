@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testXFATemplate = `<template xmlns="http://www.xfa.org/schema/xfa-template/3.3/">
+<subform name="form1"><pageSet><pageArea name="Page1"/></pageSet>
+<subform name="Page1">
+<field name="LastName"><ui><textEdit/></ui></field>
+<field name="DOB"><ui><dateTimeEdit/></ui></field>
+<subform><field name="Country"><ui><choiceList/></ui><items><text>AU</text><text>CN</text></items></field></subform>
+<exclGroup name="Sex">
+<field name="M"><ui><checkButton/></ui><items><integer>1</integer></items></field>
+<field name="F"><ui><checkButton/></ui><items><integer>2</integer></items></field>
+</exclGroup>
+</subform>
+</subform>
+</template>`
+
+const testXFADatasets = `<xfa:datasets xmlns:xfa="http://www.xfa.org/schema/xfa-data/1.0/"><xfa:data>
+<form1><Page1><LastName>Lee</LastName><DOB xsi:nil="true" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"/><Row>a</Row><Row>b &amp; c</Row></Page1></form1>
+</xfa:data></xfa:datasets>`
+
+// writeXFAPdf writes a hybrid form without fields with the xfa packets
+func writeXFAPdf(t *testing.T, path string, packets ...string) {
+	w := newPdfWriter("1.7")
+	var xfa pdfArray
+	for i := 0; i+1 < len(packets); i += 2 {
+		xfa = append(xfa, pdfString(packets[i]), w.add(flateStream(pdfDict{}, []byte(packets[i+1]))))
+	}
+	pages := w.alloc()
+	page := w.add(pdfDict{"Type": pdfName("Page"), "Parent": pages, "MediaBox": pdfArray{int64(0), int64(0), int64(612), int64(792)}})
+	w.writeObject(pages, pdfDict{"Type": pdfName("Pages"), "Kids": pdfArray{page}, "Count": int64(1)})
+	form := w.add(pdfDict{"Fields": pdfArray{}, "XFA": xfa})
+	catalog := w.add(pdfDict{"Type": pdfName("Catalog"), "Pages": pages, "AcroForm": form})
+	err := w.writeFile(path, pdfDict{"Root": catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadXFA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xfa.pdf")
+	writeXFAPdf(t, path, "preamble", "<xdp:xdp xmlns:xdp=\"http://ns.adobe.com/xdp/\">",
+		"template", testXFATemplate, "datasets", testXFADatasets, "postamble", "</xdp:xdp>")
+
+	if !hasXFA(path) || hasXFA("../file/1022.pdf") {
+		t.Errorf("hasXFA is wrong")
+	}
+	xfa, err := ReadXFA(path)
+	if err != nil {
+		t.Fatalf("ReadXFA:%v", err)
+	}
+	wantFields := []XFAField{
+		{Name: "form1.Page1.LastName", Type: "text"},
+		{Name: "form1.Page1.DOB", Type: "date"},
+		{Name: "form1.Page1.Country", Type: "choice", Options: []string{"AU", "CN"}},
+		{Name: "form1.Page1.Sex", Type: "radio", Options: []string{"1", "2"}},
+	}
+	if !reflect.DeepEqual(xfa.Fields, wantFields) {
+		t.Errorf("Fields = %+v", xfa.Fields)
+	}
+	wantData := map[string]string{
+		"form1.Page1.LastName": "Lee",
+		"form1.Page1.DOB":      "",
+		"form1.Page1.Row":      "a",
+		"form1.Page1.Row[1]":   "b & c",
+	}
+	if !reflect.DeepEqual(xfa.Data, wantData) {
+		t.Errorf("Data = %v", xfa.Data)
+	}
+
+	dest := filepath.Join(t.TempDir(), "filled.pdf")
+	err = FillXFANative(map[string]interface{}{
+		"form1[0].Page1[0].DOB[0]": "1980-01-01",
+		"form1.Page1.Row[1]":       "<d>",
+		"form1.Page1.Row[2]":       "e",
+		"form1.Page1.Address.City": "Sydney",
+		"form1[0].Page1[0].Sex[0]": 2,
+	}, path, dest)
+	if err != nil {
+		t.Fatalf("FillXFANative:%v", err)
+	}
+	filled, err := ReadXFA(dest)
+	if err != nil {
+		t.Fatalf("ReadXFA:%v", err)
+	}
+	wantData = map[string]string{
+		"form1.Page1.LastName":     "Lee",
+		"form1.Page1.DOB":          "1980-01-01",
+		"form1.Page1.Row":          "a",
+		"form1.Page1.Row[1]":       "<d>",
+		"form1.Page1.Row[2]":       "e",
+		"form1.Page1.Address.City": "Sydney",
+		"form1.Page1.Sex":          "2",
+	}
+	if !reflect.DeepEqual(filled.Data, wantData) {
+		t.Errorf("Data = %v", filled.Data)
+	}
+}
+
+func TestFillXFAWithoutDatasets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xfa.pdf")
+	writeXFAPdf(t, path, "template", testXFATemplate, "postamble", "</xdp:xdp>")
+	dest := filepath.Join(dir, "filled.pdf")
+	err := FillXFANative(map[string]interface{}{"form1.Page1.LastName": "Lee"}, path, dest)
+	if err != nil {
+		t.Fatalf("FillXFANative:%v", err)
+	}
+
+	doc, err := readPdfFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := doc.xfaPackets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range packets {
+		names = append(names, p.name)
+	}
+	if strings.Join(names, ",") != "template,datasets,postamble" {
+		t.Errorf("packets = %v", names)
+	}
+	xfa, err := ReadXFA(dest)
+	if err != nil {
+		t.Fatalf("ReadXFA:%v", err)
+	}
+	if xfa.Data["form1.Page1.LastName"] != "Lee" {
+		t.Errorf("Data = %v", xfa.Data)
+	}
+}
+
+func TestXMLNodeRoundTrip(t *testing.T) {
+	src := `<?xml version="1.0"?><!-- c --><a:x xmlns:a="urn:a" k="1 &amp; 2"><y/>t &lt; u<z a:n="v">w</z></a:x>`
+	n, err := parseXMLNode([]byte(src))
+	if err != nil {
+		t.Fatalf("parseXMLNode:%v", err)
+	}
+	var buf bytes.Buffer
+	n.write(&buf)
+	if buf.String() != src {
+		t.Errorf("write = %s", buf.String())
+	}
+}
+
+func TestDropAndFillXFA(t *testing.T) {
+	opts := FillOptions{DropXFA: true, FillXFA: true}
+	if err := opts.validate(); err == nil {
+		t.Errorf("validate accepted DropXFA with FillXFA")
+	}
+}
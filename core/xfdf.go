@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xfdfNamespace = "http://ns.adobe.com/xfdf/"
+
+// xfdf document, fields nest by the parts of their dotted names
+type xfdfDoc struct {
+	XMLName xml.Name    `xml:"xfdf"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Space   string      `xml:"xml:space,attr,omitempty"`
+	Fields  []xfdfField `xml:"fields>field"`
+}
+
+type xfdfField struct {
+	Name   string      `xml:"name,attr"`
+	Values []string    `xml:"value"`
+	Fields []xfdfField `xml:"field"`
+}
+
+// WriteXFDF writes form data as an xfdf document accepted by pdftk fill_form
+func WriteXFDF(w io.Writer, form map[string]interface{}) error {
+	doc := xfdfDoc{Xmlns: xfdfNamespace, Space: "preserve"}
+	for _, key := range sortedKeys(form) {
+		values, _ := formValueList(form[key])
+		doc.Fields = addXfdfField(doc.Fields, strings.Split(key, "."), values)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("fail to encode xfdf: %v", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// insert a field below the node path, reusing existing parents
+func addXfdfField(fields []xfdfField, path []string, values []string) []xfdfField {
+	for i := range fields {
+		if fields[i].Name == path[0] && len(path) > 1 {
+			fields[i].Fields = addXfdfField(fields[i].Fields, path[1:], values)
+			return fields
+		}
+	}
+	f := xfdfField{Name: path[0]}
+	if len(path) > 1 {
+		f.Fields = addXfdfField(nil, path[1:], values)
+	} else {
+		f.Values = values
+	}
+	return append(fields, f)
+}
+
+// ReadXFDF reads the field values of an xfdf document
+func ReadXFDF(r io.Reader) (map[string]interface{}, error) {
+	var doc xfdfDoc
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode xfdf: %v", err)
+	}
+
+	form := make(map[string]interface{})
+	readXfdfFields(form, "", doc.Fields)
+	return form, nil
+}
+
+func readXfdfFields(form map[string]interface{}, prefix string, fields []xfdfField) {
+	for _, f := range fields {
+		name := joinFieldName(prefix, f.Name)
+		readXfdfFields(form, name, f.Fields)
+		switch len(f.Values) {
+		case 0:
+		case 1:
+			form[name] = f.Values[0]
+		default:
+			form[name] = f.Values
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig decodes a json or yaml file into v, yaml is picked by the
+// .yaml/.yml extension
+func loadConfig(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %v", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return fmt.Errorf("fail to decode %s: %v", path, err)
+		}
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("fail to decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// yamlToJSON converts a yaml document to json, so configuration types only
+// implement json decoding. Mapping keys and scalars other than booleans and
+// null are strings, configuration values are text.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return []byte("null"), nil
+	}
+	v, err := yamlValue(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.SequenceNode:
+		seq := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind == yaml.AliasNode {
+				key = key.Alias
+			}
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+			}
+			v, err := yamlValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		return m, nil
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var b bool
+			err := n.Decode(&b)
+			return b, err
+		}
+		return n.Value, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected yaml node", n.Line)
+}
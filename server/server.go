@@ -0,0 +1,635 @@
+// Package server exposes lipdf form filling over HTTP.
+//
+// Endpoints:
+//
+//	GET    /templates                list registered templates
+//	PUT    /templates/{name}         register a template, body is the pdf
+//	                                 or a multipart form with a "file" part
+//	GET    /templates/{name}         download the template pdf
+//	DELETE /templates/{name}         remove a template version, the
+//	                                 latest one without a version
+//	GET    /templates/{name}/fields  field schema as returned by PdfFieldsToJSON
+//	POST   /templates/{name}/fill    fill with the json object in the body,
+//	                                 responds with the filled pdf. Query
+//	                                 parameters flatten, need_appearances,
+//	                                 attach_data, drop_xfa, fill_xfa and
+//	                                 break_signatures set the fill options,
+//	                                 the headers Lipdf-Owner-Password and
+//	                                 Lipdf-User-Password encrypt the output
+//	                                 with the query parameters encryption
+//	                                 and allow, see core.Encryption
+//	POST   /templates/{name}/preview fill like fill and respond with the
+//	                                 page query parameter, default 1, as
+//	                                 png at dpi, default 96. The page is
+//	                                 rendered before encryption. Responds
+//	                                 501 if no renderer is installed.
+//
+// All template endpoints take an optional version query parameter, the
+// latest version is used when it is missing. Templates are kept in a
+// core.Registry, so field schemas are parsed once per template revision.
+//
+// Errors are returned as {"error": "..."} with a matching status code.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunlidea/lipdf/core"
+)
+
+// Config of a Server, zero values select the defaults
+type Config struct {
+	// Dir stores the registered templates as name.pdf or
+	// name/version.pdf, existing files are loaded by New
+	Dir string
+	// MaxTemplateSize limits uploaded templates, default 32MB
+	MaxTemplateSize int64
+	// MaxDataSize limits the json body of a fill request, default 1MB
+	MaxDataSize int64
+	// Timeout bounds the work of a single request including the wait for
+	// a pdftk slot, default 60s
+	Timeout time.Duration
+	// MaxConcurrent limits the pdftk processes run at the same time,
+	// default the number of CPUs
+	MaxConcurrent int
+	// Renderer rasterizes previews, default core.DefaultRenderer
+	Renderer core.Renderer
+}
+
+// Server is an http.Handler serving the fill endpoints
+type Server struct {
+	cfg Config
+	// pdftk slots
+	sem chan struct{}
+	// guards template files
+	mu       sync.Mutex
+	registry *core.Registry
+}
+
+// template names are used as file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// New creates a Server storing its templates in cfg.Dir
+func New(cfg Config) (*Server, error) {
+	if len(cfg.Dir) == 0 {
+		return nil, fmt.Errorf("template directory is required")
+	}
+	err := os.MkdirAll(cfg.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create template directory: %v", err)
+	}
+	if cfg.MaxTemplateSize <= 0 {
+		cfg.MaxTemplateSize = 32 << 20
+	}
+	if cfg.MaxDataSize <= 0 {
+		cfg.MaxDataSize = 1 << 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = runtime.NumCPU()
+	}
+
+	registry := core.NewRegistry()
+	err = registry.LoadDir(cfg.Dir)
+	if err != nil {
+		registry.Close()
+		return nil, fmt.Errorf("fail to load templates: %v", err)
+	}
+
+	return &Server{
+		cfg:      cfg,
+		sem:      make(chan struct{}, cfg.MaxConcurrent),
+		registry: registry,
+	}, nil
+}
+
+// Close releases the cached templates
+func (s *Server) Close() error {
+	return s.registry.Close()
+}
+
+// http error with status code
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &httpError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	err := s.route(w, r)
+	if err != nil {
+		s.writeError(w, err)
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) error {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if parts[0] != "templates" || len(parts) > 3 {
+		return errorf(http.StatusNotFound, "not found")
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			return methodNotAllowed(w, http.MethodGet)
+		}
+		return s.listTemplates(w, r)
+	}
+
+	name := parts[1]
+	if !validName.MatchString(name) {
+		return errorf(http.StatusBadRequest, "invalid template name %q", name)
+	}
+	version := r.URL.Query().Get("version")
+	if len(version) > 0 && !validName.MatchString(version) {
+		return errorf(http.StatusBadRequest, "invalid template version %q", version)
+	}
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return s.getTemplate(w, r, name, version)
+		case http.MethodPut, http.MethodPost:
+			return s.putTemplate(w, r, name, version)
+		case http.MethodDelete:
+			return s.deleteTemplate(w, r, name, version)
+		}
+		return methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+
+	switch parts[2] {
+	case "fields":
+		if r.Method != http.MethodGet {
+			return methodNotAllowed(w, http.MethodGet)
+		}
+		return s.templateFields(w, r, name, version)
+	case "fill":
+		if r.Method != http.MethodPost {
+			return methodNotAllowed(w, http.MethodPost)
+		}
+		return s.fill(w, r, name, version)
+	case "preview":
+		if r.Method != http.MethodPost {
+			return methodNotAllowed(w, http.MethodPost)
+		}
+		return s.preview(w, r, name, version)
+	}
+	return errorf(http.StatusNotFound, "not found")
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) error {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	return errorf(http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// file of a template version below Dir
+func (s *Server) templatePath(name, version string) string {
+	if len(version) == 0 {
+		return filepath.Join(s.cfg.Dir, name+".pdf")
+	}
+	return filepath.Join(s.cfg.Dir, name, version+".pdf")
+}
+
+// registered template, refreshed in a pdftk slot if its file changed
+func (s *Server) template(r *http.Request, name, version string) (*core.Template, error) {
+	err := s.acquire(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.registry.GetContext(r.Context(), name, version)
+	s.release()
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "%v", err)
+	}
+	return t, nil
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, http.StatusOK, s.registry.List())
+}
+
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request, name, version string) error {
+	t, err := s.template(r, name, version)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.templatePath(t.Name, t.Version))
+	if os.IsNotExist(err) {
+		return errorf(http.StatusNotFound, "template %q not found", name)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("ETag", strconv.Quote(t.Checksum()))
+	http.ServeContent(w, r, name+".pdf", fi.ModTime(), f)
+	return nil
+}
+
+func (s *Server) putTemplate(w http.ResponseWriter, r *http.Request, name, version string) error {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxTemplateSize)
+
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return errorf(http.StatusBadRequest, "invalid multipart body: %v", err)
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return errorf(http.StatusBadRequest, "multipart body has no \"file\" part")
+			}
+			if err != nil {
+				return requestBodyError(err)
+			}
+			if part.FormName() == "file" {
+				body = part
+				break
+			}
+		}
+	}
+
+	// write to a temporary file first, templates are replaced atomically
+	tmp, err := ioutil.TempFile(s.cfg.Dir, ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return requestBodyError(err)
+	}
+	if !isPDF(tmp.Name()) {
+		return errorf(http.StatusUnsupportedMediaType, "template is not a pdf")
+	}
+
+	// the fields are parsed once before the upload replaces the stored
+	// template, pdftk is killed if the client goes away
+	err = s.acquire(r.Context())
+	if err != nil {
+		return err
+	}
+	t, err := core.LoadTemplateContext(r.Context(), tmp.Name(), "")
+	s.release()
+	if err != nil {
+		if errors.Is(err, core.ErrNoPdftk) {
+			return err
+		}
+		if errors.Is(err, core.ErrPasswordRequired) {
+			// the server has no password to reload it with
+			return errorf(http.StatusUnprocessableEntity, "template is encrypted, upload it decrypted")
+		}
+		return errorf(http.StatusUnprocessableEntity, "fail to read template fields: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dest := s.templatePath(name, version)
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err == nil {
+		err = os.Rename(tmp.Name(), dest)
+	}
+	if err == nil {
+		err = s.registry.Add(name, version, dest, t)
+	}
+	if err != nil {
+		t.Close()
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, t.Info())
+}
+
+func (s *Server) deleteTemplate(w http.ResponseWriter, r *http.Request, name, version string) error {
+	t, err := s.template(r, name, version)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.registry.Remove(t.Name, t.Version)
+	err = os.Remove(s.templatePath(t.Name, t.Version))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) templateFields(w http.ResponseWriter, r *http.Request, name, version string) error {
+	t, err := s.template(r, name, version)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, t.FieldInfo())
+}
+
+func (s *Server) fill(w http.ResponseWriter, r *http.Request, name, version string) error {
+	outPath, cleanup, err := s.fillTemplate(w, r, name, version, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	f, err := os.Open(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-filled.pdf"))
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, f)
+	if err != nil {
+		// headers are sent, the client sees a truncated body
+		log.Printf("lipdf server: fail to write filled pdf: %v", err)
+	}
+	return nil
+}
+
+// preview fills like fill and responds with a page of the result as png
+func (s *Server) preview(w http.ResponseWriter, r *http.Request, name, version string) error {
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		return err
+	}
+	dpi, err := queryInt(r, "dpi", core.DefaultDPI)
+	if err != nil {
+		return err
+	}
+	if dpi > core.MaxDPI {
+		return errorf(http.StatusBadRequest, "dpi above %d", core.MaxDPI)
+	}
+	t, err := s.template(r, name, version)
+	if err != nil {
+		return err
+	}
+	if n := len(t.FieldInfo().Pages); n > 0 && page > n {
+		return errorf(http.StatusBadRequest, "page %d out of the %d pages", page, n)
+	}
+	// an encrypted fill cannot be rendered, the preview shows it unencrypted
+	outPath, cleanup, err := s.fillTemplate(w, r, name, version, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	err = s.acquire(r.Context())
+	if err != nil {
+		return err
+	}
+	pages, err := core.RenderPages(r.Context(), s.cfg.Renderer, outPath, []core.PageRange{{First: page, Last: page}}, dpi)
+	s.release()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(pages[0].PNG)))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(pages[0].PNG)
+	if err != nil {
+		log.Printf("lipdf server: fail to write preview: %v", err)
+	}
+	return nil
+}
+
+// fillTemplate fills the template with the json object in the body and the
+// options of the query, encrypted if encrypt is set and the headers ask
+// for it. The filled pdf is removed by cleanup.
+func (s *Server) fillTemplate(w http.ResponseWriter, r *http.Request, name, version string, encrypt bool) (string, func(), error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxDataSize)
+	var form map[string]interface{}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	err := dec.Decode(&form)
+	if err != nil {
+		return "", nil, requestBodyError(err)
+	}
+	opts, err := fillOptions(r)
+	if err != nil {
+		return "", nil, err
+	}
+	if !encrypt {
+		opts.Encryption = nil
+	}
+	t, err := s.template(r, name, version)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "lipdf-server-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+	outPath := filepath.Join(tmpDir, "filled.pdf")
+
+	err = s.acquire(r.Context())
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	err = t.Fill(r.Context(), form, outPath, opts)
+	s.release()
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return outPath, cleanup, nil
+}
+
+// fillOptions reads the fill options from the query and headers
+func fillOptions(r *http.Request) (core.FillOptions, error) {
+	opts := core.FillOptions{}
+	var err error
+	opts.Flatten, err = queryBool(r, "flatten")
+	if err != nil {
+		return opts, err
+	}
+	opts.NeedAppearances, err = queryBool(r, "need_appearances")
+	if err != nil {
+		return opts, err
+	}
+	opts.DropXFA, err = queryBool(r, "drop_xfa")
+	if err != nil {
+		return opts, err
+	}
+	opts.FillXFA, err = queryBool(r, "fill_xfa")
+	if err != nil {
+		return opts, err
+	}
+	if opts.DropXFA && opts.FillXFA {
+		return opts, errorf(http.StatusBadRequest, "drop_xfa and fill_xfa exclude each other")
+	}
+	opts.BreakSignatures, err = queryBool(r, "break_signatures")
+	if err != nil {
+		return opts, err
+	}
+	opts.Encryption, err = requestEncryption(r)
+	if err != nil {
+		return opts, err
+	}
+	switch opts.AttachData = r.URL.Query().Get("attach_data"); opts.AttachData {
+	case "", "json", "fdf", "xfdf":
+	default:
+		return opts, errorf(http.StatusBadRequest, "invalid attach_data: %q", opts.AttachData)
+	}
+	return opts, nil
+}
+
+// wait for a free pdftk slot
+func (s *Server) acquire(ctx context.Context) error {
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errorf(http.StatusServiceUnavailable, "too many concurrent requests: %v", ctx.Err())
+	}
+}
+
+func (s *Server) release() {
+	<-s.sem
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if he, ok := err.(*httpError); ok {
+		code = he.code
+	} else if errors.Is(err, core.ErrPasswordRequired) {
+		code = http.StatusUnprocessableEntity
+	} else if errors.Is(err, core.ErrSigned) {
+		code = http.StatusConflict
+	} else if errors.Is(err, core.ErrNoRenderer) || errors.Is(err, core.ErrNoPdftk) {
+		code = http.StatusNotImplemented
+	} else {
+		log.Printf("lipdf server: %v", err)
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// map body read errors to status codes
+func requestBodyError(err error) error {
+	if strings.Contains(err.Error(), "request body too large") {
+		return errorf(http.StatusRequestEntityTooLarge, "request body too large")
+	}
+	return errorf(http.StatusBadRequest, "invalid request body: %v", err)
+}
+
+// requestEncryption reads the passwords of the output from headers, which
+// unlike the query are not written to access logs
+func requestEncryption(r *http.Request) (*core.Encryption, error) {
+	enc := &core.Encryption{
+		OwnerPassword: r.Header.Get("Lipdf-Owner-Password"),
+		UserPassword:  r.Header.Get("Lipdf-User-Password"),
+		Algorithm:     core.EncryptionAlgorithm(r.URL.Query().Get("encryption")),
+	}
+	if len(enc.OwnerPassword) == 0 && len(enc.UserPassword) == 0 {
+		return nil, nil
+	}
+	allow, err := core.ParsePermissions(r.URL.Query().Get("allow"))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid allow: %v", err)
+	}
+	enc.Allow = allow
+	if err = enc.Validate(); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid encryption: %v", err)
+	}
+	return enc, nil
+}
+
+// queryInt returns the positive integer of key, def if it is missing
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if len(v) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, errorf(http.StatusBadRequest, "invalid %s: %q", key, v)
+	}
+	return n, nil
+}
+
+func queryBool(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if len(v) == 0 {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errorf(http.StatusBadRequest, "invalid %s: %q", key, v)
+	}
+	return b, nil
+}
+
+// check the pdf header
+func isPDF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(f, head)
+	return strings.Contains(string(head[:n]), "%PDF-")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "lipdf-server-test-")
+	if err != nil {
+		t.Fatalf("TempDir:%v", err)
+	}
+	s, err := New(Config{Dir: dir, MaxTemplateSize: 64, MaxDataSize: 32})
+	if err != nil {
+		t.Fatalf("New:%v", err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestServerErrors(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", "/templates", "", http.StatusOK},
+		{"GET", "/other", "", http.StatusNotFound},
+		{"POST", "/templates", "", http.StatusMethodNotAllowed},
+		{"GET", "/templates/..", "", http.StatusBadRequest},
+		{"GET", "/templates/1022", "", http.StatusNotFound},
+		{"GET", "/templates/1022/fields", "", http.StatusNotFound},
+		{"DELETE", "/templates/1022", "", http.StatusNotFound},
+		{"PUT", "/templates/1022", "not a pdf", http.StatusUnsupportedMediaType},
+		{"PUT", "/templates/1022", strings.Repeat("x", 100), http.StatusRequestEntityTooLarge},
+		{"POST", "/templates/1022/fill", `{"ap.dob": "01/01/1980"}`, http.StatusNotFound},
+		{"POST", "/templates/1022/fill", `{`, http.StatusBadRequest},
+		{"POST", "/templates/1022/fill", `{"ap.dob": "` + strings.Repeat("x", 100) + `"}`, http.StatusRequestEntityTooLarge},
+		{"POST", "/templates/1022/fill?flatten=maybe", `{}`, http.StatusBadRequest},
+		{"POST", "/templates/1022/fill?attach_data=csv", `{}`, http.StatusBadRequest},
+		{"POST", "/templates/1022/fill?drop_xfa=1&fill_xfa=1", `{}`, http.StatusBadRequest},
+		{"GET", "/templates/1022/preview", "", http.StatusMethodNotAllowed},
+		{"POST", "/templates/1022/preview?page=0", `{}`, http.StatusBadRequest},
+		{"POST", "/templates/1022/preview?dpi=2000", `{}`, http.StatusBadRequest},
+		{"POST", "/templates/1022/preview", `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Fatalf("%s %s: got status %d, want %d: %s", tt.method, tt.path, rec.Code, tt.code, rec.Body.String())
+		}
+	}
+}
+
+func TestPutTemplateKeepsStored(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	stored := []byte("%PDF-1.4 stored")
+	err := ioutil.WriteFile(filepath.Join(s.cfg.Dir, "1022.pdf"), stored, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the upload cannot be registered without pdftk
+	t.Setenv("PATH", t.TempDir())
+	req := httptest.NewRequest("PUT", "/templates/1022", strings.NewReader("%PDF-1.4 upload"))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("PUT: got status %d: %s", rec.Code, rec.Body.String())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.cfg.Dir, "1022.pdf"))
+	if err != nil || !bytes.Equal(data, stored) {
+		t.Errorf("stored template = %q, %v", data, err)
+	}
+	files, _ := ioutil.ReadDir(s.cfg.Dir)
+	if len(files) != 1 {
+		t.Errorf("files left in Dir: %d", len(files))
+	}
+}